@@ -24,38 +24,46 @@ import (
 	"github.com/cloudwego/kitex/pkg/circuitbreak"
 	"github.com/cloudwego/kitex/pkg/rpcinfo"
 	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/pkg/validation"
+	"github.com/kitex-contrib/config-etcd/source"
 	"github.com/kitex-contrib/config-etcd/utils"
 )
 
 // WithCircuitBreaker sets the circuit breaker policy from etcd configuration center.
-func WithCircuitBreaker(dest, src string, etcdClient etcd.Client, uniqueID int64, opts utils.Options) []client.Option {
-	param, err := etcdClient.ClientConfigParam(&etcd.ConfigParamConfig{
+func WithCircuitBreaker(dest, src string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) []client.Option {
+	options, _ := withCircuitBreaker(context.Background(), dest, src, configSource, uniqueID, opts)
+	return options
+}
+
+func withCircuitBreaker(ctx context.Context, dest, src string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) ([]client.Option, error) {
+	cpc := &etcd.ConfigParamConfig{
 		Category:          circuitBreakerConfigName,
 		ServerServiceName: dest,
 		ClientServiceName: src,
-	})
+		Dimensions:        opts.ConfigDimensions(),
+	}
+	key, err := configSource.ClientConfigKey(cpc, opts.EtcdCustomFunctions...)
 	if err != nil {
 		panic(err)
 	}
-
-	for _, f := range opts.EtcdCustomFunctions {
-		f(&param)
+	layers, err := configSource.ClientConfigLayers(cpc, opts.EtcdCustomFunctions...)
+	if err != nil {
+		panic(err)
 	}
-	key := param.Prefix + "/" + param.Path
-	cbSuite := initCircuitBreaker(key, dest, src, etcdClient, uniqueID)
+	cbSuite, loadErr := initCircuitBreaker(ctx, cpc, key, layers, dest, configSource, uniqueID, opts)
 
 	return []client.Option{
 		client.WithCircuitBreaker(cbSuite),
 		client.WithCloseCallbacks(func() error {
 			// cancel the configuration listener when client is closed.
-			etcdClient.DeregisterConfig(key, uniqueID)
+			configSource.DeregisterConfig(key, uniqueID)
 			err = cbSuite.Close()
 			if err != nil {
 				return err
 			}
 			return nil
 		}),
-	}
+	}, loadErr
 }
 
 // keep consistent when initialising the circuit breaker suit and updating
@@ -77,13 +85,13 @@ func genServiceCBKey(toService, method string) string {
 	return buf.String()
 }
 
-func initCircuitBreaker(key, dest, src string,
-	etcdClient etcd.Client, uniqueID int64,
-) *circuitbreak.CBSuite {
+func initCircuitBreaker(ctx context.Context, cpc *etcd.ConfigParamConfig, key string, layers []string, dest string,
+	configSource source.ConfigSource, uniqueID int64, opts utils.Options,
+) (*circuitbreak.CBSuite, error) {
 	cb := circuitbreak.NewCBSuite(genServiceCBKeyWithRPCInfo)
 	lcb := utils.ThreadSafeSet{}
 
-	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser) {
+	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
 		set := utils.Set{}
 		configs := map[string]circuitbreak.CBConfig{}
 
@@ -91,7 +99,11 @@ func initCircuitBreaker(key, dest, src string,
 			err := parser.Decode(data, &configs)
 			if err != nil {
 				klog.Warnf("[etcd] %s client etcd circuit breaker: unmarshal data %s failed: %s, skip...", key, data, err)
-				return
+				return err
+			}
+			if err = opts.Validate(key, validation.CircuitBreakerCategory, configs); err != nil {
+				klog.Warnf("[etcd] %s client etcd circuit breaker: %s, keep the last valid config", key, err)
+				return err
 			}
 		}
 
@@ -106,9 +118,11 @@ func initCircuitBreaker(key, dest, src string,
 			// For deleted method configs, set to default policy
 			cb.UpdateServiceCBConfig(key, circuitbreak.GetDefaultCBConfig())
 		}
+		return nil
 	}
 
-	etcdClient.RegisterConfigCallback(context.Background(), key, uniqueID, onChangeCallback)
+	err := configSource.RegisterConfigCallback(ctx, key, uniqueID, onChangeCallback,
+		source.WithConfigParam(cpc), source.WithLayers(layers...), source.WithListeners(opts.ConfigListeners...))
 
-	return cb
+	return cb, err
 }
@@ -21,46 +21,61 @@ import (
 	"github.com/cloudwego/kitex/pkg/klog"
 	"github.com/kitex-contrib/config-etcd/etcd"
 	"github.com/kitex-contrib/config-etcd/pkg/degradation"
+	"github.com/kitex-contrib/config-etcd/pkg/validation"
+	"github.com/kitex-contrib/config-etcd/source"
 	"github.com/kitex-contrib/config-etcd/utils"
 )
 
-func WithDegradation(dest, src string, etcdClient etcd.Client, uniqueID int64, opts utils.Options) []client.Option {
-	param, err := etcdClient.ClientConfigParam(&etcd.ConfigParamConfig{
+func WithDegradation(dest, src string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) []client.Option {
+	options, _ := withDegradation(context.Background(), dest, src, configSource, uniqueID, opts)
+	return options
+}
+
+func withDegradation(ctx context.Context, dest, src string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) ([]client.Option, error) {
+	cpc := &etcd.ConfigParamConfig{
 		Category:          degradationConfigName,
 		ServerServiceName: dest,
 		ClientServiceName: src,
-	})
+		Dimensions:        opts.ConfigDimensions(),
+	}
+	key, err := configSource.ClientConfigKey(cpc, opts.EtcdCustomFunctions...)
 	if err != nil {
 		panic(err)
 	}
-	for _, f := range opts.EtcdCustomFunctions {
-		f(&param)
+	layers, err := configSource.ClientConfigLayers(cpc, opts.EtcdCustomFunctions...)
+	if err != nil {
+		panic(err)
 	}
-	key := param.Prefix + "/" + param.Path
-	container := initDegradationOptions(key, dest, uniqueID, etcdClient)
+	container, err := initDegradationOptions(ctx, cpc, key, layers, uniqueID, configSource, opts)
 	return []client.Option{
 		client.WithACLRules(container.GetAclRule()),
 		client.WithCloseCallbacks(func() error {
 			// cancel the configuration listener when client is closed.
-			etcdClient.DeregisterConfig(key, uniqueID)
+			configSource.DeregisterConfig(key, uniqueID)
 			return nil
 		}),
-	}
+	}, err
 }
 
-func initDegradationOptions(key, dest string, uniqueID int64, etcdClient etcd.Client) *degradation.Container {
+func initDegradationOptions(ctx context.Context, cpc *etcd.ConfigParamConfig, key string, layers []string, uniqueID int64, configSource source.ConfigSource, opts utils.Options) (*degradation.Container, error) {
 	container := degradation.NewContainer()
-	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser) {
+	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
 		config := &degradation.Config{}
 		if !restoreDefault {
 			err := parser.Decode(data, config)
 			if err != nil {
 				klog.Warnf("[etcd] %s server etcd degradation config: unmarshal data %s failed: %s, skip...", key, data, err)
-				return
+				return err
+			}
+			if err = opts.Validate(key, validation.DegradationCategory, config); err != nil {
+				klog.Warnf("[etcd] %s server etcd degradation config: %s, keep the last valid config", key, err)
+				return err
 			}
 		}
 		container.NotifyPolicyChange(config)
+		return nil
 	}
-	etcdClient.RegisterConfigCallback(context.Background(), key, uniqueID, onChangeCallback)
-	return container
+	err := configSource.RegisterConfigCallback(ctx, key, uniqueID, onChangeCallback,
+		source.WithConfigParam(cpc), source.WithLayers(layers...), source.WithListeners(opts.ConfigListeners...))
+	return container, err
 }
@@ -21,44 +21,52 @@ import (
 	"github.com/cloudwego/kitex/pkg/klog"
 	"github.com/cloudwego/kitex/pkg/retry"
 	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/pkg/validation"
+	"github.com/kitex-contrib/config-etcd/source"
 	"github.com/kitex-contrib/config-etcd/utils"
 )
 
 // WithRetryPolicy sets the retry policy from etcd configuration center.
-func WithRetryPolicy(dest, src string, etcdClient etcd.Client, uniqueID int64, opts utils.Options) []client.Option {
-	param, err := etcdClient.ClientConfigParam(&etcd.ConfigParamConfig{
+func WithRetryPolicy(dest, src string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) []client.Option {
+	options, _ := withRetryPolicy(context.Background(), dest, src, configSource, uniqueID, opts)
+	return options
+}
+
+func withRetryPolicy(ctx context.Context, dest, src string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) ([]client.Option, error) {
+	cpc := &etcd.ConfigParamConfig{
 		Category:          retryConfigName,
 		ServerServiceName: dest,
 		ClientServiceName: src,
-	})
+		Dimensions:        opts.ConfigDimensions(),
+	}
+	key, err := configSource.ClientConfigKey(cpc, opts.EtcdCustomFunctions...)
 	if err != nil {
 		panic(err)
 	}
-
-	for _, f := range opts.EtcdCustomFunctions {
-		f(&param)
+	layers, err := configSource.ClientConfigLayers(cpc, opts.EtcdCustomFunctions...)
+	if err != nil {
+		panic(err)
 	}
-	key := param.Prefix + "/" + param.Path
-	rc := initRetryContainer(key, dest, etcdClient, uniqueID)
+	rc, err := initRetryContainer(ctx, cpc, key, layers, configSource, uniqueID, opts)
 	return []client.Option{
 		client.WithRetryContainer(rc),
 		client.WithCloseCallbacks(func() error {
 			// cancel the configuration listener when client is closed.
-			etcdClient.DeregisterConfig(key, uniqueID)
+			configSource.DeregisterConfig(key, uniqueID)
 			return nil
 		}),
 		client.WithCloseCallbacks(rc.Close),
-	}
+	}, err
 }
 
-func initRetryContainer(key, dest string,
-	etcdClient etcd.Client, uniqueID int64,
-) *retry.Container {
+func initRetryContainer(ctx context.Context, cpc *etcd.ConfigParamConfig, key string, layers []string,
+	configSource source.ConfigSource, uniqueID int64, opts utils.Options,
+) (*retry.Container, error) {
 	retryContainer := retry.NewRetryContainerWithPercentageLimit()
 
 	ts := utils.ThreadSafeSet{}
 
-	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser) {
+	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
 		// the key is method name, wildcard "*" can match anything.
 		rcs := map[string]*retry.Policy{}
 
@@ -66,27 +74,28 @@ func initRetryContainer(key, dest string,
 			err := parser.Decode(data, &rcs)
 			if err != nil {
 				klog.Warnf("[etcd] %s client etcd retry: unmarshal data %s failed: %s, skip...", key, data, err)
-				return
+				return err
+			}
+			if err = opts.Validate(key, validation.RetryCategory, rcs); err != nil {
+				klog.Warnf("[etcd] %s client etcd retry: %s, keep the last valid config", key, err)
+				return err
 			}
 		}
 
 		set := utils.Set{}
 		for method, policy := range rcs {
 			set[method] = true
-			if policy.Enable && policy.BackupPolicy == nil && policy.FailurePolicy == nil {
-				klog.Warnf("[etcd] %s client policy for method %s BackupPolicy and FailurePolicy must not be empty at same time",
-					dest, method)
-				continue
-			}
 			retryContainer.NotifyPolicyChange(method, *policy)
 		}
 
 		for _, method := range ts.DiffAndEmplace(set) {
 			retryContainer.DeletePolicy(method)
 		}
+		return nil
 	}
 
-	etcdClient.RegisterConfigCallback(context.Background(), key, uniqueID, onChangeCallback)
+	err := configSource.RegisterConfigCallback(ctx, key, uniqueID, onChangeCallback,
+		source.WithConfigParam(cpc), source.WithLayers(layers...), source.WithListeners(opts.ConfigListeners...))
 
-	return retryContainer
+	return retryContainer, err
 }
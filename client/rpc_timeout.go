@@ -22,52 +22,67 @@ import (
 	"github.com/cloudwego/kitex/pkg/rpcinfo"
 	"github.com/cloudwego/kitex/pkg/rpctimeout"
 	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/pkg/validation"
+	"github.com/kitex-contrib/config-etcd/source"
 	"github.com/kitex-contrib/config-etcd/utils"
 )
 
 // WithRPCTimeout sets the RPC timeout policy from etcd configuration center.
-func WithRPCTimeout(dest, src string, etcdClient etcd.Client, uniqueID int64, opts utils.Options) []client.Option {
-	param, err := etcdClient.ClientConfigParam(&etcd.ConfigParamConfig{
+func WithRPCTimeout(dest, src string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) []client.Option {
+	options, _ := withRPCTimeout(context.Background(), dest, src, configSource, uniqueID, opts)
+	return options
+}
+
+func withRPCTimeout(ctx context.Context, dest, src string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) ([]client.Option, error) {
+	cpc := &etcd.ConfigParamConfig{
 		Category:          rpcTimeoutConfigName,
 		ServerServiceName: dest,
 		ClientServiceName: src,
-	})
+		Dimensions:        opts.ConfigDimensions(),
+	}
+	key, err := configSource.ClientConfigKey(cpc, opts.EtcdCustomFunctions...)
 	if err != nil {
 		panic(err)
 	}
-
-	for _, f := range opts.EtcdCustomFunctions {
-		f(&param)
+	layers, err := configSource.ClientConfigLayers(cpc, opts.EtcdCustomFunctions...)
+	if err != nil {
+		panic(err)
 	}
-	key := param.Prefix + "/" + param.Path
+	provider, err := initRPCTimeoutContainer(ctx, cpc, key, layers, configSource, uniqueID, opts)
 	return []client.Option{
-		client.WithTimeoutProvider(initRPCTimeoutContainer(key, dest, etcdClient, uniqueID)),
+		client.WithTimeoutProvider(provider),
 		client.WithCloseCallbacks(func() error {
 			// cancel the configuration listener when client is closed.
-			etcdClient.DeregisterConfig(key, uniqueID)
+			configSource.DeregisterConfig(key, uniqueID)
 			return nil
 		}),
-	}
+	}, err
 }
 
-func initRPCTimeoutContainer(key, dest string,
-	etcdClient etcd.Client, uniqueID int64,
-) rpcinfo.TimeoutProvider {
+func initRPCTimeoutContainer(ctx context.Context, cpc *etcd.ConfigParamConfig, key string, layers []string,
+	configSource source.ConfigSource, uniqueID int64, opts utils.Options,
+) (rpcinfo.TimeoutProvider, error) {
 	rpcTimeoutContainer := rpctimeout.NewContainer()
 
-	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser) {
+	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
 		configs := map[string]*rpctimeout.RPCTimeout{}
 		if !restoreDefault {
 			err := parser.Decode(data, &configs)
 			if err != nil {
 				klog.Warnf("[etcd] %s client etcd rpc timeout: unmarshal data %s failed: %s, skip...", key, data, err)
-				return
+				return err
+			}
+			if err = opts.Validate(key, validation.RPCTimeoutCategory, configs); err != nil {
+				klog.Warnf("[etcd] %s client etcd rpc timeout: %s, keep the last valid config", key, err)
+				return err
 			}
 		}
 		rpcTimeoutContainer.NotifyPolicyChange(configs)
+		return nil
 	}
 
-	etcdClient.RegisterConfigCallback(context.Background(), key, uniqueID, onChangeCallback)
+	err := configSource.RegisterConfigCallback(ctx, key, uniqueID, onChangeCallback,
+		source.WithConfigParam(cpc), source.WithLayers(layers...), source.WithListeners(opts.ConfigListeners...))
 
-	return rpcTimeoutContainer
+	return rpcTimeoutContainer, err
 }
@@ -0,0 +1,53 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/rpctimeout"
+	"github.com/cloudwego/thriftgo/pkg/test"
+	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/etcd/etcdtest"
+	"github.com/kitex-contrib/config-etcd/utils"
+)
+
+func TestRPCTimeoutCallback(t *testing.T) {
+	etcdClient, err := etcdtest.NewClient(etcd.Options{})
+	test.Assert(t, err == nil, err)
+	cpc := &etcd.ConfigParamConfig{Category: rpcTimeoutConfigName, ServerServiceName: "echo", ClientServiceName: "caller"}
+	key, err := etcdClient.ConfigKey(cpc)
+	test.Assert(t, err == nil, err)
+	etcdClient.Put(key, `{"*":{"rpc_timeout_ms":1000},"Echo":{"rpc_timeout_ms":2000}}`)
+
+	provider, err := initRPCTimeoutContainer(context.Background(), cpc, key, nil, etcdClient, 1, utils.Options{})
+	test.Assert(t, err == nil, err)
+	test.Assert(t, len(etcdClient.RegisteredKeys()) == 1 && etcdClient.Registered(key, 1), etcdClient.RegisteredKeys())
+	ri := rpcinfo.NewRPCInfo(nil, nil, rpcinfo.NewInvocation("echo", "Echo"), nil, nil)
+	test.Assert(t, provider.Timeouts(ri).RPCTimeout() == 2*time.Second)
+
+	// the negative timeout is rejected, the last valid config is kept.
+	etcdClient.Put(key, `{"Echo":{"rpc_timeout_ms":-1}}`)
+	_, err = etcdClient.Step()
+	test.Assert(t, err != nil)
+	test.Assert(t, provider.Timeouts(ri).RPCTimeout() == 2*time.Second)
+
+	etcdClient.Delete(key)
+	test.Assert(t, etcdClient.Flush() == nil)
+	test.Assert(t, provider.Timeouts(ri).RPCTimeout() == rpctimeout.CopyDefaultRPCTimeout().(*rpctimeout.RPCTimeout).RPCTimeout())
+}
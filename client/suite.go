@@ -15,8 +15,12 @@
 package client
 
 import (
+	"context"
+	"time"
+
 	"github.com/cloudwego/kitex/client"
 	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/source"
 	"github.com/kitex-contrib/config-etcd/utils"
 )
 
@@ -29,23 +33,25 @@ const (
 
 // EtcdClientSuite etcd client config suite, configure retry timeout limit and circuitbreak dynamically from etcd.
 type EtcdClientSuite struct {
-	uid        int64
-	etcdClient etcd.Client
-	service    string
-	client     string
-	opts       utils.Options
+	uid          int64
+	configSource source.ConfigSource
+	service      string
+	client       string
+	opts         utils.Options
+	// options is built when the suite is created by NewSuiteWithInitialLoad.
+	options []client.Option
 }
 
 // NewSuite service is the destination service name and client is the local identity.
-func NewSuite(service, client string, cli etcd.Client,
+func NewSuite(service, client string, cli source.ConfigSource,
 	opts ...utils.Option,
 ) *EtcdClientSuite {
 	uid := etcd.AllocateUniqueID()
 	su := &EtcdClientSuite{
-		uid:        uid,
-		service:    service,
-		client:     client,
-		etcdClient: cli,
+		uid:          uid,
+		service:      service,
+		client:       client,
+		configSource: cli,
 	}
 	for _, opt := range opts {
 		opt.Apply(&su.opts)
@@ -53,12 +59,39 @@ func NewSuite(service, client string, cli etcd.Client,
 	return su
 }
 
+// NewSuiteWithInitialLoad is like NewSuite, but it registers the configs immediately and waits,
+// at most timeout, for the first read of every config key. It returns an *source.InitialLoadError
+// listing the keys failed to load, so that the caller can fail fast. The returned suite is
+// usable even if the error is not nil, and keeps watching all the keys.
+func NewSuiteWithInitialLoad(service, client string, cli source.ConfigSource, timeout time.Duration,
+	opts ...utils.Option,
+) (*EtcdClientSuite, error) {
+	su := NewSuite(service, client, cli, opts...)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var err error
+	su.options, err = su.buildOptions(ctx)
+	return su, err
+}
+
 // Options return a list client.Option
 func (s *EtcdClientSuite) Options() []client.Option {
-	opts := make([]client.Option, 0, 7)
-	opts = append(opts, WithRetryPolicy(s.service, s.client, s.etcdClient, s.uid, s.opts)...)
-	opts = append(opts, WithRPCTimeout(s.service, s.client, s.etcdClient, s.uid, s.opts)...)
-	opts = append(opts, WithCircuitBreaker(s.service, s.client, s.etcdClient, s.uid, s.opts)...)
-	opts = append(opts, WithDegradation(s.service, s.client, s.etcdClient, s.uid, s.opts)...)
+	if s.options != nil {
+		return s.options
+	}
+	opts, _ := s.buildOptions(context.Background())
 	return opts
 }
+
+func (s *EtcdClientSuite) buildOptions(ctx context.Context) ([]client.Option, error) {
+	opts := make([]client.Option, 0, 7)
+	loadErr := &source.InitialLoadError{}
+	for _, with := range []func(context.Context, string, string, source.ConfigSource, int64, utils.Options) ([]client.Option, error){
+		withRetryPolicy, withRPCTimeout, withCircuitBreaker, withDegradation,
+	} {
+		options, err := with(ctx, s.service, s.client, s.configSource, s.uid, s.opts)
+		opts = append(opts, options...)
+		loadErr.Add(err)
+	}
+	return opts, loadErr.ErrorOrNil()
+}
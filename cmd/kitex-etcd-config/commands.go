@@ -0,0 +1,564 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+var errDifferent = errors.New("the configs are different")
+
+func runGet(ctx context.Context, o *options, args []string) error {
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	if ok, err := printRollout(ctx, o, cpc); ok || err != nil {
+		return err
+	}
+	if ok, err := printSchedule(ctx, o, cpc); ok || err != nil {
+		return err
+	}
+	data, revision, err := getEncoded(ctx, o, cpc)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "# revision %d\n", revision)
+	fmt.Print(data)
+	return nil
+}
+
+// printRollout prints the stable and the candidate configs if the config is in the rollout
+// envelope, and returns whether it is.
+func printRollout(ctx context.Context, o *options, cpc *etcd.ConfigParamConfig) (bool, error) {
+	key, err := o.cli.ConfigKey(cpc)
+	if err != nil {
+		return false, err
+	}
+	v, err := o.cli.GetValue(ctx, key)
+	if err != nil {
+		return false, nil
+	}
+	signed := source.Unsign(v.Value)
+	if o.etcd.TrustedKeys != nil {
+		if signed, err = source.Verify(o.etcd.TrustedKeys, key, v.Value); err != nil {
+			return false, err
+		}
+	}
+	if !source.IsRollout(signed) {
+		return false, nil
+	}
+	rollout, err := source.ParseRollout(signed)
+	if err != nil {
+		return true, err
+	}
+	fmt.Fprintf(os.Stderr, "# revision %d, canary rollout to %.2f%% instances %v tags %v\n", v.ModRevision,
+		rollout.Rollout.Percent, rollout.Rollout.Instances, rollout.Rollout.Tags)
+	fmt.Println("# stable")
+	fmt.Print(o.versionText(key, cpc, etcd.ConfigVersion{Value: rollout.Stable}))
+	fmt.Println("# candidate")
+	fmt.Print(o.versionText(key, cpc, etcd.ConfigVersion{Value: rollout.Candidate}))
+	return true, nil
+}
+
+// printSchedule prints the default config and the variants with their windows if the config
+// is in the schedule envelope, and returns whether it is.
+func printSchedule(ctx context.Context, o *options, cpc *etcd.ConfigParamConfig) (bool, error) {
+	key, err := o.cli.ConfigKey(cpc)
+	if err != nil {
+		return false, err
+	}
+	v, err := o.cli.GetValue(ctx, key)
+	if err != nil {
+		return false, nil
+	}
+	signed := source.Unsign(v.Value)
+	if o.etcd.TrustedKeys != nil {
+		if signed, err = source.Verify(o.etcd.TrustedKeys, key, v.Value); err != nil {
+			return false, err
+		}
+	}
+	if !source.IsScheduled(signed) {
+		return false, nil
+	}
+	schedule, err := source.ParseSchedule(signed)
+	if err != nil {
+		return true, err
+	}
+	fmt.Fprintf(os.Stderr, "# revision %d, scheduled with %d variants\n", v.ModRevision, len(schedule.Variants))
+	fmt.Println("# default")
+	fmt.Print(o.versionText(key, cpc, etcd.ConfigVersion{Value: schedule.Default}))
+	for _, variant := range schedule.Variants {
+		fmt.Printf("# from %s to %s\n", windowTime(variant.From), windowTime(variant.To))
+		fmt.Print(o.versionText(key, cpc, etcd.ConfigVersion{Value: variant.Value}))
+	}
+	return true, nil
+}
+
+// windowTime formats the boundary of a window, the zero time is unbounded.
+func windowTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func runSet(ctx context.Context, o *options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: set [flags] <file>")
+	}
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	data, parser, err := readFile(args[0], o.format)
+	if err != nil {
+		return err
+	}
+	config, err := decode(cpc.Category, data, parser)
+	if err != nil {
+		return err
+	}
+	if err = printKey(o, cpc); err != nil {
+		return err
+	}
+	revision, err := o.cli.PutConfig(ctx, cpc, config, o.writeOptions()...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("written at revision %d\n", revision)
+	return nil
+}
+
+func runEdit(ctx context.Context, o *options, args []string) error {
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	// the rollout and the schedule envelopes are not edited, since the config decoded from them is
+	// the variant selected for this process, which would be written back as the plain config.
+	envelope, revision, err := envelopeOf(ctx, o, cpc)
+	if err != nil {
+		return err
+	}
+	if envelope != "" {
+		return fmt.Errorf("the config is in the %s envelope which can not be edited, write it by set instead", envelope)
+	}
+	data, _, err := getEncoded(ctx, o, cpc)
+	if errors.Is(err, source.ErrConfigNotFound) {
+		data = ""
+	} else if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "kitex-etcd-config-*."+o.format)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command(editor, f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("run editor %s failed: %w", editor, err)
+	}
+	edited, parser, err := readFile(f.Name(), o.format)
+	if err != nil {
+		return err
+	}
+	if edited == data {
+		fmt.Println("no changes")
+		return nil
+	}
+	config, err := decode(cpc.Category, edited, parser)
+	if err != nil {
+		return err
+	}
+	if err = printKey(o, cpc); err != nil {
+		return err
+	}
+	// fail if the config is modified by others while editing.
+	o.revision = revision
+	revision, err = o.cli.PutConfig(ctx, cpc, config, o.writeOptions()...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("written at revision %d\n", revision)
+	return nil
+}
+
+func runDelete(ctx context.Context, o *options, args []string) error {
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	if err = printKey(o, cpc); err != nil {
+		return err
+	}
+	return o.cli.DeleteConfig(ctx, cpc, o.writeOptions()...)
+}
+
+// printKey prints the key of cpc to stderr before it is written, since it depends on the
+// dimensions of the environment variables as well as the flags.
+func printKey(o *options, cpc *etcd.ConfigParamConfig) error {
+	key, err := o.cli.ConfigKey(cpc)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "# key %s\n", key)
+	return nil
+}
+
+func runList(ctx context.Context, o *options, args []string) error {
+	values, err := o.cli.ListConfigs(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if o.category != "" && !strings.HasSuffix(v.Key, "/"+o.category) {
+			continue
+		}
+		fmt.Printf("%d\t%s\n", v.ModRevision, v.Key)
+	}
+	return nil
+}
+
+func runDiff(ctx context.Context, o *options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: diff [flags] <file>")
+	}
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	data, parser, err := readFile(args[0], o.format)
+	if err != nil {
+		return err
+	}
+	local, err := decode(cpc.Category, data, parser)
+	if err != nil {
+		return err
+	}
+	remote := categories[cpc.Category]()
+	_, err = o.cli.GetConfig(ctx, cpc, remote.ptr)
+	if err != nil && !errors.Is(err, source.ErrConfigNotFound) {
+		return err
+	}
+	before, err := canonical(remote.value())
+	if err != nil {
+		return err
+	}
+	after, err := canonical(local)
+	if err != nil {
+		return err
+	}
+	if before == after {
+		return nil
+	}
+	key, _ := o.cli.ConfigKey(cpc)
+	fmt.Printf("--- %s\n+++ %s\n", key, args[0])
+	fmt.Print(diffLines(before, after))
+	return errDifferent
+}
+
+func runHistory(ctx context.Context, o *options, args []string) error {
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	key, err := o.cli.ConfigKey(cpc)
+	if err != nil {
+		return err
+	}
+	versions, err := o.cli.History(ctx, cpc)
+	if err != nil {
+		return err
+	}
+	// print from the newest, each with the diff from the version before it.
+	for i, v := range versions {
+		fmt.Printf("# revision %d", v.Revision)
+		if !v.Time.IsZero() {
+			fmt.Printf(" at %s", v.Time.Format(time.RFC3339))
+		}
+		if v.Deleted {
+			fmt.Print(" deleted")
+		}
+		if v.Rollback != 0 {
+			fmt.Printf(" rollback to %d", v.Rollback)
+		}
+		fmt.Println()
+		before := ""
+		if i+1 < len(versions) {
+			before = o.versionText(key, cpc, versions[i+1])
+		}
+		if after := o.versionText(key, cpc, v); after != before {
+			fmt.Print(diffLines(before, after))
+		}
+	}
+	return nil
+}
+
+func runRollback(ctx context.Context, o *options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: rollback [flags] <revision>")
+	}
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	to, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid revision %q", args[0])
+	}
+	if err = printKey(o, cpc); err != nil {
+		return err
+	}
+	revision, err := o.cli.Rollback(ctx, cpc, to, o.writeOptions()...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rolled back to revision %d at revision %d\n", to, revision)
+	return nil
+}
+
+func runOverride(ctx context.Context, o *options, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: override [flags] [file]")
+	}
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	if o.deleteOverride {
+		if err = printKey(o, cpc); err != nil {
+			return err
+		}
+		if err = o.cli.DeleteOverride(ctx, cpc, o.writeOptions()...); err != nil {
+			return err
+		}
+		fmt.Println("override deleted")
+		return nil
+	}
+	if len(args) == 0 {
+		override, err := o.cli.GetOverride(ctx, cpc)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "# revision %d, expires in %s\n", override.ModRevision, override.TTL)
+		key, err := o.cli.ConfigKey(cpc)
+		if err != nil {
+			return err
+		}
+		fmt.Print(o.versionText(etcd.OverrideKey(key), cpc, etcd.ConfigVersion{Value: override.Value}))
+		return nil
+	}
+	data, parser, err := readFile(args[0], o.format)
+	if err != nil {
+		return err
+	}
+	config, err := decode(cpc.Category, data, parser)
+	if err != nil {
+		return err
+	}
+	if err = printKey(o, cpc); err != nil {
+		return err
+	}
+	revision, err := o.cli.PutOverride(ctx, cpc, config, o.ttl, o.writeOptions()...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("override written at revision %d, expires in %s\n", revision, o.ttl)
+	return nil
+}
+
+func runStatus(ctx context.Context, o *options, args []string) error {
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	status, err := o.cli.Status(ctx, cpc)
+	if err != nil {
+		return err
+	}
+	lagging, failing := status.Lagging(), status.Failing()
+	fmt.Printf("# %s at revision %d: %d instances, %d applied, %d lagging, %d failing\n", status.Key, status.Revision,
+		len(status.Instances), len(status.Applied()), len(lagging), len(failing))
+	for _, is := range lagging {
+		fmt.Printf("lagging %s: revision %d%s\n", is.Instance, is.Revision, appliedAt(is))
+	}
+	for _, is := range failing {
+		fmt.Printf("failing %s: revision %d%s, rejected revision %d: %s\n", is.Instance, is.Revision, appliedAt(is),
+			is.ErrorRevision, is.Error)
+	}
+	return nil
+}
+
+// appliedAt describes when the status is applied, empty if it is unknown.
+func appliedAt(is etcd.InstanceStatus) string {
+	if is.AppliedAt.IsZero() {
+		return ""
+	}
+	s := " applied at " + is.AppliedAt.Format(time.RFC3339)
+	if is.FromSnapshot {
+		s += " from snapshot"
+	}
+	return s
+}
+
+func runValidate(ctx context.Context, o *options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: validate -category <category> <file>")
+	}
+	data, parser, err := readFile(args[0], o.format)
+	if err != nil {
+		return err
+	}
+	if _, err = decode(o.category, data, parser); err != nil {
+		return err
+	}
+	fmt.Println("ok")
+	return nil
+}
+
+func runWatch(ctx context.Context, o *options, args []string) error {
+	cpc, err := o.param()
+	if err != nil {
+		return err
+	}
+	key, err := o.cli.ConfigKey(cpc)
+	if err != nil {
+		return err
+	}
+	callback := func(restoreDefault bool, data string, parser etcd.ConfigParser, meta source.ConfigMeta) error {
+		if restoreDefault {
+			fmt.Printf("# %s deleted\n", key)
+			return nil
+		}
+		plain, err := o.plain(key, data)
+		if err != nil {
+			fmt.Printf("# %s revision %d: %v\n%s\n", key, meta.Revision, err, data)
+			return nil
+		}
+		fmt.Printf("# %s revision %d\n%s\n", key, meta.Revision, plain)
+		return nil
+	}
+	uniqueID := etcd.AllocateUniqueID()
+	if err = o.cli.RegisterConfigCallback(ctx, key, uniqueID, callback, source.WithConfigParam(cpc)); err != nil {
+		return err
+	}
+	defer o.cli.DeregisterConfig(key, uniqueID)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	return nil
+}
+
+// getEncoded reads the config of cpc and encodes it in the format of the flags.
+func getEncoded(ctx context.Context, o *options, cpc *etcd.ConfigParamConfig) (string, int64, error) {
+	c := categories[cpc.Category]()
+	revision, err := o.cli.GetConfig(ctx, cpc, c.ptr)
+	if err != nil {
+		return "", 0, err
+	}
+	parser, err := parserOf(o.format)
+	if err != nil {
+		return "", 0, err
+	}
+	data, err := parser.(source.ConfigEncoder).Encode(c.value())
+	return data, revision, err
+}
+
+// envelopeOf returns "rollout" or "schedule" if the config is in the rollout or the schedule
+// envelope, and the ModRevision of the config, zero if it does not exist.
+func envelopeOf(ctx context.Context, o *options, cpc *etcd.ConfigParamConfig) (string, int64, error) {
+	key, err := o.cli.ConfigKey(cpc)
+	if err != nil {
+		return "", 0, err
+	}
+	v, err := o.cli.GetValue(ctx, key)
+	if errors.Is(err, source.ErrConfigNotFound) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	switch signed := source.Unsign(v.Value); {
+	case source.IsRollout(signed):
+		return "rollout", v.ModRevision, nil
+	case source.IsScheduled(signed):
+		return "schedule", v.ModRevision, nil
+	}
+	return "", v.ModRevision, nil
+}
+
+// versionText returns the config of the version of key in the canonical form to diff, or the plain
+// value if it can not be decoded, empty if it is deleted.
+func (o *options) versionText(key string, cpc *etcd.ConfigParamConfig, v etcd.ConfigVersion) string {
+	if v.Deleted {
+		return ""
+	}
+	plain, err := o.plain(key, v.Value)
+	if err != nil {
+		return v.Value + "\n"
+	}
+	parser, _ := parserOf(o.format)
+	c := categories[cpc.Category]()
+	if err = parser.Decode(plain, c.ptr); err != nil {
+		return plain + "\n"
+	}
+	text, err := canonical(c.value())
+	if err != nil {
+		return plain + "\n"
+	}
+	return text
+}
+
+// plain returns the value of key in the signature, the encrypted and the compressed envelopes
+// for display, the signature is verified if -trusted-keys is set.
+func (o *options) plain(key, data string) (string, error) {
+	signed := source.Unsign(data)
+	if o.etcd.TrustedKeys != nil {
+		var err error
+		if signed, err = source.Verify(o.etcd.TrustedKeys, key, data); err != nil {
+			return "", err
+		}
+	}
+	plain, err := source.Decrypt(o.etcd.KeyProvider, key, signed)
+	if err != nil {
+		return "", err
+	}
+	return source.Decompress(plain, o.etcd.MaxDecompressedSize)
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+
+	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/etcd/etcdtest"
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+func TestEditEnvelope(t *testing.T) {
+	cli, err := etcdtest.NewClient(etcd.Options{})
+	test.Assert(t, err == nil, err)
+	o := &options{category: "limit", server: "s", format: "json", cli: cli}
+	ctx := context.Background()
+	cpc, _ := o.param()
+	envelope, revision, err := envelopeOf(ctx, o, cpc)
+	test.Assert(t, err == nil && envelope == "" && revision == 0, envelope, revision, err)
+
+	cli.Put("/KitexConfig/s/limit", `{"qps_limit":100}`)
+	envelope, revision, err = envelopeOf(ctx, o, cpc)
+	test.Assert(t, err == nil && envelope == "" && revision != 0, envelope, revision, err)
+
+	// the rollout envelope is not edited as the selected value.
+	v := &source.RolloutValue{Rollout: source.Rollout{Percent: 10}, Stable: `{"qps_limit":100}`, Candidate: `{"qps_limit":200}`}
+	cli.Put("/KitexConfig/s/limit", v.String())
+	envelope, _, err = envelopeOf(ctx, o, cpc)
+	test.Assert(t, err == nil && envelope == "rollout", envelope, err)
+	test.Assert(t, runEdit(ctx, o, nil) != nil)
+
+	s := &source.ScheduledValue{Default: `{"qps_limit":100}`}
+	cli.Put("/KitexConfig/s/limit", s.String())
+	envelope, _, err = envelopeOf(ctx, o, cpc)
+	test.Assert(t, err == nil && envelope == "schedule", envelope, err)
+}
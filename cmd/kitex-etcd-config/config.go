@@ -0,0 +1,128 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudwego/kitex/pkg/circuitbreak"
+	"github.com/cloudwego/kitex/pkg/limiter"
+	"github.com/cloudwego/kitex/pkg/retry"
+	"github.com/cloudwego/kitex/pkg/rpctimeout"
+
+	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/pkg/degradation"
+	"github.com/kitex-contrib/config-etcd/pkg/validation"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+// typedConfig holds the decoded config of a category.
+type typedConfig struct {
+	// ptr is decoded into.
+	ptr interface{}
+	// value returns the config in the type expected by the validators.
+	value func() interface{}
+}
+
+// categories creates the configs of the categories in the same types decoded by the suites.
+var categories = map[string]func() typedConfig{
+	validation.RetryCategory: func() typedConfig {
+		c := map[string]*retry.Policy{}
+		return typedConfig{&c, func() interface{} { return c }}
+	},
+	validation.RPCTimeoutCategory: func() typedConfig {
+		c := map[string]*rpctimeout.RPCTimeout{}
+		return typedConfig{&c, func() interface{} { return c }}
+	},
+	validation.CircuitBreakerCategory: func() typedConfig {
+		c := map[string]circuitbreak.CBConfig{}
+		return typedConfig{&c, func() interface{} { return c }}
+	},
+	validation.DegradationCategory: func() typedConfig {
+		c := &degradation.Config{}
+		return typedConfig{c, func() interface{} { return c }}
+	},
+	validation.LimiterCategory: func() typedConfig {
+		c := &limiter.LimiterConfig{}
+		return typedConfig{c, func() interface{} { return c }}
+	},
+}
+
+func parserOf(format string) (etcd.ConfigParser, error) {
+	switch format {
+	case "json":
+		return source.NewStrictJSONParser(), nil
+	case "yaml", "yml":
+		return source.NewYAMLParser(), nil
+	case "toml":
+		return source.NewTOMLParser(), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, must be one of json, yaml and toml", format)
+	}
+}
+
+// decode decodes and validates the config of category in data.
+func decode(category string, data string, parser etcd.ConfigParser) (interface{}, error) {
+	newConfig, ok := categories[category]
+	if !ok {
+		return nil, fmt.Errorf("unknown category %q", category)
+	}
+	c := newConfig()
+	if err := parser.Decode(data, c.ptr); err != nil {
+		return nil, err
+	}
+	config := c.value()
+	if err := validation.Validate(category, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readFile reads the config file, or stdin if path is "-". The format is detected by the
+// extension of the file, or defaultFormat if it is unknown.
+func readFile(path, defaultFormat string) (string, etcd.ConfigParser, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	format := defaultFormat
+	if ext := filepath.Ext(path); ext != "" {
+		if _, err := parserOf(ext[1:]); err == nil {
+			format = ext[1:]
+		}
+	}
+	parser, err := parserOf(format)
+	return string(data), parser, err
+}
+
+// canonical encodes config in indented json, so that the configs in different formats can be compared.
+func canonical(config interface{}) (string, error) {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+func TestDiffLines(t *testing.T) {
+	before := "{\n  \"qps_limit\": 100,\n  \"connection_limit\": 10\n}\n"
+	after := "{\n  \"qps_limit\": 200,\n  \"connection_limit\": 10\n}\n"
+	want := " {\n-  \"qps_limit\": 100,\n+  \"qps_limit\": 200,\n   \"connection_limit\": 10\n }\n"
+	test.Assert(t, diffLines(before, after) == want, diffLines(before, after))
+	test.Assert(t, diffLines("", "a\n") == "+a\n", diffLines("", "a\n"))
+}
+
+func TestDecode(t *testing.T) {
+	parser, _ := parserOf("yaml")
+	_, err := decode("limit", "qps_limit: 100\nconnection_limit: 10\n", parser)
+	test.Assert(t, err == nil, err)
+	_, err = decode("limit", "qps_limit: -1\n", parser)
+	test.Assert(t, err != nil)
+	_, err = decode("degradation", `{"enable": true, "percentage": 101}`, parser)
+	test.Assert(t, err != nil)
+}
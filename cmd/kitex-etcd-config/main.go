@@ -0,0 +1,445 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command kitex-etcd-config manages the Kitex governance configs in etcd.
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/pkg/validation"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+const usage = `Usage: kitex-etcd-config <command> [flags] [args]
+
+Commands:
+  get       print the config
+  set       write the config from a file, or stdin if the file is "-"
+  edit      edit the config with $EDITOR
+  delete    delete the config
+  list      list the configs under the prefix
+  diff      compare the config with a local file
+  validate  validate a local config file
+  watch     print the config whenever it changes
+  history   list the versions of the config with the diffs
+  rollback  write the version of the config at a revision as a new version
+  override  write a temporary override of the config from a file for -ttl, print it if no file is given
+  status    summarise the rollout of the config and list the lagging or failing instances
+
+The config is identified by -category, -server and -client, the server config is
+used if -client is empty, and the dimensions -env, -region, -idc, -cluster and -instance,
+which default to the KITEX_CONFIG_* environment variables unless -no-env-dimensions is set.
+The commands writing the config print its key to stderr first. The etcd password of -user is
+read from $KITEX_ETCD_PASSWORD, or prompted if it is not set.
+Run "kitex-etcd-config <command> -h" for the flags.
+`
+
+// passwordEnv is the environment variable of the etcd password, which is not a flag so that it
+// is not leaked by the shell history and the process list.
+const passwordEnv = "KITEX_ETCD_PASSWORD"
+
+type command struct {
+	run func(ctx context.Context, o *options, args []string) error
+	// offline is true if the command does not connect to etcd.
+	offline bool
+}
+
+var commands = map[string]command{
+	"get":      {run: runGet},
+	"set":      {run: runSet},
+	"edit":     {run: runEdit},
+	"delete":   {run: runDelete},
+	"list":     {run: runList},
+	"diff":     {run: runDiff},
+	"validate": {run: runValidate, offline: true},
+	"watch":    {run: runWatch},
+	"history":  {run: runHistory},
+	"rollback": {run: runRollback},
+	"override": {run: runOverride},
+	"status":   {run: runStatus},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command of args and returns the exit code, so that the client is closed before
+// the process exits.
+func run(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	o := &options{}
+	fs := o.flagSet(args[0])
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if err := o.check(cmd.offline); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if !cmd.offline {
+		cli, err := o.newClient()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer cli.Close()
+		o.cli = cli
+	}
+	if err := cmd.run(context.Background(), o, fs.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// options are the flags shared by the commands.
+type options struct {
+	endpoints  string
+	prefix     string
+	serverPath string
+	clientPath string
+	format     string
+	timeout    time.Duration
+	caFile     string
+	certFile   string
+	keyFile    string
+	username   string
+	// encryptionKeyFile and encryptionKeyEnv are the sources of the encryption key of encryptionKeyID.
+	encryptionKeyFile string
+	encryptionKeyEnv  string
+	encryptionKeyID   string
+	encrypt           bool
+	// signingKeyFile signs the written configs with the key of signingKeyID, and trustedKeys
+	// are the public keys to verify the read configs, in "id=base64,..." format.
+	signingKeyFile string
+	signingKeyID   string
+	trustedKeys    string
+	signingKey     *source.SigningKey
+	compress       string
+	chunkSize      int
+	historyPrefix  string
+	statusPrefix   string
+	// ttl is the ttl of the override, and deleteOverride deletes it before it expires.
+	ttl            time.Duration
+	deleteOverride bool
+	// canaryPercent, canaryInstances and canaryTags write the config as the candidate of a
+	// canary rollout if any of them is set.
+	canaryPercent   float64
+	canaryInstances string
+	canaryTags      string
+	canarySeed      string
+	// variants are the scheduled variants in "from,to,file" format, which are loaded to configVariants.
+	variants       []string
+	configVariants []etcd.ConfigVariant
+
+	category string
+	server   string
+	client   string
+	// dimensions are the dimensions of the config key set by the flags.
+	dimensions source.Dimensions
+	// noEnvDimensions ignores the dimensions of the KITEX_CONFIG_* environment variables.
+	noEnvDimensions bool
+	revision        int64
+
+	etcd etcd.Options
+	// cli is nil for the offline commands.
+	cli etcd.Client
+}
+
+func (o *options) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&o.endpoints, "endpoints", etcd.EtcdDefaultNode, "comma separated etcd endpoints")
+	fs.StringVar(&o.prefix, "prefix", etcd.EtcdDefaultConfigPrefix, "config key prefix template")
+	fs.StringVar(&o.serverPath, "server-path", "", "server config path template, default "+etcd.EtcdDefaultServerPath)
+	fs.StringVar(&o.clientPath, "client-path", "", "client config path template, default "+etcd.EtcdDefaultClientPath)
+	fs.StringVar(&o.format, "format", "json", "config format in etcd: json, yaml or toml")
+	fs.DurationVar(&o.timeout, "timeout", etcd.EtcdDefaultTimeout, "etcd request timeout")
+	fs.StringVar(&o.caFile, "ca", "", "CA file to verify etcd")
+	fs.StringVar(&o.certFile, "cert", "", "client certificate file for mTLS")
+	fs.StringVar(&o.keyFile, "key", "", "client key file for mTLS")
+	fs.StringVar(&o.username, "user", "", "etcd username")
+	fs.StringVar(&o.encryptionKeyFile, "encryption-key-file", "", "file of the key to encrypt and decrypt the configs")
+	fs.StringVar(&o.encryptionKeyEnv, "encryption-key-env", "", "environment variable of the key in base64 to encrypt and decrypt the configs")
+	fs.StringVar(&o.encryptionKeyID, "encryption-key-id", "default", "id of the encryption key")
+	fs.BoolVar(&o.encrypt, "encrypt", false, "write the config encrypted")
+	fs.StringVar(&o.signingKeyFile, "signing-key-file", "", "file of the ed25519 key to sign the written configs")
+	fs.StringVar(&o.signingKeyID, "signing-key-id", "default", "id of the signing key")
+	fs.StringVar(&o.compress, "compress", "", "write the config compressed: "+source.CompressorGzip+", "+source.CompressorZstd)
+	fs.IntVar(&o.chunkSize, "chunk-size", etcd.DefaultChunkSize, "max size of the config written without chunking")
+	fs.Float64Var(&o.canaryPercent, "canary-percent", 0, "write the config as the candidate to the percentage of the instances")
+	fs.StringVar(&o.canaryInstances, "canary-instances", "", "write the config as the candidate to the comma separated instance ids")
+	fs.StringVar(&o.canaryTags, "canary-tags", "", "write the config as the candidate to the instances with any of the comma separated tags")
+	fs.StringVar(&o.canarySeed, "canary-seed", "", "seed of the instances selected by -canary-percent")
+	fs.Func("variant", "write the config in the file as the variant applying in the window, in from,to,file format "+
+		"with the RFC3339 times, which may be empty for the unbounded window, repeat it for more variants", func(s string) error {
+		o.variants = append(o.variants, s)
+		return nil
+	})
+	fs.StringVar(&o.historyPrefix, "history-prefix", "", "prefix of the history records, etcd.DefaultHistoryPrefix if empty")
+	fs.StringVar(&o.statusPrefix, "status-prefix", "", "prefix of the status keys, etcd.DefaultStatusPrefix if empty")
+	if name == "override" {
+		fs.DurationVar(&o.ttl, "ttl", 30*time.Minute, "ttl of the override, it is deleted when the ttl elapses")
+		fs.BoolVar(&o.deleteOverride, "delete", false, "delete the override before it expires")
+	}
+	fs.StringVar(&o.trustedKeys, "trusted-keys", "", "comma separated id=base64 ed25519 public keys to verify the configs")
+	fs.StringVar(&o.category, "category", "", "config category: "+strings.Join(categoryNames(), ", "))
+	fs.StringVar(&o.server, "server", "", "server service name")
+	fs.StringVar(&o.client, "client", "", "client service name, empty for the server config")
+	fs.StringVar(&o.dimensions.Env, "env", "", "env dimension of the config, default $"+source.EnvConfigEnv)
+	fs.StringVar(&o.dimensions.Region, "region", "", "region dimension of the config, default $"+source.EnvConfigRegion)
+	fs.StringVar(&o.dimensions.IDC, "idc", "", "idc dimension of the config, default $"+source.EnvConfigIDC)
+	fs.StringVar(&o.dimensions.Cluster, "cluster", "", "cluster dimension of the config, default $"+source.EnvConfigCluster)
+	fs.StringVar(&o.dimensions.InstanceID, "instance", "", "instance dimension of the config, default $"+source.EnvConfigInstanceID)
+	fs.BoolVar(&o.noEnvDimensions, "no-env-dimensions", false, "ignore the dimensions of the $KITEX_CONFIG_* environment variables, "+
+		"only the ones of the flags are used")
+	fs.Int64Var(&o.revision, "revision", -1, "write only if the config is at the revision, 0 if it must not exist")
+	return fs
+}
+
+// check checks the flags required by the commands.
+func (o *options) check(offline bool) error {
+	if _, err := parserOf(o.format); err != nil {
+		return err
+	}
+	if offline {
+		return nil
+	}
+	keyProvider, err := o.keyProvider()
+	if err != nil {
+		return err
+	}
+	if o.encrypt && keyProvider == nil {
+		return errors.New("-encrypt requires -encryption-key-file or -encryption-key-env")
+	}
+	trustedKeys, err := parseTrustedKeys(o.trustedKeys)
+	if err != nil {
+		return err
+	}
+	if o.signingKeyFile != "" {
+		if o.signingKey, err = source.NewFileSigningKey(o.signingKeyID, o.signingKeyFile); err != nil {
+			return err
+		}
+	}
+	for _, v := range o.variants {
+		variant, err := parseVariant(o.category, o.format, v)
+		if err != nil {
+			return err
+		}
+		o.configVariants = append(o.configVariants, variant)
+	}
+	password, err := o.password()
+	if err != nil {
+		return err
+	}
+	o.etcd = etcd.Options{
+		Node:             strings.Split(o.endpoints, ","),
+		Prefix:           o.prefix,
+		ServerPathFormat: o.serverPath,
+		ClientPathFormat: o.clientPath,
+		Timeout:          o.timeout,
+		CAFile:           o.caFile,
+		CertFile:         o.certFile,
+		KeyFile:          o.keyFile,
+		Username:         o.username,
+		Password:         password,
+		DialTimeout:      o.timeout,
+		KeyProvider:      keyProvider,
+		TrustedKeys:      trustedKeys,
+		HistoryPrefix:    o.historyPrefix,
+		StatusPrefix:     o.statusPrefix,
+		SchemaValidator:  validation.Validate,
+	}
+	return nil
+}
+
+// parseTrustedKeys parses the public keys in "id=base64,..." format, nil if s is empty.
+func parseTrustedKeys(s string) (map[string]ed25519.PublicKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	keys := make(map[string]ed25519.PublicKey)
+	for _, kv := range strings.Split(s, ",") {
+		id, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid trusted key %q, must be id=base64", kv)
+		}
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key of %q", id)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// keyProvider returns the provider of the encryption key of the flags, nil if it is not set.
+func (o *options) keyProvider() (source.KeyProvider, error) {
+	switch {
+	case o.encryptionKeyFile != "" && o.encryptionKeyEnv != "":
+		return nil, errors.New("-encryption-key-file and -encryption-key-env are exclusive")
+	case o.encryptionKeyFile != "":
+		return source.NewFileKeyProvider(o.encryptionKeyID, o.encryptionKeyFile)
+	case o.encryptionKeyEnv != "":
+		return source.NewEnvKeyProvider(o.encryptionKeyID, o.encryptionKeyEnv)
+	}
+	return nil, nil
+}
+
+func (o *options) newClient() (etcd.Client, error) {
+	o.etcd.ConfigParser, _ = parserOf(o.format)
+	return etcd.NewClient(o.etcd)
+}
+
+// param returns the config parameters of the flags.
+func (o *options) param() (*etcd.ConfigParamConfig, error) {
+	if _, ok := categories[o.category]; !ok {
+		return nil, fmt.Errorf("unknown category %q, must be one of %s", o.category, strings.Join(categoryNames(), ", "))
+	}
+	if o.server == "" {
+		return nil, fmt.Errorf("-server is required")
+	}
+	dimensions := o.dimensions
+	if !o.noEnvDimensions {
+		dimensions = source.DimensionsFromEnv().Merge(o.dimensions)
+	}
+	return &etcd.ConfigParamConfig{
+		Category:          o.category,
+		ServerServiceName: o.server,
+		ClientServiceName: o.client,
+		Dimensions:        dimensions,
+	}, nil
+}
+
+// password returns the etcd password of -user from $KITEX_ETCD_PASSWORD, or prompts for it if
+// stdin is a terminal.
+func (o *options) password() (string, error) {
+	if o.username == "" {
+		return "", nil
+	}
+	if password, ok := os.LookupEnv(passwordEnv); ok {
+		return password, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("-user requires $%s when stdin is not a terminal", passwordEnv)
+	}
+	fmt.Fprintf(os.Stderr, "etcd password of %s: ", o.username)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+// writeOptions returns the compare-and-swap option if -revision is set, the encryption
+// option if -encrypt is set, the signing option if -signing-key-file is set, the variant
+// options of -variant, the rollout option if the canary flags are set, and the validation,
+// the compression and the chunking options.
+func (o *options) writeOptions() []etcd.WriteOption {
+	opts := []etcd.WriteOption{etcd.WithValidation(), etcd.WithChunkSize(o.chunkSize)}
+	if o.compress != "" {
+		opts = append(opts, etcd.WithCompression(o.compress))
+	}
+	if o.revision >= 0 {
+		opts = append(opts, etcd.WithModRevision(o.revision))
+	}
+	if o.encrypt {
+		opts = append(opts, etcd.WithEncryption())
+	}
+	if o.signingKey != nil {
+		opts = append(opts, etcd.WithSigningKey(o.signingKey))
+	}
+	for _, v := range o.configVariants {
+		opts = append(opts, etcd.WithVariant(v.Window, v.Config))
+	}
+	if o.canaryPercent > 0 || o.canaryInstances != "" || o.canaryTags != "" {
+		opts = append(opts, etcd.WithRollout(source.Rollout{
+			Percent:   o.canaryPercent,
+			Instances: splitList(o.canaryInstances),
+			Tags:      splitList(o.canaryTags),
+			Seed:      o.canarySeed,
+		}))
+	}
+	return opts
+}
+
+// parseVariant parses the scheduled variant of category in "from,to,file" format.
+func parseVariant(category, format, s string) (etcd.ConfigVariant, error) {
+	parts := strings.SplitN(s, ",", 3)
+	if len(parts) != 3 {
+		return etcd.ConfigVariant{}, fmt.Errorf("invalid variant %q, must be from,to,file", s)
+	}
+	var window source.Window
+	for i, t := range []*time.Time{&window.From, &window.To} {
+		if parts[i] == "" {
+			continue
+		}
+		var err error
+		if *t, err = time.Parse(time.RFC3339, parts[i]); err != nil {
+			return etcd.ConfigVariant{}, fmt.Errorf("invalid time of variant %q: %w", s, err)
+		}
+	}
+	if err := source.CheckWindow(window); err != nil {
+		return etcd.ConfigVariant{}, err
+	}
+	data, parser, err := readFile(parts[2], format)
+	if err != nil {
+		return etcd.ConfigVariant{}, err
+	}
+	config, err := decode(category, data, parser)
+	if err != nil {
+		return etcd.ConfigVariant{}, fmt.Errorf("variant %s: %w", parts[2], err)
+	}
+	return etcd.ConfigVariant{Window: window, Config: config}, nil
+}
+
+// splitList splits the comma separated list, nil if s is empty.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func categoryNames() []string {
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+func TestRun(t *testing.T) {
+	test.Assert(t, run(nil) == 2)
+	test.Assert(t, run([]string{"unknown"}) == 2)
+
+	path := filepath.Join(t.TempDir(), "limit.json")
+	test.Assert(t, os.WriteFile(path, []byte(`{"qps_limit":100}`), 0o600) == nil)
+	test.Assert(t, run([]string{"validate", "-category", "limit", path}) == 0)
+	test.Assert(t, os.WriteFile(path, []byte(`{"qps_limit":-1}`), 0o600) == nil)
+	test.Assert(t, run([]string{"validate", "-category", "limit", path}) == 1)
+}
+
+func TestParamDimensions(t *testing.T) {
+	t.Setenv(source.EnvConfigEnv, "prod")
+	t.Setenv(source.EnvConfigRegion, "us")
+	o := &options{}
+	fs := o.flagSet("get")
+	test.Assert(t, fs.Parse([]string{"-category", "limit", "-server", "s", "-region", "eu", "-cluster", "c1"}) == nil)
+	cpc, err := o.param()
+	test.Assert(t, err == nil, err)
+	test.Assert(t, cpc.Env == "prod" && cpc.Region == "eu" && cpc.Cluster == "c1", cpc.Dimensions)
+
+	o = &options{}
+	fs = o.flagSet("get")
+	test.Assert(t, fs.Parse([]string{"-category", "limit", "-server", "s", "-no-env-dimensions", "-cluster", "c1"}) == nil)
+	cpc, err = o.param()
+	test.Assert(t, err == nil, err)
+	test.Assert(t, cpc.Env == "" && cpc.Region == "" && cpc.Cluster == "c1", cpc.Dimensions)
+}
+
+func TestPassword(t *testing.T) {
+	o := &options{}
+	password, err := o.password()
+	test.Assert(t, err == nil && password == "", password, err)
+
+	o.username = "root"
+	t.Setenv(passwordEnv, "secret")
+	password, err = o.password()
+	test.Assert(t, err == nil && password == "secret", password, err)
+}
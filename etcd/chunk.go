@@ -0,0 +1,191 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// ChunkedPrefix is the prefix of the manifest of a chunked config value, which is
+	// "chunked:v1:{generation}:{number of chunks}:{sha256 of the value in hex}".
+	// The chunks are stored at "{key}.chunks/{generation}/{index}" before the manifest.
+	ChunkedPrefix = "chunked:v1:"
+	// DefaultChunkSize is the max size of the values written without chunking, which is
+	// below the default max request size of etcd, 1.5 MiB.
+	DefaultChunkSize = 1 << 20
+
+	chunkKeySeparator = ".chunks/"
+)
+
+// errChunksIncomplete is returned when some chunks of a manifest are not present yet.
+var errChunksIncomplete = errors.New("[etcd] config chunks are incomplete")
+
+// chunkManifest is the manifest of a chunked value.
+type chunkManifest struct {
+	generation string
+	count      int
+	sum        string
+}
+
+func (m *chunkManifest) String() string {
+	return ChunkedPrefix + m.generation + ":" + strconv.Itoa(m.count) + ":" + m.sum
+}
+
+// parseManifest parses the manifest in value, it returns false if value is not a manifest.
+func parseManifest(value string) (*chunkManifest, bool) {
+	if !strings.HasPrefix(value, ChunkedPrefix) {
+		return nil, false
+	}
+	parts := strings.Split(strings.TrimPrefix(value, ChunkedPrefix), ":")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	count, err := strconv.Atoi(parts[1])
+	if err != nil || count <= 0 {
+		return nil, false
+	}
+	return &chunkManifest{generation: parts[0], count: count, sum: parts[2]}, true
+}
+
+// chunkPrefix returns the prefix of the chunks of generation of key.
+func chunkPrefix(key, generation string) string {
+	return key + chunkKeySeparator + generation + "/"
+}
+
+// chunkKey returns the key of the i-th chunk, the index is padded so the chunks sort by key.
+func chunkKey(key, generation string, i int) string {
+	return fmt.Sprintf("%s%06d", chunkPrefix(key, generation), i)
+}
+
+// isChunkKey reports whether key is the key of a chunk, and returns the key of its manifest
+// and its generation.
+func isChunkKey(key string) (manifestKey, generation string, ok bool) {
+	i := strings.LastIndex(key, chunkKeySeparator)
+	if i < 0 {
+		return "", "", false
+	}
+	parts := strings.Split(key[i+len(chunkKeySeparator):], "/")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return key[:i], parts[0], true
+}
+
+// assemble concatenates the chunks of the manifest in kvs, which are sorted by key, and
+// verifies the checksum of the value.
+func (m *chunkManifest) assemble(key string, kvs []*mvccpb.KeyValue) (string, error) {
+	prefix := chunkPrefix(key, m.generation)
+	var sb strings.Builder
+	n := 0
+	for _, kv := range kvs {
+		if !strings.HasPrefix(string(kv.Key), prefix) {
+			continue
+		}
+		if string(kv.Key) != chunkKey(key, m.generation, n) {
+			return "", fmt.Errorf("%w: unexpected chunk %s", errChunksIncomplete, kv.Key)
+		}
+		sb.Write(kv.Value)
+		n++
+	}
+	if n != m.count {
+		return "", fmt.Errorf("%w: %d of %d chunks of %s", errChunksIncomplete, n, m.count, key)
+	}
+	value := sb.String()
+	if checksum(value) != m.sum {
+		return "", fmt.Errorf("[etcd] config chunks of %s do not match the checksum", key)
+	}
+	return value, nil
+}
+
+func checksum(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// readChunks returns value, or the value reassembled from the chunks in etcd if it is a
+// manifest. It returns errChunksIncomplete if some chunks are not present yet.
+func (c *client) readChunks(ctx context.Context, key, value string) (string, error) {
+	return c.readChunksAt(ctx, key, value, 0)
+}
+
+// readChunksAt reads the chunks like readChunks at rev, the current revision if it is zero.
+func (c *client) readChunksAt(ctx context.Context, key, value string, rev int64) (string, error) {
+	m, ok := parseManifest(value)
+	if !ok {
+		return value, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	resp, err := c.ecli.Get(ctx, chunkPrefix(key, m.generation), clientv3.WithPrefix(), clientv3.WithRev(rev),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return "", err
+	}
+	return m.assemble(key, resp.Kvs)
+}
+
+// putChunks writes the chunks of value of at most size bytes, and returns the manifest of them.
+func (c *client) putChunks(ctx context.Context, key, value string, size int) (string, error) {
+	var generation [8]byte
+	if _, err := rand.Read(generation[:]); err != nil {
+		return "", err
+	}
+	m := &chunkManifest{generation: hex.EncodeToString(generation[:]), sum: checksum(value)}
+	for i := 0; i < len(value); i += size {
+		end := i + size
+		if end > len(value) {
+			end = len(value)
+		}
+		if err := c.put(ctx, chunkKey(key, m.generation, m.count), value[i:end]); err != nil {
+			c.deleteChunks(key, m.String())
+			return "", err
+		}
+		m.count++
+	}
+	return m.String(), nil
+}
+
+func (c *client) put(ctx context.Context, key, value string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	_, err := c.ecli.Put(ctx, key, value)
+	return err
+}
+
+// deleteChunks deletes the chunks of value if it is a manifest, the failure is only logged
+// since the chunks not referenced are never read.
+func (c *client) deleteChunks(key, value string) {
+	m, ok := parseManifest(value)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, c.etcdTimeout)
+	defer cancel()
+	if _, err := c.ecli.Delete(ctx, chunkPrefix(key, m.generation), clientv3.WithPrefix()); err != nil {
+		klog.Warnf("[etcd] config key: %s delete chunks of generation %s failed: %v", key, m.generation, err)
+	}
+}
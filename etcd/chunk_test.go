@@ -0,0 +1,180 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+func (kv *testKV) Put(ctx context.Context, key, value string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	kv.put(key, value)
+	return &clientv3.PutResponse{}, nil
+}
+
+func (kv *testKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	op := clientv3.OpDelete(key, opts...)
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	deleted := false
+	for k, e := range kv.current(key, string(op.RangeBytes()), 0) {
+		if e.Version != 0 {
+			if !deleted {
+				kv.rev++
+				deleted = true
+			}
+			kv.log = append(kv.log, &mvccpb.KeyValue{Key: []byte(k), ModRevision: kv.rev})
+		}
+	}
+	return &clientv3.DeleteResponse{}, nil
+}
+
+func (kv *testKV) Txn(ctx context.Context) clientv3.Txn {
+	return &testTxn{kv: kv}
+}
+
+// testTxn is the Txn of testKV, the ops are applied at the same revision.
+type testTxn struct {
+	kv   *testKV
+	cmps []clientv3.Cmp
+	ops  []clientv3.Op
+}
+
+func (t *testTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *testTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.ops = append(t.ops, ops...)
+	return t
+}
+
+func (t *testTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	return t
+}
+
+func (t *testTxn) Commit() (*clientv3.TxnResponse, error) {
+	kv := t.kv
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	for _, cmp := range t.cmps {
+		var modRevision int64
+		if e, ok := kv.current(string(cmp.Key), "", 0)[string(cmp.Key)]; ok && e.Version != 0 {
+			modRevision = e.ModRevision
+		}
+		if modRevision != cmp.TargetUnion.(*etcdserverpb.Compare_ModRevision).ModRevision {
+			return &clientv3.TxnResponse{Header: &etcdserverpb.ResponseHeader{Revision: kv.rev}}, nil
+		}
+	}
+	kv.rev++
+	for _, op := range t.ops {
+		key := string(op.KeyBytes())
+		e := &mvccpb.KeyValue{Key: []byte(key), ModRevision: kv.rev}
+		if op.IsPut() {
+			e.Value, e.CreateRevision, e.Version = op.ValueBytes(), kv.rev, 1
+			if prev, ok := kv.current(key, "", 0)[key]; ok && prev.Version != 0 {
+				e.CreateRevision, e.Version = prev.CreateRevision, prev.Version+1
+			}
+		}
+		kv.log = append(kv.log, e)
+	}
+	return &clientv3.TxnResponse{Header: &etcdserverpb.ResponseHeader{Revision: kv.rev}, Succeeded: true}, nil
+}
+
+func TestChunkManifest(t *testing.T) {
+	key := "/KitexConfig/c/s/circuit_break"
+	value := "0123456789"
+	m := &chunkManifest{generation: "g1", count: 4, sum: checksum(value)}
+	parsed, ok := parseManifest(m.String())
+	test.Assert(t, ok && *parsed == *m, parsed)
+	_, ok = parseManifest(value)
+	test.Assert(t, !ok)
+
+	manifestKey, generation, ok := isChunkKey(chunkKey(key, "g1", 3))
+	test.Assert(t, ok && manifestKey == key && generation == "g1", manifestKey, generation)
+	_, _, ok = isChunkKey(key)
+	test.Assert(t, !ok)
+
+	var kvs []*mvccpb.KeyValue
+	for i := 0; i < 4; i++ {
+		end := (i + 1) * 3
+		if end > len(value) {
+			end = len(value)
+		}
+		kvs = append(kvs, &mvccpb.KeyValue{Key: []byte(chunkKey(key, "g1", i)), Value: []byte(value[i*3 : end])})
+	}
+	got, err := m.assemble(key, kvs)
+	test.Assert(t, err == nil && got == value, got, err)
+	_, err = m.assemble(key, kvs[:3])
+	test.Assert(t, errors.Is(err, errChunksIncomplete), err)
+	_, err = m.assemble(key, append(kvs[:1:1], kvs[2:]...))
+	test.Assert(t, errors.Is(err, errChunksIncomplete), err)
+	kvs[0].Value = []byte("xyz")
+	_, err = m.assemble(key, kvs)
+	test.Assert(t, err != nil && !errors.Is(err, errChunksIncomplete), err)
+}
+
+func TestWatchChunks(t *testing.T) {
+	kv := &testKV{}
+	c := &client{ecli: &clientv3.Client{KV: kv}, ctx: context.Background(), codec: &source.Codec{Parser: source.NewJSONParser()}, metrics: nopMetrics{}}
+	w := newWatcher(c, "/KitexConfig/", true)
+	key := "/KitexConfig/c/s/circuit_break"
+	var mu sync.Mutex
+	var got []string
+	kw := w.add(key, 1, func(restoreDefault bool, data string, parser ConfigParser, meta source.ConfigMeta) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, data)
+		return nil
+	}, &source.RegisterOptions{})
+	put := func(k, v string, rev int64) {
+		kv.put(k, v)
+		w.handle(context.Background(), &clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v), ModRevision: rev}})
+	}
+
+	value := `{"a":{"min_sample":100}}`
+	m := &chunkManifest{generation: "g1", count: 3, sum: checksum(value)}
+	// the manifest is not delivered until all its chunks are present.
+	put(key, m.String(), 10)
+	put(chunkKey(key, "g1", 0), value[:10], 11)
+	put(chunkKey(key, "g1", 2), value[20:], 12)
+	test.Assert(t, len(got) == 0 && kw.waiting("g1"), got)
+	put(chunkKey(key, "g1", 1), value[10:20], 13)
+	test.Assert(t, len(got) == 1 && got[0] == value && !kw.waiting("g1"), got)
+
+	// the manifest waiting for its chunks is dropped by a newer value.
+	m = &chunkManifest{generation: "g2", count: 2, sum: checksum("v2")}
+	put(key, m.String(), 14)
+	put(key, "v3", 15)
+	put(chunkKey(key, "g2", 0), "v", 16)
+	put(chunkKey(key, "g2", 1), "2", 17)
+	test.Assert(t, len(got) == 2 && got[1] == "v3" && !kw.waiting("g2"), got)
+
+	// the chunks present already are read with the manifest.
+	put(chunkKey(key, "g3", 0), "v", 18)
+	put(chunkKey(key, "g3", 1), "4", 19)
+	put(key, (&chunkManifest{generation: "g3", count: 2, sum: checksum("v4")}).String(), 20)
+	test.Assert(t, len(got) == 3 && got[2] == "v4", got)
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"errors"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+// newKeyLoadError classifies the error of loading key from etcd, it returns nil if err is nil.
+// The errors of delivering the value loaded are classified by source.NewDeliveryError.
+func newKeyLoadError(ctx context.Context, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var reason source.LoadFailureReason
+	switch {
+	case isAuthError(err):
+		reason = source.LoadPermissionDenied
+	case errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil:
+		reason = source.LoadTimeout
+	default:
+		reason = source.LoadUnavailable
+	}
+	return &source.KeyLoadError{Key: key, Reason: reason, Err: err}
+}
+
+// isAuthError reports whether err is caused by the authentication or permission of etcd, which
+// will not be recovered by retrying.
+func isAuthError(err error) bool {
+	return errors.Is(err, rpctypes.ErrPermissionDenied) ||
+		errors.Is(err, rpctypes.ErrAuthFailed) ||
+		errors.Is(err, rpctypes.ErrInvalidAuthToken) ||
+		errors.Is(err, rpctypes.ErrUserEmpty)
+}
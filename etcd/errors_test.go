@@ -0,0 +1,66 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+func TestNewKeyLoadError(t *testing.T) {
+	ctx := context.Background()
+	test.Assert(t, newKeyLoadError(ctx, "key", nil) == nil)
+
+	reason := func(err error) source.LoadFailureReason {
+		var kerr *source.KeyLoadError
+		test.Assert(t, errors.As(err, &kerr))
+		return kerr.Reason
+	}
+	test.Assert(t, reason(newKeyLoadError(ctx, "key", context.DeadlineExceeded)) == source.LoadTimeout)
+	test.Assert(t, reason(newKeyLoadError(ctx, "key", rpctypes.ErrPermissionDenied)) == source.LoadPermissionDenied)
+	test.Assert(t, reason(newKeyLoadError(ctx, "key", errors.New("unknown"))) == source.LoadUnavailable)
+}
+
+func TestNewDeliveryError(t *testing.T) {
+	test.Assert(t, source.NewDeliveryError("key", nil) == nil)
+
+	reason := func(err error) source.LoadFailureReason {
+		var kerr *source.KeyLoadError
+		test.Assert(t, errors.As(err, &kerr))
+		return kerr.Reason
+	}
+	var cfg map[string]interface{}
+	err := (&source.Codec{Parser: source.NewJSONParser()}).Decode("key", "", "{bad", &cfg)
+	test.Assert(t, reason(source.NewDeliveryError("key", err)) == source.LoadParseFailure)
+	// the value decoded but failed the validation of the callback is rejected rather than unavailable.
+	test.Assert(t, reason(source.NewDeliveryError("key", errors.New("qps_limit must be positive"))) == source.LoadRejected)
+}
+
+func TestInitialLoadError(t *testing.T) {
+	loadErr := &source.InitialLoadError{}
+	loadErr.Add(nil)
+	loadErr.Add(errors.New("not a key load error"))
+	test.Assert(t, loadErr.ErrorOrNil() == nil)
+
+	loadErr.Add(newKeyLoadError(context.Background(), "key", context.DeadlineExceeded))
+	test.Assert(t, loadErr.ErrorOrNil() != nil)
+	test.Assert(t, len(loadErr.Failures) == 1 && loadErr.Failures[0].Key == "key")
+}
@@ -15,44 +15,103 @@
 package etcd
 
 import (
-	"bytes"
 	"context"
-	"strconv"
+	"crypto/ed25519"
+	"crypto/tls"
+	"fmt"
+	"strings"
 	"sync"
-	"text/template"
 	"time"
 
-	"go.etcd.io/etcd/api/v3/mvccpb"
-
 	clientv3 "go.etcd.io/etcd/client/v3"
 
 	"github.com/cloudwego/kitex/pkg/klog"
 	"go.uber.org/zap"
+
+	"github.com/kitex-contrib/config-etcd/source"
 )
 
-type Key struct {
-	Prefix string
-	Path   string
-}
+var _ source.ConfigSource = Client(nil)
 
 type Client interface {
 	SetParser(ConfigParser)
 	ClientConfigParam(cpc *ConfigParamConfig, cfs ...CustomFunction) (Key, error)
 	ServerConfigParam(cpc *ConfigParamConfig, cfs ...CustomFunction) (Key, error)
-	RegisterConfigCallback(ctx context.Context, key string, clientId int64, callback func(restoreDefault bool, data string, parser ConfigParser))
+	// ClientConfigKey and ServerConfigKey render the keys of ClientConfigParam and ServerConfigParam.
+	ClientConfigKey(cpc *ConfigParamConfig, cfs ...CustomFunction) (string, error)
+	ServerConfigKey(cpc *ConfigParamConfig, cfs ...CustomFunction) (string, error)
+	// ClientConfigLayers and ServerConfigLayers return the keys of the layers of the config,
+	// which are registered by source.WithLayers.
+	ClientConfigLayers(cpc *ConfigParamConfig, cfs ...CustomFunction) ([]string, error)
+	ServerConfigLayers(cpc *ConfigParamConfig, cfs ...CustomFunction) ([]string, error)
+	RegisterConfigCallback(ctx context.Context, key string, clientId int64, callback source.ConfigCallback, opts ...source.RegisterOption) error
 	DeregisterConfig(key string, uniqueId int64)
+	AddListener(listener source.ConfigListener)
+	// ConfigKey, GetConfig, PutConfig and DeleteConfig read and write the config of cpc,
+	// the writes support compare-and-swap by WithModRevision. The key is prefixed with
+	// cpc.Dimensions if the default path formats are used.
+	ConfigKey(cpc *ConfigParamConfig, cfs ...CustomFunction) (string, error)
+	GetConfig(ctx context.Context, cpc *ConfigParamConfig, config interface{}, opts ...WriteOption) (int64, error)
+	PutConfig(ctx context.Context, cpc *ConfigParamConfig, config interface{}, opts ...WriteOption) (int64, error)
+	DeleteConfig(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) error
+	ListConfigs(ctx context.Context, prefix string) ([]source.ConfigValue, error)
+	// GetValue returns the raw value of key, or source.ErrConfigNotFound if it does not exist.
+	GetValue(ctx context.Context, key string) (source.ConfigValue, error)
+	// History lists the versions of the config of cpc from the newest, and Rollback writes
+	// the value of a version as a new version.
+	History(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) ([]ConfigVersion, error)
+	Rollback(ctx context.Context, cpc *ConfigParamConfig, revision int64, opts ...WriteOption) (int64, error)
+	// PutOverride, GetOverride and DeleteOverride write, read and delete the temporary override of
+	// the config of cpc, which is deleted when its ttl elapses, see Options.EnableOverrides.
+	PutOverride(ctx context.Context, cpc *ConfigParamConfig, config interface{}, ttl time.Duration, opts ...WriteOption) (int64, error)
+	GetOverride(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) (ConfigOverride, error)
+	DeleteOverride(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) error
+	// Status returns the statuses of the config of cpc reported by the instances, see Options.ReportStatus.
+	Status(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) (*ConfigStatus, error)
+	// Close stops all the watches and waits for the in-flight callbacks, then closes
+	// the etcd connection. The Client can not be used after it is closed.
+	Close() error
 }
 
 type client struct {
+	*source.KeyRenderer
 	ecli *clientv3.Client
-	// support customise parser
-	parser             ConfigParser
-	etcdTimeout        time.Duration
-	prefixTemplate     *template.Template
-	serverPathTemplate *template.Template
-	clientPathTemplate *template.Template
-	cancelMap          map[string]context.CancelFunc
-	m                  sync.Mutex
+	// codec decodes the values by the parsers, Options.KeyProvider, Options.TrustedKeys and
+	// the instance deciding whether the candidate of a rollout applies.
+	codec       *source.Codec
+	etcdTimeout time.Duration
+	// historyPrefix is the prefix of the history records out of the prefix watched.
+	// historyLimit is the number of the versions listed or kept of a key.
+	historyPrefix string
+	historyLimit  int
+	// reporter reports the statuses of the keys registered, nil if Options.ReportStatus is false.
+	// statusPrefix is the prefix of the status keys out of the prefix watched.
+	reporter     *statusReporter
+	statusPrefix string
+	// overrides is true if the override of each key is registered on top of it.
+	overrides bool
+	// encoder encodes the configs written by the codec, and checks them by Options.SchemaValidator.
+	encoder *ValueEncoder
+	// debounceInterval is the interval to coalesce the changes of a key, zero if disabled.
+	debounceInterval time.Duration
+	// layers are the layer keys registered with the keys.
+	layers map[layerID][]string
+	// watchPrefix is the common prefix of the keys watched by a single etcd watch.
+	watchPrefix string
+	watchers    map[string]*watcher
+	// snapshots persists the applied values, nil if Options.SnapshotDir is not set.
+	snapshots *snapshotStore
+	metrics   Metrics
+	m         sync.Mutex
+	// ctx is canceled when the client is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+	closed bool
+	// wg tracks the watch goroutines and the in-flight registrations.
+	wg sync.WaitGroup
+
+	listenerMu sync.RWMutex
+	listeners  []source.ConfigListener
 }
 
 // Options etcd config options. All the fields have default value.
@@ -61,9 +120,93 @@ type Options struct {
 	Prefix           string
 	ServerPathFormat string
 	ClientPathFormat string
+	// ServerPathLayers and ClientPathLayers are the path formats of the layers overridden by the
+	// server and client paths, from the lowest priority, e.g. EtcdGlobalClientPathLayer and
+	// EtcdServerClientPathLayer. The formats should contain the Category.
+	ServerPathLayers []string
+	ClientPathLayers []string
 	Timeout          time.Duration
 	LoggerConfig     *zap.Config
 	ConfigParser     ConfigParser
+	// CategoryParsers are the parsers for the categories, e.g. "retry" in yaml and "limit" in json.
+	// ConfigParser is used for the categories not in it.
+	CategoryParsers map[string]ConfigParser
+	// SnapshotDir is the directory to persist the applied config values, which are used
+	// when etcd is unreachable. Snapshot is disabled if it is empty.
+	SnapshotDir string
+	// Listeners observe the config events of all the keys.
+	Listeners []source.ConfigListener
+	// KeyProvider decrypts the values in the encrypted envelope before they are decoded, and
+	// encrypts the values written with WithEncryption. See source.NewFileKeyProvider and source.NewEnvKeyProvider.
+	KeyProvider source.KeyProvider
+	// MaxDecompressedSize limits the size of the values decompressed from the compressed envelope,
+	// source.DefaultMaxDecompressedSize if zero. The larger values are rejected.
+	MaxDecompressedSize int64
+	// TrustedKeys are the ed25519 public keys by id to verify the signature envelope of the values.
+	// If it is set, the unsigned or badly signed values are rejected and the last good config is kept,
+	// so are the values signed earlier than the one applied and the deletions, see source.Subscriber.Deliver.
+	TrustedKeys map[string]ed25519.PublicKey
+	// InstanceID and InstanceTags identify the process in the canary rollouts and the status reports,
+	// see WithRollout. They are source.InstanceFromEnv by default, so the id is the same as the
+	// Dimensions.InstanceID read from KITEX_CONFIG_INSTANCE_ID, or the hostname if it is not set.
+	InstanceID   string
+	InstanceTags []string
+	// HistoryPrefix is the prefix of the history records of the versions written by the write API,
+	// which keep the deletions and the times of the versions and survive the compaction of etcd. The
+	// records of a key are stored at "{HistoryPrefix}{key}/", DefaultHistoryPrefix if it is empty, e.g.
+	// "/KitexConfigHistory/KitexConfig/c/s/retry/". It must be out of the static part of Prefix, so
+	// that the records are not loaded by the watchers of the prefix keys.
+	HistoryPrefix string
+	// HistoryLimit is the number of the versions listed or kept of a key, DefaultHistoryLimit if zero.
+	HistoryLimit int
+	// ReportStatus reports the revision, the time and the error of the configs applied by the instance
+	// to "{StatusPrefix}{service path}/{InstanceID}/{category}" with a lease, so that the rollout
+	// progress of a config can be queried by Status, e.g. "/KitexConfigStatus/c/s/host-1/retry" for
+	// "/KitexConfig/c/s/retry". There is one status per key registered, the layers and the override of
+	// a key are not reported. The status of a key is deleted when it is deregistered.
+	ReportStatus bool
+	// StatusTTL is the TTL of the lease of the status keys, DefaultStatusTTL if zero.
+	StatusTTL time.Duration
+	// StatusPrefix is the prefix of the status keys, DefaultStatusPrefix if it is empty. It must be
+	// out of the static part of Prefix, so that the statuses are not loaded by the watchers of the prefix keys.
+	StatusPrefix string
+	// EnableOverrides registers the key of the temporary override of each config, OverrideKey, as
+	// the top layer of it, so that the override written by PutOverride is deep-merged on top of the
+	// config until its ttl elapses, then the config is restored.
+	EnableOverrides bool
+	// DebounceInterval coalesces the changes of a key watched in the interval after the first one,
+	// only the latest value is delivered to the callbacks when it elapses. It is disabled if zero.
+	DebounceInterval time.Duration
+	// SchemaValidator checks the configs written by PutConfig and PutOverride, e.g. validation.Validate.
+	// The configs are not checked if it is nil, unless WithValidation requires it.
+	SchemaValidator SchemaValidator
+	// Metrics reports the health of the config sync, it is disabled if nil.
+	// See pkg/metrics/prometheus for the Prometheus implementation.
+	Metrics Metrics
+
+	// TLS is the tls config to connect etcd, it takes precedence over CAFile, CertFile and KeyFile.
+	TLS *tls.Config
+	// CAFile is the PEM encoded CA file to verify the etcd server.
+	CAFile string
+	// CertFile and KeyFile are the PEM encoded client certificate and key files for mTLS.
+	// The CA and the certificate files are reloaded when they are rotated.
+	CertFile string
+	KeyFile  string
+	// Username and Password are used for the etcd RBAC authentication.
+	Username string
+	Password string
+	// DialTimeout is the timeout for failing to establish a connection.
+	DialTimeout time.Duration
+	// DialKeepAliveTime is the time after which client pings the server to see if transport is alive.
+	DialKeepAliveTime time.Duration
+	// DialKeepAliveTimeout is the time that the client waits for a response for the keep-alive probe.
+	DialKeepAliveTimeout time.Duration
+	// AutoSyncInterval is the interval to update endpoints with its latest members, 0 disables auto-sync.
+	AutoSyncInterval time.Duration
+	// MaxCallSendMsgSize and MaxCallRecvMsgSize are the client-side request and response size limits in bytes,
+	// the default values of clientv3 are used if they are 0.
+	MaxCallSendMsgSize int
+	MaxCallRecvMsgSize int
 }
 
 // NewClient Create a default etcd client
@@ -74,7 +217,7 @@ func NewClient(opts Options) (Client, error) {
 		opts.Node = []string{EtcdDefaultNode}
 	}
 	if opts.ConfigParser == nil {
-		opts.ConfigParser = defaultConfigParse()
+		opts.ConfigParser = source.NewJSONParser()
 	}
 	if opts.Prefix == "" {
 		opts.Prefix = EtcdDefaultConfigPrefix
@@ -82,146 +225,255 @@ func NewClient(opts Options) (Client, error) {
 	if opts.Timeout == 0 {
 		opts.Timeout = EtcdDefaultTimeout
 	}
-	if opts.ServerPathFormat == "" {
-		opts.ServerPathFormat = EtcdDefaultServerPath
+	if opts.HistoryPrefix == "" {
+		opts.HistoryPrefix = DefaultHistoryPrefix
 	}
-	if opts.ClientPathFormat == "" {
-		opts.ClientPathFormat = EtcdDefaultClientPath
+	if opts.HistoryLimit <= 0 {
+		opts.HistoryLimit = DefaultHistoryLimit
 	}
-	etcdClient, err := clientv3.New(clientv3.Config{
-		Endpoints: opts.Node,
-		LogConfig: opts.LoggerConfig,
+	if opts.StatusPrefix == "" {
+		opts.StatusPrefix = DefaultStatusPrefix
+	}
+	if opts.StatusTTL <= 0 {
+		opts.StatusTTL = DefaultStatusTTL
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = nopMetrics{}
+	}
+	renderer, err := source.NewKeyRenderer(source.KeyOptions{
+		Prefix:           opts.Prefix,
+		ServerPathFormat: opts.ServerPathFormat,
+		ClientPathFormat: opts.ClientPathFormat,
+		ServerPathLayers: opts.ServerPathLayers,
+		ClientPathLayers: opts.ClientPathLayers,
 	})
 	if err != nil {
 		return nil, err
 	}
-	prefixTemplate, err := template.New("prefix").Parse(opts.Prefix)
-	if err != nil {
+	watchPrefix := staticPrefix(opts.Prefix)
+	if err = checkUnwatched("history", opts.HistoryPrefix, watchPrefix); err != nil {
 		return nil, err
 	}
-	serverNameTemplate, err := template.New("serverName").Parse(opts.ServerPathFormat)
-	if err != nil {
+	if err = checkUnwatched("status", opts.StatusPrefix, watchPrefix); err != nil {
 		return nil, err
 	}
-	clientNameTemplate, err := template.New("clientName").Parse(opts.ClientPathFormat)
+	tlsConfig := opts.TLS
+	if tlsConfig == nil && (opts.CAFile != "" || opts.CertFile != "" || opts.KeyFile != "") {
+		tlsConfig, err = newTLSConfig(opts.CAFile, opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	etcdClient, err := clientv3.New(clientv3.Config{
+		Endpoints:            opts.Node,
+		LogConfig:            opts.LoggerConfig,
+		TLS:                  tlsConfig,
+		Username:             opts.Username,
+		Password:             opts.Password,
+		DialTimeout:          opts.DialTimeout,
+		DialKeepAliveTime:    opts.DialKeepAliveTime,
+		DialKeepAliveTimeout: opts.DialKeepAliveTimeout,
+		AutoSyncInterval:     opts.AutoSyncInterval,
+		MaxCallSendMsgSize:   opts.MaxCallSendMsgSize,
+		MaxCallRecvMsgSize:   opts.MaxCallRecvMsgSize,
+	})
 	if err != nil {
 		return nil, err
 	}
+	var snapshots *snapshotStore
+	if opts.SnapshotDir != "" {
+		snapshots, err = newSnapshotStore(opts.SnapshotDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	c := &client{
-		ecli:               etcdClient,
-		parser:             opts.ConfigParser,
-		etcdTimeout:        opts.Timeout,
-		prefixTemplate:     prefixTemplate,
-		serverPathTemplate: serverNameTemplate,
-		clientPathTemplate: clientNameTemplate,
-		cancelMap:          make(map[string]context.CancelFunc),
+		KeyRenderer: renderer,
+		ctx:         ctx,
+		cancel:      cancel,
+		ecli:        etcdClient,
+		codec: &source.Codec{
+			Parser:              opts.ConfigParser,
+			CategoryParsers:     opts.CategoryParsers,
+			KeyProvider:         opts.KeyProvider,
+			TrustedKeys:         opts.TrustedKeys,
+			Instance:            source.DefaultInstance(opts.InstanceID, opts.InstanceTags),
+			MaxDecompressedSize: opts.MaxDecompressedSize,
+		},
+		etcdTimeout:      opts.Timeout,
+		historyPrefix:    opts.HistoryPrefix,
+		historyLimit:     opts.HistoryLimit,
+		overrides:        opts.EnableOverrides,
+		debounceInterval: opts.DebounceInterval,
+		statusPrefix:     opts.StatusPrefix,
+		watchPrefix:      watchPrefix,
+		watchers:         make(map[string]*watcher),
+		snapshots:        snapshots,
+		listeners:        opts.Listeners,
+		metrics:          opts.Metrics,
+	}
+	c.encoder = &ValueEncoder{Codec: c.codec, SchemaValidator: opts.SchemaValidator}
+	if opts.ReportStatus {
+		c.reporter = newStatusReporter(c, opts.StatusTTL)
+		c.AddListener(c.reporter)
+		c.reporter.start()
 	}
 	return c, nil
 }
 
 func (c *client) SetParser(parser ConfigParser) {
-	c.parser = parser
+	c.codec.Parser = parser
 }
 
-func (c *client) ClientConfigParam(cpc *ConfigParamConfig, cfs ...CustomFunction) (Key, error) {
-	return c.configParam(cpc, c.clientPathTemplate, cfs...)
+// RegisterConfigCallback register the callback function to etcd client.
+// The current value is delivered to the callback before it returns. The keys under the
+// prefix in Options share a single etcd watch, and the events are dispatched to the
+// callbacks by key until the config is deregistered.
+// If etcd is unreachable, the value in the local snapshot is delivered instead, and it
+// is reconciled with the live value once etcd comes back.
+// It returns a *source.KeyLoadError if the current value can not be loaded or applied. If ctx
+// has a deadline, it keeps retrying until the deadline expires, otherwise it tries only once.
+// It returns source.ErrClosed if the client is closed.
+func (c *client) RegisterConfigCallback(ctx context.Context, key string, uniqueID int64, callback source.ConfigCallback, opts ...source.RegisterOption) error {
+	ro := source.NewRegisterOptions(opts...)
+	c.m.Lock()
+	if c.closed {
+		c.m.Unlock()
+		return source.ErrClosed
+	}
+	c.wg.Add(1)
+	c.m.Unlock()
+	defer c.wg.Done()
+	ctx, cancel := c.withCloseCancel(ctx)
+	defer cancel()
+	if c.overrides {
+		ro.Override = OverrideKey(key)
+	}
+	if c.reporter != nil {
+		c.reporter.register(key, uniqueID)
+	}
+	if len(ro.Layers) > 0 || ro.Override != "" {
+		return c.registerLayers(ctx, key, uniqueID, callback, ro)
+	}
+	return c.register(ctx, key, uniqueID, callback, ro)
 }
 
-func (c *client) ServerConfigParam(cpc *ConfigParamConfig, cfs ...CustomFunction) (Key, error) {
-	return c.configParam(cpc, c.serverPathTemplate, cfs...)
+// register registers the callback on key and delivers the current value to it.
+func (c *client) register(ctx context.Context, key string, uniqueID int64, callback source.ConfigCallback, ro *source.RegisterOptions) error {
+	c.m.Lock()
+	if c.closed {
+		c.m.Unlock()
+		return source.ErrClosed
+	}
+	prefix, isPrefix := c.watchRange(key)
+	w, ok := c.watchers[prefix]
+	if !ok {
+		w = newWatcher(c, prefix, isPrefix)
+		c.watchers[prefix] = w
+		w.start()
+		c.metrics.ActiveWatches(len(c.watchers))
+	}
+	kw := w.add(key, uniqueID, callback, ro)
+	c.m.Unlock()
+	if loaded, err := kw.deliver(uniqueID); loaded {
+		return source.NewDeliveryError(key, err)
+	}
+	if err := w.loadUntil(ctx, kw); err != nil {
+		if c.ctx.Err() != nil {
+			return source.ErrClosed
+		}
+		klog.Debugf("[etcd] key: %s config get value failed: %v", key, err)
+		w.notifyPending()
+		if !kw.restore() {
+			return newKeyLoadError(ctx, key, err)
+		}
+	}
+	_, err := kw.deliver(uniqueID)
+	return source.NewDeliveryError(key, err)
 }
 
-// configParam render config parameters. All the parameters can be customized with CustomFunction.
-// ConfigParam explain:
-//  1. Prefix: KitexConfig by default.
-//  2. ServerPath: {{.ServerServiceName}}/{{.Category}} by default.
-//     ClientPath: {{.ClientServiceName}}/{{.ServerServiceName}}/{{.Category}} by default.
-func (c *client) configParam(cpc *ConfigParamConfig, t *template.Template, cfs ...CustomFunction) (Key, error) {
-	param := Key{}
-
-	var err error
-	param.Path, err = c.render(cpc, t)
-	if err != nil {
-		return param, err
-	}
-	param.Prefix, err = c.render(cpc, c.prefixTemplate)
-	if err != nil {
-		return param, err
+// DeregisterConfig deregister the callback of key and its layers, the etcd watch is stopped when no key under it is registered.
+func (c *client) DeregisterConfig(key string, uniqueID int64) {
+	c.deregisterLayers(key, uniqueID)
+	c.deregister(key, uniqueID)
+	if c.reporter != nil {
+		c.reporter.deregister(key, uniqueID)
 	}
+}
 
-	for _, cf := range cfs {
-		cf(&param)
+// deregister deregisters the callback of uniqueID on key.
+func (c *client) deregister(key string, uniqueID int64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	prefix, _ := c.watchRange(key)
+	w, ok := c.watchers[prefix]
+	if !ok {
+		return
+	}
+	if w.remove(key, uniqueID) {
+		w.stop()
+		delete(c.watchers, prefix)
+		c.metrics.ActiveWatches(len(c.watchers))
 	}
-	return param, nil
 }
 
-func (c *client) render(cpc *ConfigParamConfig, t *template.Template) (string, error) {
-	var tpl bytes.Buffer
-	err := t.Execute(&tpl, cpc)
-	if err != nil {
-		return "", err
+// Close stops all the watches and waits for the in-flight callbacks, then closes the etcd connection.
+func (c *client) Close() error {
+	c.m.Lock()
+	if c.closed {
+		c.m.Unlock()
+		return source.ErrClosed
 	}
-	return tpl.String(), nil
+	c.closed = true
+	c.watchers = make(map[string]*watcher)
+	c.m.Unlock()
+	// cancel the watches and the registrations loading from etcd.
+	c.cancel()
+	c.wg.Wait()
+	c.metrics.ActiveWatches(0)
+	return c.ecli.Close()
 }
 
-// RegisterConfigCallback register the callback function to etcd client.
-func (c *client) RegisterConfigCallback(ctx context.Context, key string, uniqueID int64, callback func(bool, string, ConfigParser)) {
+// withCloseCancel returns a copy of ctx which is canceled when the client is closed.
+func (c *client) withCloseCancel(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
 	go func() {
-		clientCtx, cancel := context.WithCancel(context.Background())
-		c.registerCancelFunc(key, uniqueID, cancel)
-		watchChan := c.ecli.Watch(ctx, key)
-		for {
-			select {
-			case <-clientCtx.Done():
-				return
-			case watchResp := <-watchChan:
-				for _, event := range watchResp.Events {
-					eventType := event.Type
-					// check the event type
-					if eventType == mvccpb.PUT {
-						// config is updated
-						value := string(event.Kv.Value)
-						klog.Debugf("[etcd] config key: %s updated,value is %s", key, value)
-						callback(false, value, c.parser)
-					} else if eventType == mvccpb.DELETE {
-						// config is deleted
-						klog.Debugf("[etcd] config key: %s deleted", key)
-						callback(true, "", c.parser)
-					}
-				}
-			}
+		select {
+		case <-c.ctx.Done():
+			cancel()
+		case <-ctx.Done():
 		}
 	}()
-	ctx2, cancel := context.WithTimeout(context.Background(), c.etcdTimeout)
-	defer cancel()
-	data, err := c.ecli.Get(ctx2, key)
-	// the etcd client has handled the not exist error.
-	if err != nil {
-		klog.Debugf("[etcd] key: %s config get value failed", key)
-		return
-	}
-	if data.Count == 0 {
-		return
-	}
-	callback(false, string(data.Kvs[0].Value), c.parser)
+	return ctx, cancel
 }
 
-func (c *client) DeregisterConfig(key string, uniqueID int64) {
-	c.deregisterCancelFunc(key, uniqueID)
+// watchRange returns the key or prefix watched by the watcher of key.
+func (c *client) watchRange(key string) (string, bool) {
+	if c.watchPrefix != "" && strings.HasPrefix(key, c.watchPrefix) {
+		return c.watchPrefix, true
+	}
+	return key, false
 }
 
-func (c *client) deregisterCancelFunc(key string, uniqueID int64) {
-	c.m.Lock()
-	clientKey := key + "/" + strconv.FormatInt(uniqueID, 10)
-	cancel := c.cancelMap[clientKey]
-	cancel()
-	delete(c.cancelMap, clientKey)
-	c.m.Unlock()
+// checkUnwatched checks that the keys under prefix, which are named by name, are out of the
+// prefix watched, so that they are not loaded by the watchers of the prefix keys.
+func checkUnwatched(name, prefix, watchPrefix string) error {
+	if watchPrefix != "" && strings.HasPrefix(strings.TrimSuffix(prefix, "/")+"/", watchPrefix) {
+		return fmt.Errorf("[etcd] the %s prefix %q must be out of the prefix watched %q", name, prefix, watchPrefix)
+	}
+	return nil
 }
 
-func (c *client) registerCancelFunc(key string, uniqueID int64, cancel context.CancelFunc) {
-	c.m.Lock()
-	clientKey := key + "/" + strconv.FormatInt(uniqueID, 10)
-	c.cancelMap[clientKey] = cancel
-	c.m.Unlock()
+// staticPrefix returns the part of the prefix template that does not depend on the
+// config parameters, or empty if the keys can not share a common prefix.
+func staticPrefix(prefix string) string {
+	if i := strings.Index(prefix, "{{"); i >= 0 {
+		prefix = prefix[:strings.LastIndex(prefix[:i], "/")+1]
+	}
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	if prefix == "/" {
+		return ""
+	}
+	return prefix
 }
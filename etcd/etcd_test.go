@@ -0,0 +1,78 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+func TestStaticPrefix(t *testing.T) {
+	test.Assert(t, staticPrefix("/KitexConfig") == "/KitexConfig/")
+	test.Assert(t, staticPrefix("/KitexConfig/") == "/KitexConfig/")
+	test.Assert(t, staticPrefix("/KitexConfig/{{.ServerServiceName}}") == "/KitexConfig/")
+	test.Assert(t, staticPrefix("/KitexConfig-{{.ServerServiceName}}") == "")
+	test.Assert(t, staticPrefix("{{.ServerServiceName}}") == "")
+	test.Assert(t, staticPrefix("/") == "")
+}
+
+func TestWatchRange(t *testing.T) {
+	c := &client{watchPrefix: staticPrefix(EtcdDefaultConfigPrefix)}
+	prefix, isPrefix := c.watchRange("/KitexConfig/ClientName/ServiceName/retry")
+	test.Assert(t, prefix == "/KitexConfig/" && isPrefix)
+	prefix, isPrefix = c.watchRange("/Custom/ServiceName/limit")
+	test.Assert(t, prefix == "/Custom/ServiceName/limit" && !isPrefix)
+}
+
+func TestUnwatchedPrefixes(t *testing.T) {
+	_, err := NewClient(Options{Node: []string{"127.0.0.1:1"}, HistoryPrefix: "/KitexConfig/_history"})
+	test.Assert(t, err != nil)
+	_, err = NewClient(Options{Node: []string{"127.0.0.1:1"}, StatusPrefix: "/KitexConfig/_status/"})
+	test.Assert(t, err != nil)
+	c, err := NewClient(Options{Node: []string{"127.0.0.1:1"}})
+	test.Assert(t, err == nil, err)
+	test.Assert(t, c.(*client).historyKeys("/KitexConfig/c/s/retry") == "/KitexConfigHistory/KitexConfig/c/s/retry/")
+	test.Assert(t, c.(*client).statusKey("/KitexConfig/c/s/retry", "a") == "/KitexConfigStatus/c/s/a/retry")
+	test.Assert(t, c.Close() == nil)
+}
+
+func TestClientClose(t *testing.T) {
+	c, err := NewClient(Options{Node: []string{"127.0.0.1:1"}, Timeout: 100 * time.Millisecond})
+	test.Assert(t, err == nil, err)
+	callback := func(restoreDefault bool, data string, parser ConfigParser, meta source.ConfigMeta) error {
+		return nil
+	}
+	key := "/KitexConfig/ClientName/ServiceName/retry"
+	test.Assert(t, c.RegisterConfigCallback(context.Background(), key, 1, callback) != nil)
+
+	done := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		done <- c.RegisterConfigCallback(ctx, key, 2, callback)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	test.Assert(t, c.Close() == nil)
+	test.Assert(t, <-done == source.ErrClosed)
+
+	test.Assert(t, c.RegisterConfigCallback(context.Background(), key, 3, callback) == source.ErrClosed)
+	c.DeregisterConfig(key, 1)
+	test.Assert(t, c.Close() == source.ErrClosed)
+}
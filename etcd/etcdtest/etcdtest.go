@@ -0,0 +1,731 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package etcdtest provides an in-memory etcd.Client for the unit tests of the code
+// using the client and server suites, so that they can run without etcd.
+//
+// The keys are rendered like the etcd client. The values written by Put, Delete or
+// the write API are queued as events, which are delivered to the callbacks one at a
+// time by Step, or all at once by Flush, so that the tests control when a change is applied.
+package etcdtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kitex-contrib/config-etcd/etcd"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+var _ etcd.Client = &Client{}
+
+// Client is an in-memory etcd.Client.
+// The layers registered by source.WithLayers and the overrides are merged by source.RegisterLayers,
+// and the values are written, listed and reported by the helpers of the etcd package like the etcd client.
+type Client struct {
+	*source.KeyRenderer
+
+	mu sync.Mutex
+	// codec decodes the values like the etcd client, its Now is set by SetTime.
+	codec     source.Codec
+	listeners []source.ConfigListener
+	revision  int64
+	values    map[string]source.ConfigValue
+	// history is the versions of the keys from the oldest, at most historyLimit of them are kept.
+	history      map[string][]etcd.ConfigVersion
+	historyLimit int
+	// overrides is true if the override of each key is merged on top of it, and expires are
+	// the deadlines of the overrides written.
+	overrides bool
+	expires   map[string]time.Time
+	// encoder encodes the configs written like the etcd client.
+	encoder *etcd.ValueEncoder
+	// now is the time to select the scheduled variants, time.Now is used if it is zero.
+	now time.Time
+	// statuses are the statuses reported by the Client if reportStatus is true, and others are the
+	// ones of the other instances by key set by SetStatus.
+	statuses     *etcd.InstanceStatuses
+	others       map[string]map[string]etcd.InstanceStatus
+	reportStatus bool
+	events       []event
+	callbacks    map[string]map[int64]*callback
+	// layers are the layer keys registered with the keys.
+	layers map[layerID][]string
+	closed bool
+
+	// deliverMu serializes the deliveries, the callbacks are called without holding mu so that
+	// they can call the Client, and the listeners are called without holding either.
+	deliverMu sync.Mutex
+}
+
+// event is a change of key, modRevision is zero if the key is deleted.
+type event struct {
+	key         string
+	value       string
+	revision    int64
+	modRevision int64
+	// redeliver is true if the value is delivered again as the scheduled variant applying changes.
+	redeliver bool
+}
+
+type layerID struct {
+	key      string
+	uniqueID int64
+}
+
+type callback struct {
+	*source.Subscriber
+	// revision is the revision of the last event delivered.
+	revision int64
+}
+
+// NewClient creates an in-memory Client. Prefix, ServerPathFormat, ClientPathFormat,
+// ServerPathLayers, ClientPathLayers, ConfigParser, CategoryParsers, KeyProvider, MaxDecompressedSize,
+// TrustedKeys, InstanceID, InstanceTags, HistoryLimit, ReportStatus, EnableOverrides, SchemaValidator and
+// Listeners of opts are used like the etcd client, the others are ignored. InstanceID and InstanceTags are not
+// defaulted from the environment, and the statuses are kept in memory.
+func NewClient(opts etcd.Options) (*Client, error) {
+	renderer, err := source.NewKeyRenderer(source.KeyOptions{
+		Prefix:           opts.Prefix,
+		ServerPathFormat: opts.ServerPathFormat,
+		ClientPathFormat: opts.ClientPathFormat,
+		ServerPathLayers: opts.ServerPathLayers,
+		ClientPathLayers: opts.ClientPathLayers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.ConfigParser == nil {
+		opts.ConfigParser = source.NewJSONParser()
+	}
+	if opts.HistoryLimit <= 0 {
+		opts.HistoryLimit = etcd.DefaultHistoryLimit
+	}
+	c := &Client{
+		KeyRenderer: renderer,
+		codec: source.Codec{
+			Parser:              opts.ConfigParser,
+			CategoryParsers:     opts.CategoryParsers,
+			KeyProvider:         opts.KeyProvider,
+			TrustedKeys:         opts.TrustedKeys,
+			Instance:            source.Instance{ID: opts.InstanceID, Tags: opts.InstanceTags},
+			MaxDecompressedSize: opts.MaxDecompressedSize,
+		},
+		listeners:    opts.Listeners,
+		values:       make(map[string]source.ConfigValue),
+		history:      make(map[string][]etcd.ConfigVersion),
+		historyLimit: opts.HistoryLimit,
+		overrides:    opts.EnableOverrides,
+		expires:      make(map[string]time.Time),
+		statuses:     etcd.NewInstanceStatuses(opts.InstanceID),
+		others:       make(map[string]map[string]etcd.InstanceStatus),
+		reportStatus: opts.ReportStatus,
+		callbacks:    make(map[string]map[int64]*callback),
+		layers:       make(map[layerID][]string),
+	}
+	c.encoder = &etcd.ValueEncoder{Codec: &c.codec, SchemaValidator: opts.SchemaValidator}
+	return c, nil
+}
+
+// Put sets the value of key and queues the change, it returns the revision of the value.
+func (c *Client) Put(key, value string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.put(key, value)
+}
+
+// Delete deletes key and queues the change if it exists.
+func (c *Client) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delete(key)
+}
+
+func (c *Client) put(key, value string) int64 {
+	c.revision++
+	c.values[key] = source.ConfigValue{Key: key, Value: value, ModRevision: c.revision}
+	c.events = append(c.events, event{key: key, value: value, revision: c.revision, modRevision: c.revision})
+	c.record(key, etcd.ConfigVersion{Revision: c.revision, Value: value, Time: time.Now()})
+	return c.revision
+}
+
+func (c *Client) delete(key string) int64 {
+	if _, ok := c.values[key]; !ok {
+		return c.revision
+	}
+	c.revision++
+	delete(c.values, key)
+	c.events = append(c.events, event{key: key, revision: c.revision})
+	c.record(key, etcd.ConfigVersion{Revision: c.revision, Deleted: true, Time: time.Now()})
+	return c.revision
+}
+
+// record appends the version of key to its history, and prunes the oldest ones beyond historyLimit.
+func (c *Client) record(key string, version etcd.ConfigVersion) {
+	versions := append(c.history[key], version)
+	if len(versions) > c.historyLimit {
+		versions = versions[len(versions)-c.historyLimit:]
+	}
+	c.history[key] = versions
+}
+
+// Value returns the current value of key.
+func (c *Client) Value(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	return v.Value, ok
+}
+
+// SetTime sets the time to select the variants of the scheduled values, and queues the
+// scheduled values to be delivered again, so that the callbacks switch to the variants
+// applying at now like the etcd client does at the boundaries of the windows.
+func (c *Client) SetTime(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	keys := make([]string, 0, len(c.values))
+	for key, v := range c.values {
+		if c.scheduled(v.Value) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := c.values[key]
+		c.events = append(c.events, event{key: key, value: v.Value, revision: c.revision, modRevision: v.ModRevision, redeliver: true})
+	}
+}
+
+// scheduled reports whether value is in the schedule envelope, or the value applying to the
+// instance in the rollout envelope is.
+func (c *Client) scheduled(value string) bool {
+	value = source.Unsign(value)
+	if source.IsRollout(value) {
+		v, err := source.ParseRollout(value)
+		if err != nil {
+			return false
+		}
+		value = source.Unsign(v.Select(c.codec.Instance))
+	}
+	return source.IsScheduled(value)
+}
+
+// Pending returns the number of the changes which have not been delivered.
+func (c *Client) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.events)
+}
+
+// Step delivers the oldest queued change to the callbacks of its key. It returns false
+// if there is no queued change, and the first error returned by the callbacks.
+func (c *Client) Step() (bool, error) {
+	c.deliverMu.Lock()
+	c.mu.Lock()
+	if len(c.events) == 0 {
+		c.mu.Unlock()
+		c.deliverMu.Unlock()
+		return false, nil
+	}
+	ev := c.events[0]
+	c.events = c.events[1:]
+	cbs := c.callbacksOf(ev.key)
+	c.mu.Unlock()
+
+	var firstErr error
+	events := make([]published, 0, len(cbs))
+	for _, cb := range cbs {
+		p, err := c.notify(ev, cb)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		events = append(events, p)
+	}
+	c.deliverMu.Unlock()
+	publish(events...)
+	return true, firstErr
+}
+
+// Flush delivers all the queued changes in order, it returns the first error returned by the callbacks.
+func (c *Client) Flush() error {
+	var firstErr error
+	for {
+		ok, err := c.Step()
+		if !ok {
+			return firstErr
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+}
+
+// RegisteredKeys returns the sorted keys which have callbacks registered.
+func (c *Client) RegisteredKeys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.callbacks))
+	for key := range c.callbacks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Registered reports whether the callback of uniqueID is registered on key.
+func (c *Client) Registered(key string, uniqueID int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.callbacks[key][uniqueID]
+	return ok
+}
+
+// Layers returns the layers registered with the callback of uniqueID on key, from the lowest
+// priority, which end with the override of key with Options.EnableOverrides.
+func (c *Client) Layers(key string, uniqueID int64) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.layers[layerID{key, uniqueID}]...)
+}
+
+// SetParser implements etcd.Client.
+func (c *Client) SetParser(parser etcd.ConfigParser) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.codec.Parser = parser
+}
+
+// RegisterConfigCallback implements etcd.Client. The current value of key is delivered
+// to the callback before it returns, the queued changes are delivered by Step. The changes of
+// key queued before it has any callback are dropped, since the current value includes them.
+// The layers of source.WithLayers, and the override of key with Options.EnableOverrides, are
+// deep-merged with key like the etcd client.
+func (c *Client) RegisterConfigCallback(ctx context.Context, key string, uniqueID int64,
+	configCallback source.ConfigCallback, opts ...source.RegisterOption,
+) error {
+	ro := source.NewRegisterOptions(opts...)
+	if c.overrides {
+		ro.Override = etcd.OverrideKey(key)
+	}
+	c.mu.Lock()
+	c.statuses.Register(key, uniqueID)
+	c.mu.Unlock()
+	if len(ro.Layers) == 0 && ro.Override == "" {
+		return c.register(key, uniqueID, configCallback, ro)
+	}
+	layers := append([]string{}, ro.Layers...)
+	if ro.Override != "" {
+		layers = append(layers, ro.Override)
+	}
+	c.mu.Lock()
+	c.layers[layerID{key, uniqueID}] = layers
+	c.mu.Unlock()
+	return source.RegisterLayers(key, configCallback, ro, func(k string, cb source.ConfigCallback) error {
+		return c.register(k, uniqueID, cb, ro)
+	})
+}
+
+// register registers the callback on key and delivers the current value to it.
+func (c *Client) register(key string, uniqueID int64, configCallback source.ConfigCallback, ro *source.RegisterOptions) error {
+	cb := &callback{Subscriber: source.NewSubscriber(configCallback, ro)}
+	c.deliverMu.Lock()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		c.deliverMu.Unlock()
+		return source.ErrClosed
+	}
+	if c.callbacks[key] == nil {
+		c.callbacks[key] = make(map[int64]*callback)
+		// the queued changes of key are at or below the revision loaded below, and there is
+		// no other callback to deliver them to.
+		c.dropEvents(key)
+	}
+	c.callbacks[key][uniqueID] = cb
+	v, ok := c.values[key]
+	ev := event{key: key, value: v.Value, revision: c.revision, modRevision: v.ModRevision}
+	c.mu.Unlock()
+	if !ok {
+		cb.revision = ev.revision
+		c.deliverMu.Unlock()
+		return nil
+	}
+	p, err := c.notify(ev, cb)
+	c.deliverMu.Unlock()
+	publish(p)
+	return source.NewDeliveryError(key, err)
+}
+
+// DeregisterConfig implements etcd.Client, the callback is deregistered from key and its layers.
+func (c *Client) DeregisterConfig(key string, uniqueID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := layerID{key, uniqueID}
+	keys := append(c.layers[id], key)
+	delete(c.layers, id)
+	for _, k := range keys {
+		delete(c.callbacks[k], uniqueID)
+		if len(c.callbacks[k]) == 0 {
+			delete(c.callbacks, k)
+		}
+	}
+	c.statuses.Deregister(key, uniqueID)
+}
+
+// AddListener implements etcd.Client.
+func (c *Client) AddListener(listener source.ConfigListener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+// GetConfig implements etcd.Client.
+func (c *Client) GetConfig(ctx context.Context, cpc *etcd.ConfigParamConfig, config interface{}, opts ...etcd.WriteOption) (int64, error) {
+	wo := etcd.NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	v, ok := c.values[key]
+	codec := c.codecNow()
+	c.mu.Unlock()
+	if !ok {
+		return 0, source.ErrConfigNotFound
+	}
+	if err = codec.Decode(key, cpc.Category, v.Value, config); err != nil {
+		return 0, err
+	}
+	return v.ModRevision, nil
+}
+
+// PutConfig implements etcd.Client, the change is queued like Put. The values are never
+// chunked since there is no size limit in memory.
+func (c *Client) PutConfig(ctx context.Context, cpc *etcd.ConfigParamConfig, config interface{}, opts ...etcd.WriteOption) (int64, error) {
+	wo := etcd.NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, err := c.encoder.EncodeConfig(key, cpc.Category, config, wo, func() (source.ConfigValue, error) {
+		v, ok := c.values[key]
+		if !ok {
+			return source.ConfigValue{}, source.ErrConfigNotFound
+		}
+		return v, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err = c.compare(key, wo); err != nil {
+		return 0, err
+	}
+	return c.put(key, value), nil
+}
+
+// DeleteConfig implements etcd.Client, the change is queued like Delete.
+func (c *Client) DeleteConfig(ctx context.Context, cpc *etcd.ConfigParamConfig, opts ...etcd.WriteOption) error {
+	wo := etcd.NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.compare(key, wo); err != nil {
+		return err
+	}
+	c.delete(key)
+	return nil
+}
+
+// PutOverride implements etcd.Client, the override is deleted by ExpireOverrides once its ttl
+// elapses, and the change is queued like Put.
+func (c *Client) PutOverride(ctx context.Context, cpc *etcd.ConfigParamConfig, config interface{}, ttl time.Duration, opts ...etcd.WriteOption) (int64, error) {
+	wo := etcd.NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return 0, err
+	}
+	key = etcd.OverrideKey(key)
+	value, err := c.encoder.EncodeOverride(key, cpc.Category, config, wo)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.compare(key, wo); err != nil {
+		return 0, err
+	}
+	c.expires[key] = time.Now().Add(ttl)
+	return c.put(key, value), nil
+}
+
+// GetOverride implements etcd.Client.
+func (c *Client) GetOverride(ctx context.Context, cpc *etcd.ConfigParamConfig, opts ...etcd.WriteOption) (etcd.ConfigOverride, error) {
+	wo := etcd.NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return etcd.ConfigOverride{}, err
+	}
+	key = etcd.OverrideKey(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	if !ok {
+		return etcd.ConfigOverride{}, source.ErrConfigNotFound
+	}
+	return etcd.ConfigOverride{Key: key, Value: v.Value, ModRevision: v.ModRevision, TTL: time.Until(c.expires[key])}, nil
+}
+
+// DeleteOverride implements etcd.Client, the change is queued like Delete.
+func (c *Client) DeleteOverride(ctx context.Context, cpc *etcd.ConfigParamConfig, opts ...etcd.WriteOption) error {
+	wo := etcd.NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return err
+	}
+	key = etcd.OverrideKey(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.compare(key, wo); err != nil {
+		return err
+	}
+	delete(c.expires, key)
+	c.delete(key)
+	return nil
+}
+
+// ExpireOverrides deletes the overrides whose ttl has elapsed at now like their leases expire,
+// and queues the changes.
+func (c *Client) ExpireOverrides(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, expire := range c.expires {
+		if !now.Before(expire) {
+			delete(c.expires, key)
+			c.delete(key)
+		}
+	}
+}
+
+// GetValue implements etcd.Client.
+func (c *Client) GetValue(ctx context.Context, key string) (source.ConfigValue, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	if !ok {
+		return source.ConfigValue{}, source.ErrConfigNotFound
+	}
+	return v, nil
+}
+
+// History implements etcd.Client, the versions written are listed like the history records of the etcd client.
+func (c *Client) History(ctx context.Context, cpc *etcd.ConfigParamConfig, opts ...etcd.WriteOption) ([]etcd.ConfigVersion, error) {
+	wo := etcd.NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	versions := append([]etcd.ConfigVersion{}, c.history[key]...)
+	return etcd.LatestVersions(versions, c.historyLimit), nil
+}
+
+// Rollback implements etcd.Client, the change is queued like Put.
+func (c *Client) Rollback(ctx context.Context, cpc *etcd.ConfigParamConfig, revision int64, opts ...etcd.WriteOption) (int64, error) {
+	wo := etcd.NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, err := etcd.FindVersion(key, c.history[key], revision)
+	if err != nil {
+		return 0, err
+	}
+	value, err := c.encoder.EncodeRollback(key, v.Value, wo)
+	if err != nil {
+		return 0, err
+	}
+	if err = c.compare(key, wo); err != nil {
+		return 0, err
+	}
+	rev := c.revision
+	if v.Deleted {
+		c.delete(key)
+	} else {
+		c.put(key, value)
+	}
+	// the deletion of the deleted key is not a version.
+	if c.revision > rev {
+		versions := c.history[key]
+		versions[len(versions)-1].Rollback = revision
+	}
+	return c.revision, nil
+}
+
+// Status implements etcd.Client, the statuses are the ones of the Client and SetStatus.
+func (c *Client) Status(ctx context.Context, cpc *etcd.ConfigParamConfig, opts ...etcd.WriteOption) (*etcd.ConfigStatus, error) {
+	wo := etcd.NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	instances := make([]etcd.InstanceStatus, 0, len(c.others[key])+1)
+	status, reported := c.statuses.Get(key)
+	if reported {
+		instances = append(instances, status)
+	}
+	for _, status := range c.others[key] {
+		if !reported || status.Instance != c.codec.Instance.ID {
+			instances = append(instances, status)
+		}
+	}
+	return etcd.NewConfigStatus(key, c.values[key].ModRevision, instances), nil
+}
+
+// SetStatus sets the status reported by an instance, e.g. to simulate the other instances
+// in the rollout. The status reported by the Client takes precedence over the one set for its instance.
+func (c *Client) SetStatus(status etcd.InstanceStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.others[status.Key] == nil {
+		c.others[status.Key] = make(map[string]etcd.InstanceStatus)
+	}
+	c.others[status.Key][status.Instance] = status
+}
+
+// ListConfigs implements etcd.Client, all the values are returned if prefix is empty.
+func (c *Client) ListConfigs(ctx context.Context, prefix string) ([]source.ConfigValue, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make([]source.ConfigValue, 0, len(c.values))
+	for key, v := range c.values {
+		if strings.HasPrefix(key, prefix) {
+			values = append(values, v)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Key < values[j].Key
+	})
+	return values, nil
+}
+
+// Close implements etcd.Client, the callbacks are not called after it returns.
+func (c *Client) Close() error {
+	c.deliverMu.Lock()
+	defer c.deliverMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return source.ErrClosed
+	}
+	c.closed = true
+	c.callbacks = make(map[string]map[int64]*callback)
+	c.events = nil
+	return nil
+}
+
+// compare checks the ModRevision of key if it is required by wo.
+func (c *Client) compare(key string, wo *etcd.WriteOptions) error {
+	if !wo.Compare {
+		return nil
+	}
+	if c.values[key].ModRevision != wo.ExpectedRevision {
+		return fmt.Errorf("%w: %s is not at revision %d", etcd.ErrRevisionConflict, key, wo.ExpectedRevision)
+	}
+	return nil
+}
+
+// dropEvents removes the queued changes of key.
+func (c *Client) dropEvents(key string) {
+	events := c.events[:0]
+	for _, ev := range c.events {
+		if ev.key != key {
+			events = append(events, ev)
+		}
+	}
+	c.events = events
+}
+
+func (c *Client) callbacksOf(key string) []*callback {
+	cbs := make([]*callback, 0, len(c.callbacks[key]))
+	for _, cb := range c.callbacks[key] {
+		cbs = append(cbs, cb)
+	}
+	return cbs
+}
+
+// codecNow returns the codec selecting the scheduled variants at the time set by SetTime.
+func (c *Client) codecNow() *source.Codec {
+	codec := c.codec
+	now := c.now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	codec.Now = func() time.Time { return now }
+	return &codec
+}
+
+// notify delivers ev to cb like the etcd client: the stale changes and the unchanged
+// values are skipped. It returns the event to publish to the listeners.
+func (c *Client) notify(ev event, cb *callback) (published, error) {
+	if ev.revision < cb.revision || (ev.revision == cb.revision && !ev.redeliver) {
+		return published{}, nil
+	}
+	cb.revision = ev.revision
+	c.mu.Lock()
+	parser := c.codecNow().ParserOf(ev.key, cb.Param.Category)
+	listeners := append(append([]source.ConfigListener{}, c.listeners...), cb.Listeners...)
+	c.mu.Unlock()
+
+	configEvent := cb.Deliver(source.Update{Key: ev.key, Value: ev.value, ModRevision: ev.modRevision, Force: ev.redeliver}, parser)
+	if configEvent == nil {
+		return published{}, nil
+	}
+	c.mu.Lock()
+	if c.reportStatus {
+		c.statuses.Update(configEvent, time.Now())
+	}
+	c.mu.Unlock()
+	return published{event: configEvent, listeners: listeners}, configEvent.Err
+}
+
+// published is the event of a delivery to publish to the listeners, which is published after
+// deliverMu is released so that the listeners can call the Client.
+type published struct {
+	event     *source.ConfigEvent
+	listeners []source.ConfigListener
+}
+
+func publish(events ...published) {
+	for _, p := range events {
+		for _, l := range p.listeners {
+			l.OnConfigEvent(p.event)
+		}
+	}
+}
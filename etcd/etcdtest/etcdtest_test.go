@@ -0,0 +1,411 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdtest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+	"github.com/kitex-contrib/config-etcd/etcd"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+type limit struct {
+	QPS int `json:"qps"`
+}
+
+func TestClient(t *testing.T) {
+	c, err := NewClient(etcd.Options{})
+	test.Assert(t, err == nil, err)
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	param, err := c.ServerConfigParam(cpc)
+	test.Assert(t, err == nil, err)
+	key := param.Prefix + "/" + param.Path
+	test.Assert(t, key == "/KitexConfig/s/limit", key)
+
+	c.Put(key, `{"qps":100}`)
+	var got []limit
+	var restored bool
+	var events []*source.ConfigEvent
+	err = c.RegisterConfigCallback(context.Background(), key, 1, func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
+		restored = restoreDefault
+		if restoreDefault {
+			return nil
+		}
+		var l limit
+		if err := parser.Decode(data, &l); err != nil {
+			return err
+		}
+		if l.QPS < 0 {
+			return errors.New("negative qps")
+		}
+		got = append(got, l)
+		return nil
+	}, source.WithConfigParam(cpc), source.WithListeners(source.ConfigListenerFunc(func(event *source.ConfigEvent) {
+		events = append(events, event)
+	})))
+	test.Assert(t, err == nil, err)
+	test.Assert(t, len(got) == 1 && got[0].QPS == 100, got)
+	test.Assert(t, len(c.RegisteredKeys()) == 1 && c.Registered(key, 1), c.RegisteredKeys())
+
+	// the change loaded by the registration is dropped from the queue.
+	test.Assert(t, c.Pending() == 0)
+
+	c.Put(key, `{"qps":200}`)
+	c.Put(key, `{"qps":-1}`)
+	test.Assert(t, len(got) == 1, "not delivered before step")
+	ok, err := c.Step()
+	test.Assert(t, ok && err == nil && len(got) == 2 && got[1].QPS == 200, got, err)
+	ok, err = c.Step()
+	test.Assert(t, ok && err != nil && len(got) == 2, err)
+	test.Assert(t, events[len(events)-1].Type == source.EventRejected && events[len(events)-1].OldValue == `{"qps":200}`, events)
+
+	c.Put(key, `{`)
+	var perr *source.ParseError
+	test.Assert(t, errors.As(c.Flush(), &perr))
+
+	c.Delete(key)
+	test.Assert(t, c.Flush() == nil && restored)
+	test.Assert(t, events[len(events)-1].Type == source.EventRestored, events)
+	ok, _ = c.Step()
+	test.Assert(t, !ok)
+
+	// the registration reports the value rejected by the callback as rejected rather than unavailable.
+	c.Put(key, `{"qps":-1}`)
+	test.Assert(t, c.Flush() != nil)
+	err = c.RegisterConfigCallback(context.Background(), key, 2, func(bool, string, etcd.ConfigParser, source.ConfigMeta) error {
+		return errors.New("negative qps")
+	})
+	var kerr *source.KeyLoadError
+	test.Assert(t, errors.As(err, &kerr) && kerr.Reason == source.LoadRejected, err)
+	c.DeregisterConfig(key, 2)
+
+	c.DeregisterConfig(key, 1)
+	test.Assert(t, len(c.RegisteredKeys()) == 0, c.RegisteredKeys())
+	test.Assert(t, c.Close() == nil)
+	test.Assert(t, errors.Is(c.Close(), source.ErrClosed))
+	test.Assert(t, errors.Is(c.RegisterConfigCallback(context.Background(), key, 1, nil), source.ErrClosed))
+}
+
+func TestClientListenerReentrant(t *testing.T) {
+	c, err := NewClient(etcd.Options{})
+	test.Assert(t, err == nil, err)
+	key := "/KitexConfig/s/limit"
+	noop := func(bool, string, etcd.ConfigParser, source.ConfigMeta) error {
+		return nil
+	}
+	rev := c.Put(key, `{"qps":200}`)
+	// the listeners can register and deregister the keys.
+	var registered bool
+	err = c.RegisterConfigCallback(context.Background(), key, 1, noop, source.WithListeners(source.ConfigListenerFunc(func(event *source.ConfigEvent) {
+		if event.Revision == rev && !registered {
+			registered = true
+			test.Assert(t, c.RegisterConfigCallback(context.Background(), key, 2, noop) == nil)
+			c.DeregisterConfig(key, 1)
+		}
+	})))
+	test.Assert(t, err == nil && registered, err)
+	test.Assert(t, c.Registered(key, 2) && !c.Registered(key, 1), c.RegisteredKeys())
+}
+
+func TestClientWrite(t *testing.T) {
+	c, err := NewClient(etcd.Options{})
+	test.Assert(t, err == nil, err)
+	ctx := context.Background()
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	_, err = c.GetConfig(ctx, cpc, &limit{})
+	test.Assert(t, errors.Is(err, source.ErrConfigNotFound), err)
+
+	rev, err := c.PutConfig(ctx, cpc, limit{QPS: 100}, etcd.WithModRevision(0))
+	test.Assert(t, err == nil, err)
+	_, err = c.PutConfig(ctx, cpc, limit{QPS: 200}, etcd.WithModRevision(0))
+	test.Assert(t, errors.Is(err, etcd.ErrRevisionConflict), err)
+
+	var l limit
+	got, err := c.GetConfig(ctx, cpc, &l)
+	test.Assert(t, err == nil && got == rev && l.QPS == 100, l, err)
+	values, err := c.ListConfigs(ctx, "/KitexConfig/")
+	test.Assert(t, err == nil && len(values) == 1 && values[0].Value == `{"qps":100}`, values, err)
+
+	test.Assert(t, c.DeleteConfig(ctx, cpc, etcd.WithModRevision(rev)) == nil)
+	_, ok := c.Value("/KitexConfig/s/limit")
+	test.Assert(t, !ok && c.Pending() == 2)
+
+	// the validation is requested without Options.SchemaValidator.
+	_, err = c.PutConfig(ctx, cpc, limit{QPS: 100}, etcd.WithValidation())
+	test.Assert(t, errors.Is(err, etcd.ErrNoSchemaValidator), err)
+	errInvalid := errors.New("invalid")
+	c, err = NewClient(etcd.Options{SchemaValidator: func(category string, config interface{}) error {
+		if config.(limit).QPS < 0 {
+			return errInvalid
+		}
+		return nil
+	}})
+	test.Assert(t, err == nil, err)
+	_, err = c.PutConfig(ctx, cpc, limit{QPS: -1})
+	test.Assert(t, errors.Is(err, errInvalid), err)
+	_, err = c.PutConfig(ctx, cpc, limit{QPS: 100}, etcd.WithValidation())
+	test.Assert(t, err == nil, err)
+}
+
+func TestClientEncryption(t *testing.T) {
+	provider, err := source.NewStaticKeyProvider("k1", []byte("0123456789abcdef"))
+	test.Assert(t, err == nil, err)
+	c, err := NewClient(etcd.Options{KeyProvider: provider})
+	test.Assert(t, err == nil, err)
+	ctx := context.Background()
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	_, err = c.PutConfig(ctx, cpc, limit{QPS: 100}, etcd.WithEncryption())
+	test.Assert(t, err == nil, err)
+	value, _ := c.Value("/KitexConfig/s/limit")
+	test.Assert(t, source.IsEncrypted(value), value)
+
+	var got limit
+	err = c.RegisterConfigCallback(ctx, "/KitexConfig/s/limit", 1, func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
+		return parser.Decode(data, &got)
+	}, source.WithConfigParam(cpc))
+	test.Assert(t, err == nil && got.QPS == 100, got, err)
+}
+
+func TestClientSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	test.Assert(t, err == nil, err)
+	var events []*source.ConfigEvent
+	c, err := NewClient(etcd.Options{
+		TrustedKeys: map[string]ed25519.PublicKey{"k1": pub},
+		Listeners: []source.ConfigListener{source.ConfigListenerFunc(func(event *source.ConfigEvent) {
+			events = append(events, event)
+		})},
+	})
+	test.Assert(t, err == nil, err)
+	ctx := context.Background()
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	_, err = c.PutConfig(ctx, cpc, limit{QPS: 100}, etcd.WithSigningKey(&source.SigningKey{ID: "k1", Key: priv}))
+	test.Assert(t, err == nil, err)
+
+	var got limit
+	err = c.RegisterConfigCallback(ctx, "/KitexConfig/s/limit", 1, func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
+		return parser.Decode(data, &got)
+	}, source.WithConfigParam(cpc))
+	test.Assert(t, err == nil && got.QPS == 100, got, err)
+
+	// the unsigned value is rejected and the last good config is kept.
+	c.Put("/KitexConfig/s/limit", `{"qps":1}`)
+	test.Assert(t, errors.Is(c.Flush(), source.ErrUnsigned) && got.QPS == 100, got)
+	test.Assert(t, events[len(events)-1].Type == source.EventRejected, events)
+
+	// the value signed for another key is rejected.
+	other := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "other"}
+	_, err = c.PutConfig(ctx, other, limit{QPS: 1}, etcd.WithSigningKey(&source.SigningKey{ID: "k1", Key: priv}))
+	test.Assert(t, err == nil, err)
+	moved, _ := c.Value("/KitexConfig/other/limit")
+	c.Put("/KitexConfig/s/limit", moved)
+	test.Assert(t, errors.Is(c.Flush(), source.ErrBadSignature) && got.QPS == 100, got)
+	test.Assert(t, events[len(events)-1].Type == source.EventRejected, events)
+
+	// the deletion is not signed, so the last good config is kept.
+	test.Assert(t, c.DeleteConfig(ctx, cpc) == nil)
+	test.Assert(t, errors.Is(c.Flush(), source.ErrUnverifiedDeletion) && got.QPS == 100, got)
+}
+
+func TestClientHistory(t *testing.T) {
+	c, err := NewClient(etcd.Options{})
+	test.Assert(t, err == nil, err)
+	ctx := context.Background()
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	r1, _ := c.PutConfig(ctx, cpc, limit{QPS: 100})
+	_, _ = c.PutConfig(ctx, cpc, limit{QPS: 200})
+	test.Assert(t, c.DeleteConfig(ctx, cpc) == nil)
+
+	rev, err := c.Rollback(ctx, cpc, r1)
+	test.Assert(t, err == nil, err)
+	var l limit
+	_, err = c.GetConfig(ctx, cpc, &l)
+	test.Assert(t, err == nil && l.QPS == 100, l, err)
+	versions, err := c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 4, versions, err)
+	test.Assert(t, versions[0].Revision == rev && versions[0].Rollback == r1 && versions[1].Deleted, versions)
+	_, err = c.Rollback(ctx, cpc, rev+1)
+	test.Assert(t, errors.Is(err, etcd.ErrVersionNotFound), err)
+}
+
+func TestClientRollout(t *testing.T) {
+	ctx := context.Background()
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	writer, err := NewClient(etcd.Options{})
+	test.Assert(t, err == nil, err)
+	_, err = writer.PutConfig(ctx, cpc, limit{QPS: 200}, etcd.WithRollout(source.Rollout{Percent: 50}))
+	test.Assert(t, errors.Is(err, source.ErrConfigNotFound), err)
+	_, _ = writer.PutConfig(ctx, cpc, limit{QPS: 100})
+	_, err = writer.PutConfig(ctx, cpc, limit{QPS: 200}, etcd.WithRollout(source.Rollout{Instances: []string{"canary"}}))
+	test.Assert(t, err == nil, err)
+	// the stable value is kept when the rollout is raised.
+	_, err = writer.PutConfig(ctx, cpc, limit{QPS: 300}, etcd.WithRollout(source.Rollout{Instances: []string{"canary"}, Tags: []string{"zone=a"}}))
+	test.Assert(t, err == nil, err)
+	value, _ := writer.Value("/KitexConfig/s/limit")
+
+	for id, qps := range map[string]int{"canary": 300, "stable": 100} {
+		c, err := NewClient(etcd.Options{InstanceID: id})
+		test.Assert(t, err == nil, err)
+		c.Put("/KitexConfig/s/limit", value)
+		var got limit
+		_, err = c.GetConfig(ctx, cpc, &got)
+		test.Assert(t, err == nil && got.QPS == qps, id, got, err)
+	}
+}
+
+func TestClientStatus(t *testing.T) {
+	ctx := context.Background()
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	c, err := NewClient(etcd.Options{InstanceID: "a", ReportStatus: true})
+	test.Assert(t, err == nil, err)
+	rev := c.Put("/KitexConfig/s/limit", `{"qps":100}`)
+	err = c.RegisterConfigCallback(ctx, "/KitexConfig/s/limit", 1, func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
+		var l limit
+		if err := parser.Decode(data, &l); err != nil {
+			return err
+		}
+		if l.QPS < 0 {
+			return errors.New("negative qps")
+		}
+		return nil
+	}, source.WithConfigParam(cpc))
+	test.Assert(t, err == nil, err)
+	c.SetStatus(etcd.InstanceStatus{Instance: "b", Key: "/KitexConfig/s/limit", Revision: rev - 1})
+
+	status, err := c.Status(ctx, cpc)
+	test.Assert(t, err == nil && len(status.Applied()) == 1 && status.Applied()[0].Instance == "a", status, err)
+	test.Assert(t, len(status.Lagging()) == 1 && status.Lagging()[0].Instance == "b", status)
+
+	c.Put("/KitexConfig/s/limit", `{"qps":-1}`)
+	test.Assert(t, c.Flush() != nil)
+	status, _ = c.Status(ctx, cpc)
+	test.Assert(t, len(status.Failing()) == 1 && status.Failing()[0].Revision == rev, status)
+
+	// the status of the instance is deleted when the key is deregistered.
+	c.DeregisterConfig("/KitexConfig/s/limit", 1)
+	status, _ = c.Status(ctx, cpc)
+	test.Assert(t, len(status.Instances) == 1 && status.Instances[0].Instance == "b", status)
+
+	c, _ = NewClient(etcd.Options{})
+	_ = c.RegisterConfigCallback(ctx, "/KitexConfig/s/limit", 1, func(bool, string, etcd.ConfigParser, source.ConfigMeta) error {
+		return nil
+	}, source.WithConfigParam(cpc))
+	status, err = c.Status(ctx, cpc)
+	test.Assert(t, err == nil && len(status.Instances) == 0, status, err)
+}
+
+func TestClientOverride(t *testing.T) {
+	ctx := context.Background()
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	c, err := NewClient(etcd.Options{EnableOverrides: true})
+	test.Assert(t, err == nil, err)
+	_, _ = c.PutConfig(ctx, cpc, limit{QPS: 100})
+	var got limit
+	var restored bool
+	err = c.RegisterConfigCallback(ctx, "/KitexConfig/s/limit", 1, func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
+		restored = restoreDefault
+		got = limit{}
+		if restoreDefault {
+			return nil
+		}
+		return parser.Decode(data, &got)
+	}, source.WithConfigParam(cpc))
+	test.Assert(t, err == nil && got.QPS == 100, got, err)
+
+	_, err = c.PutOverride(ctx, cpc, limit{QPS: 500}, 30*time.Minute)
+	test.Assert(t, err == nil, err)
+	test.Assert(t, c.Flush() == nil && got.QPS == 500, got)
+	override, err := c.GetOverride(ctx, cpc)
+	test.Assert(t, err == nil && override.Key == "/KitexConfig/s/limit.override" && override.TTL > 29*time.Minute, override, err)
+
+	// the config is restored rather than the default one when the override expires.
+	c.ExpireOverrides(time.Now())
+	test.Assert(t, c.Pending() == 0)
+	c.ExpireOverrides(time.Now().Add(30 * time.Minute))
+	test.Assert(t, c.Flush() == nil && !restored && got.QPS == 100, got)
+	_, err = c.GetOverride(ctx, cpc)
+	test.Assert(t, errors.Is(err, source.ErrConfigNotFound), err)
+
+	_, _ = c.PutOverride(ctx, cpc, limit{QPS: 500}, time.Minute)
+	test.Assert(t, c.DeleteOverride(ctx, cpc) == nil)
+	test.Assert(t, c.Flush() == nil && got.QPS == 100, got)
+	c.DeregisterConfig("/KitexConfig/s/limit", 1)
+	test.Assert(t, len(c.RegisteredKeys()) == 0, c.RegisteredKeys())
+}
+
+func TestClientSchedule(t *testing.T) {
+	ctx := context.Background()
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	c, err := NewClient(etcd.Options{})
+	test.Assert(t, err == nil, err)
+	at := time.Date(2024, 11, 11, 20, 0, 0, 0, time.UTC)
+	c.SetTime(at.Add(-time.Hour))
+	_, err = c.PutConfig(ctx, cpc, limit{QPS: 100}, etcd.WithVariant(source.Window{From: at, To: at.Add(3 * time.Hour)}, limit{QPS: 500}))
+	test.Assert(t, err == nil, err)
+	var got limit
+	err = c.RegisterConfigCallback(ctx, "/KitexConfig/s/limit", 1, func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
+		return parser.Decode(data, &got)
+	}, source.WithConfigParam(cpc))
+	test.Assert(t, err == nil && got.QPS == 100, got, err)
+	test.Assert(t, c.Flush() == nil)
+
+	c.SetTime(at)
+	test.Assert(t, c.Pending() == 1)
+	test.Assert(t, c.Flush() == nil && got.QPS == 500, got)
+	c.SetTime(at.Add(3 * time.Hour))
+	test.Assert(t, c.Flush() == nil && got.QPS == 100, got)
+
+	_, err = c.PutConfig(ctx, cpc, limit{QPS: 100}, etcd.WithVariant(source.Window{From: at, To: at}, limit{QPS: 500}))
+	test.Assert(t, err != nil)
+}
+
+func TestClientLayers(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient(etcd.Options{EnableOverrides: true, HistoryLimit: 2})
+	test.Assert(t, err == nil, err)
+	cpc := &etcd.ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	c.Put("/KitexConfig/*/limit", `{"qps":100,"burst":10}`)
+	_, _ = c.PutConfig(ctx, cpc, map[string]int{"qps": 200})
+	var got map[string]int
+	err = c.RegisterConfigCallback(ctx, "/KitexConfig/s/limit", 1, func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
+		got = nil
+		if restoreDefault {
+			return nil
+		}
+		return parser.Decode(data, &got)
+	}, source.WithConfigParam(cpc), source.WithLayers("/KitexConfig/*/limit"))
+	test.Assert(t, err == nil && got["qps"] == 200 && got["burst"] == 10, got, err)
+	layers := c.Layers("/KitexConfig/s/limit", 1)
+	test.Assert(t, len(layers) == 2 && layers[0] == "/KitexConfig/*/limit" && layers[1] == "/KitexConfig/s/limit.override", layers)
+
+	c.Put("/KitexConfig/*/limit", `{"qps":100,"burst":20}`)
+	_, _ = c.PutOverride(ctx, cpc, map[string]int{"qps": 500}, time.Minute)
+	test.Assert(t, c.Flush() == nil && got["qps"] == 500 && got["burst"] == 20, got)
+
+	// the history is pruned to Options.HistoryLimit.
+	_, _ = c.PutConfig(ctx, cpc, map[string]int{"qps": 300})
+	_, _ = c.PutConfig(ctx, cpc, map[string]int{"qps": 400})
+	versions, err := c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 2, versions, err)
+
+	c.DeregisterConfig("/KitexConfig/s/limit", 1)
+	test.Assert(t, len(c.RegisteredKeys()) == 0, c.RegisteredKeys())
+}
@@ -0,0 +1,36 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import "github.com/kitex-contrib/config-etcd/source"
+
+// AddListener adds a listener of the events of all the callbacks.
+func (c *client) AddListener(listener source.ConfigListener) {
+	c.listenerMu.Lock()
+	defer c.listenerMu.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+func (c *client) publish(event *source.ConfigEvent, listeners []source.ConfigListener) {
+	c.listenerMu.RLock()
+	all := c.listeners
+	c.listenerMu.RUnlock()
+	for _, l := range all {
+		l.OnConfigEvent(event)
+	}
+	for _, l := range listeners {
+		l.OnConfigEvent(event)
+	}
+}
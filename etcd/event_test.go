@@ -0,0 +1,66 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+func TestConfigEvents(t *testing.T) {
+	var clientEvents, keyEvents []*source.ConfigEvent
+	c := &client{codec: &source.Codec{Parser: source.NewJSONParser()}, metrics: nopMetrics{}}
+	c.AddListener(source.ConfigListenerFunc(func(event *source.ConfigEvent) {
+		clientEvents = append(clientEvents, event)
+	}))
+	w := newWatcher(c, "/KitexConfig/", true)
+	errInvalid := errors.New("invalid")
+	callback := func(restoreDefault bool, data string, parser ConfigParser, meta source.ConfigMeta) error {
+		if data == "invalid" {
+			return errInvalid
+		}
+		return nil
+	}
+	kw := w.add("/KitexConfig/client/server/retry", 1, callback, &source.RegisterOptions{
+		Param: &ConfigParamConfig{Category: "retry", ClientServiceName: "client", ServerServiceName: "server"},
+		Listeners: []source.ConfigListener{source.ConfigListenerFunc(func(event *source.ConfigEvent) {
+			keyEvents = append(keyEvents, event)
+		})},
+	})
+
+	kw.update(10, 10, "v1")
+	kw.update(11, 11, "invalid")
+	kw.update(12, 12, "v2")
+	kw.update(13, 0, "")
+
+	test.Assert(t, len(clientEvents) == 4 && len(keyEvents) == 4)
+	for i, want := range []source.ConfigEvent{
+		{OldValue: "", NewValue: "v1", Revision: 10, Type: source.EventApplied},
+		{OldValue: "v1", NewValue: "invalid", Revision: 11, Type: source.EventRejected, Err: errInvalid},
+		{OldValue: "v1", NewValue: "v2", Revision: 12, Type: source.EventApplied},
+		{OldValue: "v2", NewValue: "", Revision: 0, Type: source.EventRestored},
+	} {
+		got := keyEvents[i]
+		test.Assert(t, got == clientEvents[i])
+		test.Assert(t, got.Key == kw.key && got.Category == "retry", got)
+		test.Assert(t, got.ClientServiceName == "client" && got.ServerServiceName == "server", got)
+		test.Assert(t, got.OldValue == want.OldValue && got.NewValue == want.NewValue, i, got)
+		test.Assert(t, got.Revision == want.Revision && got.Type == want.Type && got.Err == want.Err, i, got)
+	}
+}
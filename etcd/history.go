@@ -0,0 +1,302 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// DefaultHistoryLimit is the default number of the versions listed or kept of a key.
+	DefaultHistoryLimit = 20
+	// DefaultHistoryPrefix is the default prefix of the history records, which are stored at
+	// "{prefix}{key}/{unix nano}" out of the prefix watched.
+	DefaultHistoryPrefix = "/KitexConfigHistory/"
+
+	// historyInlineSize is the max size of a history record with the value inline, the larger
+	// values are written in chunks referred by the manifest in the record, so that the record adds
+	// little to the size of the write.
+	historyInlineSize = 4 << 10
+)
+
+// ErrVersionNotFound is returned by Rollback if the revision is not a version of the config in the history.
+var ErrVersionNotFound = errors.New("[etcd] config version not found")
+
+// ConfigVersion is a version of a config in the history.
+type ConfigVersion struct {
+	// Revision is the ModRevision of the version.
+	Revision int64
+	// Value is the raw value of the version, the chunked value is reassembled.
+	Value string
+	// Deleted is true if the config is deleted in the version.
+	Deleted bool
+	// Time is when the version is written, zero if it is unknown, i.e. the history is
+	// read from the MVCC revisions of etcd since the config is not written by the write API.
+	Time time.Time
+	// Rollback is the revision rolled back to by the version, zero if it is not a rollback.
+	Rollback int64
+}
+
+// historyRecord is the version of a config recorded by the write API.
+type historyRecord struct {
+	Value string `json:"value,omitempty"`
+	// Chunked is the manifest of the value written in the chunks under the history prefix if it is
+	// larger than historyInlineSize, and Value is empty then.
+	Chunked  string    `json:"chunked,omitempty"`
+	Deleted  bool      `json:"deleted,omitempty"`
+	Time     time.Time `json:"time"`
+	Rollback int64     `json:"rollback,omitempty"`
+}
+
+// historyKeys returns the prefix of the history records of key.
+func (c *client) historyKeys(key string) string {
+	return strings.TrimSuffix(c.historyPrefix, "/") + key + "/"
+}
+
+// historyChunks returns the key the chunks of the large values in the history records of key are
+// stored under, which is out of the prefix watched like the records.
+func (c *client) historyChunks(key string) string {
+	return strings.TrimSuffix(c.historyKeys(key), "/")
+}
+
+// historyOp returns the op to record the version of key, which is written in the same
+// transaction as the version, so that the record is created at the revision of the version.
+// The value larger than historyInlineSize is written in the chunks of size under historyChunks
+// first, and chunked is the manifest of them, which is deleted by the caller if the write fails.
+func (c *client) historyOp(ctx context.Context, key, value string, deleted bool, rollback int64, size int,
+) (op clientv3.Op, chunked string, err error) {
+	now := time.Now()
+	record := historyRecord{Value: value, Deleted: deleted, Time: now, Rollback: rollback}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return clientv3.Op{}, "", err
+	}
+	if _, ok := parseManifest(value); !ok && len(data) > historyInlineSize {
+		if record.Chunked, err = c.putChunks(ctx, c.historyChunks(key), value, size); err != nil {
+			return clientv3.Op{}, "", err
+		}
+		record.Value = ""
+		if data, err = json.Marshal(record); err != nil {
+			c.deleteChunks(c.historyChunks(key), record.Chunked)
+			return clientv3.Op{}, "", err
+		}
+	}
+	return clientv3.OpPut(fmt.Sprintf("%s%020d", c.historyKeys(key), now.UnixNano()), string(data)), record.Chunked, nil
+}
+
+// sortByCreateRevision sorts the history records in the order they are written, which does not
+// depend on the clocks of the writers in their keys.
+func sortByCreateRevision(kvs []*mvccpb.KeyValue) {
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].CreateRevision < kvs[j].CreateRevision
+	})
+}
+
+// pruneHistory deletes the oldest history records of key beyond Options.HistoryLimit, and
+// the chunks of them. The failure is only logged since the records are pruned by the next write.
+func (c *client) pruneHistory(key string) {
+	ctx, cancel := context.WithTimeout(c.ctx, c.etcdTimeout)
+	defer cancel()
+	resp, err := c.ecli.Get(ctx, c.historyKeys(key), clientv3.WithPrefix())
+	if err != nil {
+		klog.Warnf("[etcd] config key: %s get history failed: %v", key, err)
+		return
+	}
+	sortByCreateRevision(resp.Kvs)
+	for i := 0; i < len(resp.Kvs)-c.historyLimit; i++ {
+		kv := resp.Kvs[i]
+		if _, err = c.ecli.Delete(ctx, string(kv.Key)); err != nil {
+			klog.Warnf("[etcd] config key: %s delete history %s failed: %v", key, kv.Key, err)
+			return
+		}
+		var record historyRecord
+		if json.Unmarshal(kv.Value, &record) == nil {
+			c.deleteChunks(key, record.Value)
+			c.deleteChunks(c.historyChunks(key), record.Chunked)
+		}
+	}
+}
+
+// History lists the versions of the config of cpc from the newest, at most Options.HistoryLimit.
+// The versions are read from the history records of the write API, which keep the deletions and
+// the times of the versions. If the config has no records, e.g. it is written by etcdctl, they are
+// read from the MVCC revisions of etcd, which end at the compacted revision or the last deletion.
+func (c *client) History(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) ([]ConfigVersion, error) {
+	wo := NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := c.recordedHistory(ctx, key)
+	if err != nil || len(versions) > 0 {
+		return versions, err
+	}
+	return c.mvccHistory(ctx, key)
+}
+
+func (c *client) recordedHistory(ctx context.Context, key string) ([]ConfigVersion, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	resp, err := c.ecli.Get(ctx, c.historyKeys(key), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]ConfigVersion, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var record historyRecord
+		if err = json.Unmarshal(kv.Value, &record); err != nil {
+			return nil, fmt.Errorf("[etcd] malformed history record %s: %w", kv.Key, err)
+		}
+		value, owner := record.Value, key
+		if record.Chunked != "" {
+			value, owner = record.Chunked, c.historyChunks(key)
+		}
+		if assembled, err := c.readChunks(ctx, owner, value); err == nil {
+			value = assembled
+		}
+		versions = append(versions, ConfigVersion{
+			Revision: kv.CreateRevision,
+			Value:    value,
+			Deleted:  record.Deleted,
+			Time:     record.Time,
+			Rollback: record.Rollback,
+		})
+	}
+	return LatestVersions(versions, c.historyLimit), nil
+}
+
+// LatestVersions sorts versions from the newest, and returns at most limit of them. It is shared
+// by the Client implementations so that they list the same versions.
+func LatestVersions(versions []ConfigVersion, limit int) []ConfigVersion {
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Revision > versions[j].Revision
+	})
+	if len(versions) > limit {
+		versions = versions[:limit]
+	}
+	return versions
+}
+
+// FindVersion returns the version of key at revision in versions, or ErrVersionNotFound if it is
+// not in them.
+func FindVersion(key string, versions []ConfigVersion, revision int64) (ConfigVersion, error) {
+	for _, v := range versions {
+		if v.Revision == revision {
+			return v, nil
+		}
+	}
+	return ConfigVersion{}, fmt.Errorf("%w: %s at revision %d", ErrVersionNotFound, key, revision)
+}
+
+// mvccHistory walks back the versions of key from the current one by the MVCC revisions.
+func (c *client) mvccHistory(ctx context.Context, key string) ([]ConfigVersion, error) {
+	var versions []ConfigVersion
+	var rev int64
+	for len(versions) < c.historyLimit {
+		version, prev, err := c.mvccVersion(ctx, key, rev)
+		if errors.Is(err, rpctypes.ErrCompacted) || errors.Is(err, ErrVersionNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+		if prev == 0 {
+			break
+		}
+		rev = prev
+	}
+	return versions, nil
+}
+
+// mvccVersion reads the version of key at rev, the current one if rev is zero, and returns the
+// revision to read the previous version at, zero if it is the first version since the key is created.
+func (c *client) mvccVersion(ctx context.Context, key string, rev int64) (ConfigVersion, int64, error) {
+	getCtx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	resp, err := c.ecli.Get(getCtx, key, clientv3.WithRev(rev))
+	if err != nil {
+		return ConfigVersion{}, 0, err
+	}
+	if resp.Count == 0 {
+		return ConfigVersion{}, 0, ErrVersionNotFound
+	}
+	kv := resp.Kvs[0]
+	value := string(kv.Value)
+	// the chunks of the replaced values are kept until the revision is compacted.
+	if assembled, err := c.readChunksAt(ctx, key, value, kv.ModRevision); err == nil {
+		value = assembled
+	}
+	version := ConfigVersion{Revision: kv.ModRevision, Value: value}
+	if kv.Version == 1 {
+		return version, 0, nil
+	}
+	return version, kv.ModRevision - 1, nil
+}
+
+// Rollback writes the value of the version at revision of the config of cpc as a new version,
+// and returns the ModRevision of it. The value is written as is, so it keeps the signature and the
+// encryption of the version, unless WithSigningKey signs it again, which is required if the readers
+// verify the signatures since they reject the values signed earlier than the ones applied.
+// It returns ErrVersionNotFound if the version is not in the history.
+func (c *client) Rollback(ctx context.Context, cpc *ConfigParamConfig, revision int64, opts ...WriteOption) (int64, error) {
+	wo := NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return 0, err
+	}
+	var version ConfigVersion
+	versions, err := c.recordedHistory(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) > 0 {
+		if version, err = FindVersion(key, versions, revision); err != nil {
+			return 0, err
+		}
+	} else {
+		if version, _, err = c.mvccVersion(ctx, key, revision); err != nil {
+			if errors.Is(err, rpctypes.ErrCompacted) {
+				err = ErrVersionNotFound
+			}
+			return 0, fmt.Errorf("%w: %s at revision %d", err, key, revision)
+		}
+		if version.Revision != revision {
+			return 0, fmt.Errorf("%w: %s at revision %d", ErrVersionNotFound, key, revision)
+		}
+	}
+	if _, ok := parseManifest(version.Value); ok {
+		return 0, fmt.Errorf("[etcd] the chunks of %s at revision %d are not available", key, revision)
+	}
+	if version.Deleted {
+		return c.deleteValue(ctx, key, wo, revision)
+	}
+	value, err := c.encoder.EncodeRollback(key, version.Value, wo)
+	if err != nil {
+		return 0, err
+	}
+	return c.putValue(ctx, key, value, wo, revision)
+}
@@ -0,0 +1,208 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+func newHistoryClient(t *testing.T, kv *testKV, prefix string, limit int) *client {
+	renderer, err := source.NewKeyRenderer(source.KeyOptions{})
+	test.Assert(t, err == nil, err)
+	codec := &source.Codec{Parser: source.NewJSONParser()}
+	return &client{
+		KeyRenderer:   renderer,
+		ecli:          &clientv3.Client{KV: kv},
+		ctx:           context.Background(),
+		etcdTimeout:   time.Second,
+		codec:         codec,
+		encoder:       &ValueEncoder{Codec: codec},
+		historyPrefix: prefix,
+		historyLimit:  limit,
+	}
+}
+
+func TestMVCCHistory(t *testing.T) {
+	kv := &testKV{}
+	c := newHistoryClient(t, kv, "", DefaultHistoryLimit)
+	ctx := context.Background()
+	cpc := &ConfigParamConfig{Category: "retry", ClientServiceName: "c", ServerServiceName: "s"}
+	key := "/KitexConfig/c/s/retry"
+
+	versions, err := c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 0, versions, err)
+	v1 := kv.put(key, "v1")
+	kv.put("/KitexConfig/c/s/limit", "other")
+	v2 := kv.put(key, "v2")
+	kv.put(key, "v3")
+	versions, err = c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 3, versions, err)
+	test.Assert(t, versions[0].Value == "v3" && versions[1].Revision == v2 && versions[2].Revision == v1, versions)
+	test.Assert(t, versions[2].Value == "v1" && versions[2].Time.IsZero(), versions)
+
+	// the chunks of the replaced value are read at its revision.
+	m := &chunkManifest{generation: "g1", count: 1, sum: checksum("v4")}
+	kv.put(chunkKey(key, "g1", 0), "v4")
+	v4 := kv.put(key, m.String())
+	kv.Delete(ctx, key+chunkKeySeparator, clientv3.WithPrefix())
+	kv.put(key, "v5")
+	versions, err = c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 5 && versions[1].Revision == v4 && versions[1].Value == "v4", versions, err)
+
+	// the history ends at the compacted revision.
+	kv.compacted = v2
+	versions, err = c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 4, versions, err)
+	_, err = c.Rollback(ctx, cpc, v1)
+	test.Assert(t, errors.Is(err, ErrVersionNotFound), err)
+	_, err = c.Rollback(ctx, cpc, v4-1)
+	test.Assert(t, errors.Is(err, ErrVersionNotFound), err)
+
+	// the history ends at the last deletion.
+	kv.Delete(ctx, key)
+	kv.put(key, "v6")
+	versions, err = c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 1 && versions[0].Value == "v6", versions, err)
+}
+
+func TestDeleteRollback(t *testing.T) {
+	kv := &testKV{}
+	c := newHistoryClient(t, kv, DefaultHistoryPrefix, DefaultHistoryLimit)
+	ctx := context.Background()
+	cpc := &ConfigParamConfig{Category: "retry", ClientServiceName: "c", ServerServiceName: "s"}
+	key := "/KitexConfig/c/s/retry"
+
+	v1, err := c.PutConfig(ctx, cpc, map[string]int{"max": 1})
+	test.Assert(t, err == nil, err)
+	v2, err := c.PutConfig(ctx, cpc, map[string]int{"max": 2})
+	test.Assert(t, err == nil, err)
+	test.Assert(t, c.DeleteConfig(ctx, cpc) == nil)
+
+	// the history is recorded out of the prefix with the times, and is kept across the deletion.
+	versions, err := c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 3, versions, err)
+	test.Assert(t, versions[0].Deleted && versions[1].Revision == v2 && versions[2].Revision == v1, versions)
+	test.Assert(t, versions[1].Value == `{"max":2}` && !versions[1].Time.IsZero(), versions)
+	values, err := c.ListConfigs(ctx, "/KitexConfig/")
+	test.Assert(t, err == nil && len(values) == 0, values, err)
+
+	// the deleted config is rolled back to the version before the deletion.
+	rev, err := c.Rollback(ctx, cpc, v2)
+	test.Assert(t, err == nil, err)
+	v, err := c.GetValue(ctx, key)
+	test.Assert(t, err == nil && v.Value == `{"max":2}` && v.ModRevision == rev, v, err)
+	versions, _ = c.History(ctx, cpc)
+	test.Assert(t, len(versions) == 4 && versions[0].Rollback == v2, versions)
+	values, _ = c.ListConfigs(ctx, "/KitexConfig/")
+	test.Assert(t, len(values) == 1 && values[0].Key == key, values)
+}
+
+func TestRecordedHistory(t *testing.T) {
+	kv := &testKV{}
+	c := newHistoryClient(t, kv, "/KitexConfigHistory", 2)
+	ctx := context.Background()
+	cpc := &ConfigParamConfig{Category: "retry", ClientServiceName: "c", ServerServiceName: "s"}
+	key := "/KitexConfig/c/s/retry"
+	now := time.Now()
+	record := func(i int, r historyRecord) int64 {
+		data, err := json.Marshal(r)
+		test.Assert(t, err == nil, err)
+		return kv.put(fmt.Sprintf("%s%020d", c.historyKeys(key), i), string(data))
+	}
+
+	m := &chunkManifest{generation: "g1", count: 1, sum: checksum("v1")}
+	kv.put(chunkKey(key, "g1", 0), "v1")
+	record(1, historyRecord{Value: m.String(), Time: now})
+	r2 := record(2, historyRecord{Deleted: true, Time: now.Add(time.Second)})
+	r3 := record(3, historyRecord{Value: "v3", Time: now.Add(2 * time.Second), Rollback: r2})
+
+	versions, err := c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 2, versions, err)
+	test.Assert(t, versions[0].Revision == r3 && versions[0].Value == "v3" && versions[0].Rollback == r2, versions)
+	test.Assert(t, versions[1].Deleted && versions[1].Time.Equal(now.Add(time.Second)), versions)
+
+	c.historyLimit = 3
+	versions, _ = c.History(ctx, cpc)
+	test.Assert(t, len(versions) == 3 && versions[2].Value == "v1", versions)
+
+	// the oldest records and their chunks are pruned.
+	c.historyLimit = 2
+	c.pruneHistory(key)
+	c.historyLimit = 3
+	versions, _ = c.History(ctx, cpc)
+	test.Assert(t, len(versions) == 2, versions)
+	resp, _ := kv.Get(ctx, chunkPrefix(key, "g1"), clientv3.WithPrefix())
+	test.Assert(t, resp.Count == 0, resp.Kvs)
+
+	_, err = c.Rollback(ctx, cpc, r3+1)
+	test.Assert(t, errors.Is(err, ErrVersionNotFound), err)
+
+	// the records are ordered and pruned by the revisions they are created at rather than the
+	// times in their keys, which depend on the clocks of the writers.
+	r5 := record(5, historyRecord{Value: "v5", Time: now})
+	r4 := record(4, historyRecord{Value: "v4", Time: now})
+	c.historyLimit = 2
+	c.pruneHistory(key)
+	versions, _ = c.History(ctx, cpc)
+	test.Assert(t, len(versions) == 2 && versions[0].Revision == r4 && versions[1].Revision == r5, versions)
+}
+
+func TestLargeHistory(t *testing.T) {
+	kv := &testKV{}
+	c := newHistoryClient(t, kv, DefaultHistoryPrefix, DefaultHistoryLimit)
+	ctx := context.Background()
+	cpc := &ConfigParamConfig{Category: "retry", ClientServiceName: "c", ServerServiceName: "s"}
+	key := "/KitexConfig/c/s/retry"
+
+	// the value below the chunk size is written as is, and its copy in the record is chunked.
+	config := map[string]string{"data": strings.Repeat("x", 2*historyInlineSize)}
+	rev, err := c.PutConfig(ctx, cpc, config, WithChunkSize(4*historyInlineSize))
+	test.Assert(t, err == nil, err)
+	resp, _ := kv.Get(ctx, key)
+	_, chunked := parseManifest(string(resp.Kvs[0].Value))
+	test.Assert(t, !chunked, "the value is chunked below the chunk size")
+	resp, _ = kv.Get(ctx, c.historyKeys(key), clientv3.WithPrefix())
+	test.Assert(t, resp.Count == 1 && len(resp.Kvs[0].Value) < historyInlineSize, len(resp.Kvs[0].Value))
+	// the chunks of the record are out of the prefix watched.
+	resp, _ = kv.Get(ctx, "/KitexConfig/", clientv3.WithPrefix())
+	test.Assert(t, resp.Count == 1, resp.Kvs)
+	resp, _ = kv.Get(ctx, c.historyChunks(key)+chunkKeySeparator, clientv3.WithPrefix())
+	test.Assert(t, resp.Count == 1, resp.Count)
+
+	versions, err := c.History(ctx, cpc)
+	test.Assert(t, err == nil && len(versions) == 1 && versions[0].Revision == rev, versions, err)
+	var got map[string]string
+	test.Assert(t, json.Unmarshal([]byte(versions[0].Value), &got) == nil && got["data"] == config["data"])
+	_, err = c.Rollback(ctx, cpc, rev)
+	test.Assert(t, err == nil, err)
+
+	// the chunks are deleted with the pruned record.
+	c.historyLimit = 1
+	_, err = c.PutConfig(ctx, cpc, map[string]string{"data": "y"})
+	test.Assert(t, err == nil, err)
+	resp, _ = kv.Get(ctx, c.historyChunks(key)+chunkKeySeparator, clientv3.WithPrefix())
+	test.Assert(t, resp.Count == 0, resp.Count)
+}
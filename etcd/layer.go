@@ -0,0 +1,55 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+type layerID struct {
+	key      string
+	uniqueID int64
+}
+
+// registerLayers registers the callback on key and its layers.
+func (c *client) registerLayers(ctx context.Context, key string, uniqueID int64, callback source.ConfigCallback, ro *source.RegisterOptions) error {
+	c.m.Lock()
+	if c.layers == nil {
+		c.layers = make(map[layerID][]string)
+	}
+	layers := append([]string{}, ro.Layers...)
+	if ro.Override != "" {
+		layers = append(layers, ro.Override)
+	}
+	c.layers[layerID{key, uniqueID}] = layers
+	c.m.Unlock()
+	return source.RegisterLayers(key, callback, ro, func(k string, cb source.ConfigCallback) error {
+		return c.register(ctx, k, uniqueID, cb, ro)
+	})
+}
+
+// deregisterLayers deregisters the callback on the layers of key.
+func (c *client) deregisterLayers(key string, uniqueID int64) {
+	c.m.Lock()
+	id := layerID{key, uniqueID}
+	layers := c.layers[id]
+	delete(c.layers, id)
+	c.m.Unlock()
+	for _, layer := range layers {
+		c.deregister(layer, uniqueID)
+	}
+}
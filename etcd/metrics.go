@@ -0,0 +1,45 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+// Metrics reports the health of the config sync. The methods are called synchronously
+// while the configs are delivered, so they should not block.
+type Metrics interface {
+	// UpdateReceived is called when a new value of key is delivered to a callback.
+	UpdateReceived(category, key string)
+	// ParseFailed is called when the value of key can not be decoded.
+	ParseFailed(category, key string)
+	// Rejected is called when the value of key is decoded but rejected, e.g. by the validators.
+	Rejected(category, key string)
+	// Applied is called when the value of key at revision is applied, revision is zero
+	// if the key is deleted and the default config is restored.
+	Applied(category, key string, revision int64)
+	// Synced is called when the value of key is confirmed to be up to date with etcd.
+	Synced(key string)
+	// WatchRestarted is called when the broken etcd watch of prefix is restarted.
+	WatchRestarted(prefix string)
+	// ActiveWatches is called with the number of the etcd watches when it changes.
+	ActiveWatches(n int)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) UpdateReceived(category, key string)          {}
+func (nopMetrics) ParseFailed(category, key string)             {}
+func (nopMetrics) Rejected(category, key string)                {}
+func (nopMetrics) Applied(category, key string, revision int64) {}
+func (nopMetrics) Synced(key string)                            {}
+func (nopMetrics) WatchRestarted(prefix string)                 {}
+func (nopMetrics) ActiveWatches(n int)                          {}
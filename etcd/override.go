@@ -0,0 +1,124 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+// OverrideSuffix is appended to a config key to get the key of its temporary override.
+const OverrideSuffix = source.OverrideSuffix
+
+// OverrideKey returns the key of the temporary override of key.
+func OverrideKey(key string) string {
+	return source.OverrideKey(key)
+}
+
+// ConfigOverride is the temporary override of a config.
+type ConfigOverride struct {
+	Key         string
+	Value       string
+	ModRevision int64
+	// TTL is the time left before the override expires.
+	TTL time.Duration
+}
+
+// PutOverride validates the typed config of the category of cpc, and writes it as the override of
+// the config bound to a lease of ttl, so that it is deleted when ttl elapses. The clients with
+// Options.EnableOverrides deep-merge the override on top of the config like a layer, and restore
+// the config once it is deleted. WithModRevision compares the ModRevision of the override.
+// The override is neither chunked nor recorded in the history.
+func (c *client) PutOverride(ctx context.Context, cpc *ConfigParamConfig, config interface{}, ttl time.Duration, opts ...WriteOption) (int64, error) {
+	wo := NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return 0, err
+	}
+	key = OverrideKey(key)
+	value, err := c.encoder.EncodeOverride(key, cpc.Category, config, wo)
+	if err != nil {
+		return 0, err
+	}
+	grantCtx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	lease, err := c.ecli.Grant(grantCtx, leaseTTL(ttl))
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.txn(ctx, key, wo, clientv3.OpPut(key, value, clientv3.WithLease(lease.ID)))
+	if err != nil {
+		revokeCtx, cancel := context.WithTimeout(context.Background(), c.etcdTimeout)
+		defer cancel()
+		_, _ = c.ecli.Revoke(revokeCtx, lease.ID)
+		return 0, err
+	}
+	return resp.Header.Revision, nil
+}
+
+// leaseTTL returns ttl in seconds rounded up, at least one second.
+func leaseTTL(ttl time.Duration) int64 {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// GetOverride returns the override of the config of cpc, or source.ErrConfigNotFound if there is none.
+func (c *client) GetOverride(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) (ConfigOverride, error) {
+	wo := NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return ConfigOverride{}, err
+	}
+	key = OverrideKey(key)
+	ctx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	resp, err := c.ecli.Get(ctx, key)
+	if err != nil {
+		return ConfigOverride{}, err
+	}
+	if resp.Count == 0 {
+		return ConfigOverride{}, source.ErrConfigNotFound
+	}
+	kv := resp.Kvs[0]
+	override := ConfigOverride{Key: key, Value: string(kv.Value), ModRevision: kv.ModRevision}
+	if kv.Lease != 0 {
+		ttl, err := c.ecli.TimeToLive(ctx, clientv3.LeaseID(kv.Lease))
+		if err != nil {
+			return ConfigOverride{}, err
+		}
+		override.TTL = time.Duration(ttl.TTL) * time.Second
+	}
+	return override, nil
+}
+
+// DeleteOverride deletes the override of the config of cpc before it expires, so that the
+// clients restore the config.
+func (c *client) DeleteOverride(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) error {
+	wo := NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return err
+	}
+	key = OverrideKey(key)
+	_, err = c.txn(ctx, key, wo, clientv3.OpDelete(key))
+	return err
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+func TestRegisterOverride(t *testing.T) {
+	var got map[string]int
+	var restored bool
+	callbacks := make(map[string]source.ConfigCallback)
+	ro := &source.RegisterOptions{Layers: []string{"global"}, Override: OverrideKey("key")}
+	err := source.RegisterLayers("key", func(restoreDefault bool, data string, parser ConfigParser, meta source.ConfigMeta) error {
+		restored = restoreDefault
+		got = map[string]int{}
+		if restoreDefault {
+			return nil
+		}
+		return parser.Decode(data, &got)
+	}, ro, func(key string, cb source.ConfigCallback) error {
+		callbacks[key] = cb
+		return nil
+	})
+	test.Assert(t, err == nil && restored && len(callbacks) == 3, err, callbacks)
+
+	json := source.NewJSONParser()
+	test.Assert(t, callbacks["key"](false, `{"qps_limit":100,"connection_limit":10}`, json, source.ConfigMeta{Revision: 1}) == nil)
+	test.Assert(t, callbacks["key.override"](false, `{"qps_limit":500}`, json, source.ConfigMeta{Revision: 2}) == nil)
+	test.Assert(t, got["qps_limit"] == 500 && got["connection_limit"] == 10, got)
+	test.Assert(t, callbacks["global"](false, `{"qps_limit":50}`, json, source.ConfigMeta{Revision: 3}) == nil)
+	test.Assert(t, got["qps_limit"] == 500, got)
+
+	// the config is restored when the override expires.
+	test.Assert(t, callbacks["key.override"](true, "", json, source.ConfigMeta{}) == nil)
+	test.Assert(t, !restored && got["qps_limit"] == 100, got)
+}
+
+func TestLeaseTTL(t *testing.T) {
+	test.Assert(t, leaseTTL(30*time.Minute) == 1800)
+	test.Assert(t, leaseTTL(1500*time.Millisecond) == 2)
+	test.Assert(t, leaseTTL(0) == 1)
+}
@@ -15,44 +15,31 @@
 package etcd
 
 import (
-	"encoding/json"
 	"time"
+
+	"github.com/kitex-contrib/config-etcd/source"
 )
 
 const (
 	EtcdDefaultNode         = "http://127.0.0.1:2379"
-	EtcdDefaultConfigPrefix = "/KitexConfig"
+	EtcdDefaultConfigPrefix = source.DefaultConfigPrefix
 	EtcdDefaultTimeout      = 5 * time.Second
-	EtcdDefaultClientPath   = "{{.ClientServiceName}}/{{.ServerServiceName}}/{{.Category}}"
-	EtcdDefaultServerPath   = "{{.ServerServiceName}}/{{.Category}}"
+	EtcdDefaultClientPath   = source.DefaultClientPath
+	EtcdDefaultServerPath   = source.DefaultServerPath
 )
 
-var _ ConfigParser = &parser{}
-
-// CustomFunction use for customize the config parameters.
-type CustomFunction func(*Key)
-
-// ConfigParamConfig use for render the path or prefix info by go template, ref: https://pkg.go.dev/text/template
-// The fixed key shows as below.
-type ConfigParamConfig struct {
-	Category          string
-	ClientServiceName string
-	ServerServiceName string
-}
-
-// ConfigParser the parser for etcd config.
-type ConfigParser interface {
-	Decode(data string, config interface{}) error
-}
-
-type parser struct{}
-
-// Decode decodes the data to struct in specified format.
-func (p *parser) Decode(data string, config interface{}) error {
-	return json.Unmarshal([]byte(data), config)
-}
+// The path formats of the layers commonly used under the client config path, see source.GlobalClientPathLayer.
+const (
+	EtcdGlobalClientPathLayer = source.GlobalClientPathLayer
+	EtcdServerClientPathLayer = source.ServerClientPathLayer
+	EtcdGlobalServerPathLayer = source.GlobalServerPathLayer
+)
 
-// DefaultConfigParse default etcd config parser.
-func defaultConfigParse() ConfigParser {
-	return &parser{}
-}
+// Key, CustomFunction, ConfigParamConfig and ConfigParser are defined in the source package,
+// which is shared by the implementations of source.ConfigSource.
+type (
+	Key               = source.Key
+	CustomFunction    = source.CustomFunction
+	ConfigParamConfig = source.ConfigParamConfig
+	ConfigParser      = source.ConfigParser
+)
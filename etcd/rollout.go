@@ -0,0 +1,51 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+// rolloutValue returns the rollout envelope of candidate with the stable value of key, which is
+// the current value, or the stable value of it if it is in the rollout envelope already.
+// The write is made conditional on the revision of the stable value if it is not yet.
+func (e *ValueEncoder) rolloutValue(key, candidate string, wo *WriteOptions,
+	currentValue func() (source.ConfigValue, error),
+) (string, error) {
+	current, err := currentValue()
+	if errors.Is(err, source.ErrConfigNotFound) {
+		return "", fmt.Errorf("%w: the rollout of %s requires a stable config", err, key)
+	}
+	if err != nil {
+		return "", err
+	}
+	stable := current.Value
+	if unsigned := source.Unsign(stable); source.IsRollout(unsigned) {
+		v, err := source.ParseRollout(unsigned)
+		if err != nil {
+			return "", err
+		}
+		stable = v.Stable
+	}
+	if !wo.Compare {
+		wo.Compare = true
+		wo.ExpectedRevision = current.ModRevision
+	}
+	v := &source.RolloutValue{Rollout: *wo.Rollout, Stable: stable, Candidate: candidate}
+	return v.String(), nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+// ConfigVariant is a typed config applying in the window, see WithVariant.
+type ConfigVariant struct {
+	Window source.Window
+	Config interface{}
+}
+
+// scheduleValue returns the schedule envelope of the default value and the variants in wo,
+// which are validated and sealed like the default one.
+func (e *ValueEncoder) scheduleValue(key, category, value string, wo *WriteOptions) (string, error) {
+	v := &source.ScheduledValue{Default: value}
+	for _, variant := range wo.Variants {
+		if err := source.CheckWindow(variant.Window); err != nil {
+			return "", err
+		}
+		if err := ValidateSchema(e.SchemaValidator, category, variant.Config, wo); err != nil {
+			return "", err
+		}
+		sealed, err := e.seal(key, category, variant.Config, wo)
+		if err != nil {
+			return "", err
+		}
+		v.Variants = append(v.Variants, source.ScheduledVariant{Window: variant.Window, Value: sealed})
+	}
+	return v.String(), nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+func TestWatchSchedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &client{ctx: ctx, codec: &source.Codec{Parser: source.NewJSONParser()}, metrics: nopMetrics{}}
+	w := newWatcher(c, "/KitexConfig/", true)
+	var mu sync.Mutex
+	var got []int
+	kw := w.add("/KitexConfig/s/limit", 1, func(restoreDefault bool, data string, parser ConfigParser, meta source.ConfigMeta) error {
+		var config map[string]int
+		if err := parser.Decode(data, &config); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, config["qps_limit"])
+		return nil
+	}, &source.RegisterOptions{})
+	now := time.Now()
+	v := &source.ScheduledValue{
+		Default:  `{"qps_limit":100}`,
+		Variants: []source.ScheduledVariant{{Window: source.Window{From: now.Add(100 * time.Millisecond), To: now.Add(300 * time.Millisecond)}, Value: `{"qps_limit":500}`}},
+	}
+	kw.update(1, 1, v.String())
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	test.Assert(t, len(got) == 2 && got[0] == 100 && got[1] == 500, got)
+	mu.Unlock()
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	test.Assert(t, len(got) == 3 && got[2] == 100, got)
+	mu.Unlock()
+
+	// the boundary is not delivered once the value is replaced.
+	v.Variants[0].Window = source.Window{From: time.Now().Add(100 * time.Millisecond)}
+	kw.update(2, 2, v.String())
+	kw.update(3, 3, `{"qps_limit":200}`)
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	test.Assert(t, len(got) == 5 && got[4] == 200, got)
+	mu.Unlock()
+}
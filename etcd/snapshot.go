@@ -0,0 +1,100 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshot is the last-known-good value of a key persisted on the local disk.
+type snapshot struct {
+	Key      string    `json:"key"`
+	Value    string    `json:"value"`
+	Revision int64     `json:"revision"`
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+// snapshotStore persists the values applied successfully, one file for each key,
+// so that they can be used when etcd is unreachable.
+type snapshotStore struct {
+	dir string
+}
+
+func newSnapshotStore(dir string) (*snapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &snapshotStore{dir: dir}, nil
+}
+
+func (s *snapshotStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".json")
+}
+
+// load returns the snapshot of key, or nil if there is not any.
+func (s *snapshotStore) load(key string) (*snapshot, error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	snap := &snapshot{}
+	if err = json.Unmarshal(data, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// save writes the snapshot of key atomically.
+func (s *snapshotStore) save(key, value string, revision int64) error {
+	data, err := json.Marshal(&snapshot{
+		Key:      key,
+		Value:    value,
+		Revision: revision,
+		SavedAt:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+// remove deletes the snapshot of key as the key is deleted from etcd.
+func (s *snapshotStore) remove(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
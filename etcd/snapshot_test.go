@@ -0,0 +1,40 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	s, err := newSnapshotStore(t.TempDir())
+	test.Assert(t, err == nil, err)
+	key := "/KitexConfig/ClientName/ServiceName/retry"
+
+	snap, err := s.load(key)
+	test.Assert(t, err == nil && snap == nil)
+
+	test.Assert(t, s.save(key, `{"*":{"enable":true}}`, 10) == nil)
+	snap, err = s.load(key)
+	test.Assert(t, err == nil, err)
+	test.Assert(t, snap.Key == key && snap.Value == `{"*":{"enable":true}}` && snap.Revision == 10)
+
+	test.Assert(t, s.remove(key) == nil)
+	test.Assert(t, s.remove(key) == nil)
+	snap, err = s.load(key)
+	test.Assert(t, err == nil && snap == nil)
+}
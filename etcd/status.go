@@ -0,0 +1,483 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+const (
+	// DefaultStatusTTL is the default TTL of the lease of the status keys.
+	DefaultStatusTTL = 30 * time.Second
+	// DefaultStatusPrefix is the default prefix of the status keys, which are stored at
+	// "{prefix}{service path}/{instance id}/{category}" out of the prefix watched.
+	DefaultStatusPrefix = "/KitexConfigStatus/"
+)
+
+var errLeaseLost = errors.New("status lease lost")
+
+// InstanceStatus is the status of a config key on an instance, which is reported to
+// "{StatusPrefix}{service path}/{instance id}/{category}" with a lease, so that it is
+// removed when the instance is gone.
+type InstanceStatus struct {
+	Instance          string `json:"instance"`
+	Key               string `json:"key"`
+	Category          string `json:"category,omitempty"`
+	ServerServiceName string `json:"server,omitempty"`
+	ClientServiceName string `json:"client,omitempty"`
+	// Revision is the ModRevision of the value applied, zero if the default config is restored.
+	Revision int64 `json:"revision"`
+	// AppliedAt is when the value at Revision is applied, zero if no value has been applied.
+	AppliedAt time.Time `json:"applied_at"`
+	// FromSnapshot is true if the value applied is loaded from the local snapshot.
+	FromSnapshot bool `json:"from_snapshot,omitempty"`
+	// Error is the error of the latest value which is rejected at ErrorRevision, it is empty
+	// if the latest value is applied.
+	Error         string `json:"error,omitempty"`
+	ErrorRevision int64  `json:"error_revision,omitempty"`
+}
+
+// Update updates the status with the event of delivering a value at now.
+func (s *InstanceStatus) Update(event *source.ConfigEvent, now time.Time) {
+	s.Key = event.Key
+	s.Category = event.Category
+	s.ServerServiceName = event.ServerServiceName
+	s.ClientServiceName = event.ClientServiceName
+	if event.Type == source.EventRejected {
+		s.ErrorRevision = event.Revision
+		if event.Err != nil {
+			s.Error = event.Err.Error()
+		}
+		return
+	}
+	s.Revision = event.Revision
+	s.AppliedAt = now
+	s.FromSnapshot = event.FromSnapshot
+	s.Error = ""
+	s.ErrorRevision = 0
+}
+
+// InstanceStatuses are the statuses of the keys registered on an instance, which are updated by
+// the events of the deliveries. The layers and the overrides of the keys have no status of their
+// own, so that there is one status per key registered. It is shared by the Client implementations
+// so that they report the same statuses, and it is not safe for concurrent use.
+type InstanceStatuses struct {
+	instance string
+	statuses map[string]*InstanceStatus
+	// registered are the callbacks registered on the keys, by uniqueID.
+	registered map[string]map[int64]bool
+}
+
+// NewInstanceStatuses creates the InstanceStatuses of instance.
+func NewInstanceStatuses(instance string) *InstanceStatuses {
+	return &InstanceStatuses{
+		instance:   instance,
+		statuses:   make(map[string]*InstanceStatus),
+		registered: make(map[string]map[int64]bool),
+	}
+}
+
+// Register records the callback of uniqueID registered on key, which is called before the
+// current value is delivered to it, so that the events of key update its status.
+func (s *InstanceStatuses) Register(key string, uniqueID int64) {
+	if s.registered[key] == nil {
+		s.registered[key] = make(map[int64]bool)
+	}
+	s.registered[key][uniqueID] = true
+}
+
+// Deregister removes the callback of uniqueID on key, and removes the status of key once no
+// callback is registered on it. It reports whether the status is removed.
+func (s *InstanceStatuses) Deregister(key string, uniqueID int64) bool {
+	delete(s.registered[key], uniqueID)
+	if len(s.registered[key]) > 0 {
+		return false
+	}
+	delete(s.registered, key)
+	if _, ok := s.statuses[key]; !ok {
+		return false
+	}
+	delete(s.statuses, key)
+	return true
+}
+
+// Update updates the status of the key of event with it at now, and returns the status. ok is
+// false if no callback is registered on the key, e.g. it is a layer, and the event is ignored.
+func (s *InstanceStatuses) Update(event *source.ConfigEvent, now time.Time) (status InstanceStatus, ok bool) {
+	if len(s.registered[event.Key]) == 0 {
+		return InstanceStatus{}, false
+	}
+	p, ok := s.statuses[event.Key]
+	if !ok {
+		p = &InstanceStatus{Instance: s.instance}
+		s.statuses[event.Key] = p
+	}
+	p.Update(event, now)
+	return *p, true
+}
+
+// Get returns the status of key, ok is false if key has no status.
+func (s *InstanceStatuses) Get(key string) (status InstanceStatus, ok bool) {
+	if p, ok := s.statuses[key]; ok {
+		return *p, true
+	}
+	return InstanceStatus{}, false
+}
+
+// Keys returns the keys which have a status.
+func (s *InstanceStatuses) Keys() []string {
+	keys := make([]string, 0, len(s.statuses))
+	for key := range s.statuses {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// ConfigStatus is the rollout progress of a config to the instances reporting its status.
+type ConfigStatus struct {
+	Key string
+	// Revision is the ModRevision of the config, zero if it does not exist.
+	Revision int64
+	// Instances are the statuses of the live instances, sorted by the instance id.
+	Instances []InstanceStatus
+}
+
+// NewConfigStatus returns the ConfigStatus of key at revision with the statuses of the instances.
+func NewConfigStatus(key string, revision int64, instances []InstanceStatus) *ConfigStatus {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Instance < instances[j].Instance
+	})
+	return &ConfigStatus{Key: key, Revision: revision, Instances: instances}
+}
+
+// Applied returns the instances which have applied the current revision.
+func (s *ConfigStatus) Applied() []InstanceStatus {
+	return s.filter(func(is InstanceStatus) bool {
+		return is.Error == "" && is.Revision == s.Revision
+	})
+}
+
+// Lagging returns the instances which have not received the current revision yet.
+func (s *ConfigStatus) Lagging() []InstanceStatus {
+	return s.filter(func(is InstanceStatus) bool {
+		return is.Error == "" && is.Revision != s.Revision
+	})
+}
+
+// Failing returns the instances which have rejected the latest value they received.
+func (s *ConfigStatus) Failing() []InstanceStatus {
+	return s.filter(func(is InstanceStatus) bool {
+		return is.Error != ""
+	})
+}
+
+func (s *ConfigStatus) filter(f func(InstanceStatus) bool) []InstanceStatus {
+	var instances []InstanceStatus
+	for _, is := range s.Instances {
+		if f(is) {
+			instances = append(instances, is)
+		}
+	}
+	return instances
+}
+
+// statusKeys returns the prefix of the status keys of the service path of key, and the category
+// of key, e.g. "/KitexConfigStatus/c/s/" and "retry" for "/KitexConfig/c/s/retry".
+func (c *client) statusKeys(key string) (prefix, category string) {
+	dir, category := path.Split(key)
+	if c.watchPrefix != "" && strings.HasPrefix(dir, c.watchPrefix) {
+		dir = strings.TrimPrefix(dir, c.watchPrefix)
+	}
+	return strings.TrimSuffix(c.statusPrefix, "/") + "/" + strings.TrimPrefix(dir, "/"), category
+}
+
+// statusKey returns the status key of key reported by instance.
+func (c *client) statusKey(key, instance string) string {
+	prefix, category := c.statusKeys(key)
+	return prefix + instance + "/" + category
+}
+
+// Status returns the statuses of the config of cpc reported by the live instances, see Options.ReportStatus.
+func (c *client) Status(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) (*ConfigStatus, error) {
+	wo := NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	resp, err := c.ecli.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var revision int64
+	if len(resp.Kvs) > 0 {
+		revision = resp.Kvs[0].ModRevision
+	}
+	prefix, category := c.statusKeys(key)
+	resp, err = c.ecli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]InstanceStatus, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		// skip the statuses of the other categories and of the services under the path.
+		if !strings.HasSuffix(string(kv.Key), "/"+category) {
+			continue
+		}
+		var status InstanceStatus
+		if err = json.Unmarshal(kv.Value, &status); err != nil {
+			return nil, fmt.Errorf("[etcd] malformed config status %s: %w", kv.Key, err)
+		}
+		if status.Key == key {
+			instances = append(instances, status)
+		}
+	}
+	return NewConfigStatus(key, revision, instances), nil
+}
+
+// statusReporter writes the statuses of the keys registered to their status keys with a lease kept
+// alive, the lease is revoked when the client is closed.
+type statusReporter struct {
+	c   *client
+	ttl time.Duration
+	// notify is signaled when a status is updated.
+	notify chan struct{}
+
+	mu       sync.Mutex
+	statuses *InstanceStatuses
+	// dirty are the keys whose status has not been written with the current lease.
+	dirty map[string]bool
+	// removed are the keys deregistered whose status has not been deleted yet.
+	removed map[string]bool
+}
+
+func newStatusReporter(c *client, ttl time.Duration) *statusReporter {
+	return &statusReporter{
+		c:        c,
+		ttl:      ttl,
+		notify:   make(chan struct{}, 1),
+		statuses: NewInstanceStatuses(c.codec.Instance.ID),
+		dirty:    make(map[string]bool),
+		removed:  make(map[string]bool),
+	}
+}
+
+// OnConfigEvent implements source.ConfigListener, the status is written in background.
+// The events of the layers and the overrides are ignored.
+func (r *statusReporter) OnConfigEvent(event *source.ConfigEvent) {
+	r.mu.Lock()
+	if _, ok := r.statuses.Update(event, time.Now()); !ok {
+		r.mu.Unlock()
+		return
+	}
+	r.dirty[event.Key] = true
+	delete(r.removed, event.Key)
+	r.mu.Unlock()
+	r.signal()
+}
+
+// register records the callback of uniqueID registered on key, so that the events of key are reported.
+func (r *statusReporter) register(key string, uniqueID int64) {
+	r.mu.Lock()
+	r.statuses.Register(key, uniqueID)
+	r.mu.Unlock()
+}
+
+// deregister deletes the status of key in background when no callback is registered on it, the
+// status written with the current lease is deleted, and the ones with the last leases are gone with them.
+func (r *statusReporter) deregister(key string, uniqueID int64) {
+	r.mu.Lock()
+	if !r.statuses.Deregister(key, uniqueID) {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.dirty, key)
+	r.removed[key] = true
+	r.mu.Unlock()
+	r.signal()
+}
+
+func (r *statusReporter) signal() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// start runs the reporter in background until the client is closed.
+func (r *statusReporter) start() {
+	r.c.wg.Add(1)
+	go func() {
+		defer r.c.wg.Done()
+		r.run(r.c.ctx)
+	}()
+}
+
+// run reports the statuses once the first one is updated, it grants a new lease with backoff
+// whenever the lease is lost or the statuses can not be written.
+func (r *statusReporter) run(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-r.notify:
+	}
+	interval := watchRetryMinInterval
+	for {
+		reported, err := r.report(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if reported {
+			interval = watchRetryMinInterval
+		}
+		if err != nil {
+			klog.Warnf("[etcd] report config status failed: %v, retry in %s", err, interval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > watchRetryMaxInterval {
+			interval = watchRetryMaxInterval
+		}
+	}
+}
+
+// report grants a lease and writes the statuses with it until ctx is done or the lease is lost,
+// the lease is revoked when it returns. reported reports whether any status has been written.
+func (r *statusReporter) report(ctx context.Context) (reported bool, err error) {
+	grantCtx, cancel := context.WithTimeout(ctx, r.c.etcdTimeout)
+	lease, err := r.c.ecli.Grant(grantCtx, int64(r.ttl/time.Second))
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	defer r.revoke(lease.ID)
+	keepAliveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	keepAlive, err := r.c.ecli.KeepAlive(keepAliveCtx, lease.ID)
+	if err != nil {
+		return false, err
+	}
+	// the statuses written with the last lease are gone with it.
+	r.mu.Lock()
+	for _, key := range r.statuses.Keys() {
+		r.dirty[key] = true
+	}
+	r.removed = make(map[string]bool)
+	r.mu.Unlock()
+	for {
+		if err = r.flush(ctx, lease.ID); err != nil {
+			return reported, err
+		}
+		reported = true
+		select {
+		case <-ctx.Done():
+			return reported, ctx.Err()
+		case _, ok := <-keepAlive:
+			if !ok {
+				return reported, errLeaseLost
+			}
+		case <-r.notify:
+		}
+	}
+}
+
+// flush writes the dirty statuses with lease, and deletes the statuses of the keys removed.
+func (r *statusReporter) flush(ctx context.Context, lease clientv3.LeaseID) error {
+	r.mu.Lock()
+	statuses := make(map[string]InstanceStatus, len(r.dirty))
+	for key := range r.dirty {
+		statuses[key], _ = r.statuses.Get(key)
+	}
+	removed := r.removed
+	r.dirty = make(map[string]bool)
+	r.removed = make(map[string]bool)
+	r.mu.Unlock()
+	err := func() error {
+		for key, status := range statuses {
+			if err := r.put(ctx, key, status, lease); err != nil {
+				return err
+			}
+			delete(statuses, key)
+		}
+		for key := range removed {
+			if err := r.delete(ctx, key); err != nil {
+				return err
+			}
+			delete(removed, key)
+		}
+		return nil
+	}()
+	if err != nil {
+		// retry the statuses not written or deleted unless they have been updated since.
+		r.mu.Lock()
+		for key := range statuses {
+			if _, ok := r.statuses.Get(key); ok {
+				r.dirty[key] = true
+			}
+		}
+		for key := range removed {
+			if _, ok := r.statuses.Get(key); !ok {
+				r.removed[key] = true
+			}
+		}
+		r.mu.Unlock()
+	}
+	return err
+}
+
+func (r *statusReporter) put(ctx context.Context, key string, status InstanceStatus, lease clientv3.LeaseID) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.c.etcdTimeout)
+	defer cancel()
+	_, err = r.c.ecli.Put(ctx, r.c.statusKey(key, status.Instance), string(data), clientv3.WithLease(lease))
+	return err
+}
+
+func (r *statusReporter) delete(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.c.etcdTimeout)
+	defer cancel()
+	_, err := r.c.ecli.Delete(ctx, r.c.statusKey(key, r.c.codec.Instance.ID))
+	return err
+}
+
+// revoke revokes the lease so that the statuses are removed at once, the failure is only
+// logged since they are removed when the lease expires.
+func (r *statusReporter) revoke(lease clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.c.etcdTimeout)
+	defer cancel()
+	if _, err := r.c.ecli.Revoke(ctx, lease); err != nil {
+		klog.Debugf("[etcd] revoke config status lease %x failed: %v", lease, err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+// testLease is an in-memory clientv3.Lease, it supports Grant, KeepAlive and Revoke.
+type testLease struct {
+	clientv3.Lease
+	mu      sync.Mutex
+	granted int
+	revoked []clientv3.LeaseID
+	// keepAlive is the channel of the last KeepAlive.
+	keepAlive chan *clientv3.LeaseKeepAliveResponse
+}
+
+func (l *testLease) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.granted++
+	return &clientv3.LeaseGrantResponse{ID: clientv3.LeaseID(l.granted), TTL: ttl}, nil
+}
+
+func (l *testLease) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keepAlive = make(chan *clientv3.LeaseKeepAliveResponse)
+	return l.keepAlive, nil
+}
+
+func (l *testLease) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.revoked = append(l.revoked, id)
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+func TestConfigStatus(t *testing.T) {
+	var s InstanceStatus
+	now := time.Now()
+	s.Update(&source.ConfigEvent{Key: "k", Category: "limit", Revision: 2, Type: source.EventApplied}, now)
+	test.Assert(t, s.Revision == 2 && s.AppliedAt == now && s.Error == "", s)
+	s.Update(&source.ConfigEvent{Key: "k", Revision: 3, Type: source.EventRejected, Err: errors.New("bad")}, now.Add(time.Second))
+	test.Assert(t, s.Revision == 2 && s.AppliedAt == now && s.Error == "bad" && s.ErrorRevision == 3, s)
+	s.Update(&source.ConfigEvent{Key: "k", Type: source.EventRestored}, now)
+	test.Assert(t, s.Revision == 0 && s.Error == "" && s.ErrorRevision == 0, s)
+
+	status := NewConfigStatus("k", 3, []InstanceStatus{
+		{Instance: "c", Revision: 2, Error: "bad", ErrorRevision: 3},
+		{Instance: "b", Revision: 2},
+		{Instance: "a", Revision: 3},
+	})
+	test.Assert(t, status.Instances[0].Instance == "a", status.Instances)
+	test.Assert(t, len(status.Applied()) == 1 && status.Applied()[0].Instance == "a", status.Applied())
+	test.Assert(t, len(status.Lagging()) == 1 && status.Lagging()[0].Instance == "b", status.Lagging())
+	test.Assert(t, len(status.Failing()) == 1 && status.Failing()[0].Instance == "c", status.Failing())
+}
+
+func TestInstanceStatuses(t *testing.T) {
+	s := NewInstanceStatuses("a")
+	now := time.Now()
+	s.Register("k", 1)
+	s.Register("k", 2)
+	_, ok := s.Update(&source.ConfigEvent{Key: "k", Revision: 2, Type: source.EventApplied}, now)
+	test.Assert(t, ok)
+	// the layers are not registered by themselves, so they have no status.
+	_, ok = s.Update(&source.ConfigEvent{Key: "layer", Revision: 3, Type: source.EventApplied}, now)
+	test.Assert(t, !ok && len(s.Keys()) == 1, s.Keys())
+
+	test.Assert(t, !s.Deregister("k", 1))
+	status, ok := s.Get("k")
+	test.Assert(t, ok && status.Instance == "a" && status.Revision == 2, status)
+	test.Assert(t, s.Deregister("k", 2))
+	_, ok = s.Get("k")
+	test.Assert(t, !ok)
+	_, ok = s.Update(&source.ConfigEvent{Key: "k", Revision: 4, Type: source.EventApplied}, now)
+	test.Assert(t, !ok)
+}
+
+func TestStatusReporter(t *testing.T) {
+	kv := &testKV{}
+	lease := &testLease{}
+	renderer, err := source.NewKeyRenderer(source.KeyOptions{})
+	test.Assert(t, err == nil, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &client{
+		KeyRenderer:  renderer,
+		ecli:         &clientv3.Client{KV: kv, Lease: lease},
+		ctx:          ctx,
+		etcdTimeout:  time.Second,
+		codec:        &source.Codec{Instance: source.Instance{ID: "a"}},
+		statusPrefix: DefaultStatusPrefix,
+		watchPrefix:  "/KitexConfig/",
+	}
+	cpc := &ConfigParamConfig{Category: "limit", ServerServiceName: "s"}
+	_, err = c.Status(ctx, cpc)
+	test.Assert(t, err == nil, err)
+
+	r := newStatusReporter(c, DefaultStatusTTL)
+	done := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(done)
+	}()
+	rev := kv.put("/KitexConfig/s/limit", `{"qps_limit":100}`)
+	r.register("/KitexConfig/s/limit", 1)
+	// the events of the layers are not reported.
+	r.OnConfigEvent(&source.ConfigEvent{Key: "/KitexConfig/limit", Category: "limit", Revision: rev, Type: source.EventApplied})
+	r.OnConfigEvent(&source.ConfigEvent{Key: "/KitexConfig/s/limit", Category: "limit", ServerServiceName: "s", Revision: rev, Type: source.EventApplied})
+	time.Sleep(100 * time.Millisecond)
+	status, err := c.Status(ctx, cpc)
+	test.Assert(t, err == nil && len(status.Applied()) == 1 && status.Instances[0].Instance == "a", status, err)
+	resp, _ := kv.Get(ctx, DefaultStatusPrefix, clientv3.WithPrefix())
+	test.Assert(t, len(resp.Kvs) == 1 && string(resp.Kvs[0].Key) == "/KitexConfigStatus/s/a/limit", resp.Kvs)
+	configs, err := c.ListConfigs(ctx, "")
+	test.Assert(t, err == nil && len(configs) == 1 && configs[0].Key == "/KitexConfig/s/limit", configs, err)
+
+	kv.put("/KitexConfig/s/limit", `{"qps_limit":200}`)
+	status, _ = c.Status(ctx, cpc)
+	test.Assert(t, len(status.Lagging()) == 1, status)
+
+	// the statuses are written again with a new lease when the lease is lost.
+	lease.mu.Lock()
+	close(lease.keepAlive)
+	lease.mu.Unlock()
+	time.Sleep(700 * time.Millisecond)
+	lease.mu.Lock()
+	test.Assert(t, lease.granted == 2 && len(lease.revoked) == 1, lease.granted, lease.revoked)
+	lease.mu.Unlock()
+
+	// the status is deleted when the key is deregistered.
+	r.deregister("/KitexConfig/s/limit", 1)
+	time.Sleep(100 * time.Millisecond)
+	status, _ = c.Status(ctx, cpc)
+	test.Assert(t, len(status.Instances) == 0, status)
+
+	cancel()
+	<-done
+	test.Assert(t, len(lease.revoked) == 2 && lease.revoked[1] == 2, lease.revoked)
+}
+
+func TestStatusKeys(t *testing.T) {
+	c := &client{watchPrefix: "/KitexConfig/", statusPrefix: DefaultStatusPrefix}
+	test.Assert(t, c.statusKey("/KitexConfig/c/s/retry", "a") == "/KitexConfigStatus/c/s/a/retry")
+	test.Assert(t, c.statusKey("/Other/s/limit", "a") == "/KitexConfigStatus/Other/s/a/limit")
+
+	c.watchPrefix, c.statusPrefix = "", "/Status"
+	test.Assert(t, c.statusKey("/c/s/retry", "a") == "/Status/c/s/a/retry")
+}
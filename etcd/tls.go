@@ -0,0 +1,147 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+)
+
+// certReloader loads the CA and the client certificate from files, and reloads them
+// when the files are modified, so that the rotated certificates take effect on the
+// next connection without restarting the process.
+type certReloader struct {
+	caFile   string
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	modTime time.Time
+	pool    *x509.CertPool
+	cert    *tls.Certificate
+}
+
+// newTLSConfig creates the tls config with the CA and the client certificate files.
+func newTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("[etcd] CertFile and KeyFile must be set at the same time")
+	}
+	r := &certReloader{caFile: caFile, certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		cfg.GetClientCertificate = r.getClientCertificate
+	}
+	if caFile != "" {
+		// RootCAs can not be replaced once the config is used, so the server certificate
+		// is verified by verifyConnection with the latest CA instead.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = r.verifyConnection
+	}
+	return cfg, nil
+}
+
+// latestModTime returns the latest modification time of the files.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.caFile, r.certFile, r.keyFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload loads the files if any of them has been modified since the last load.
+func (r *certReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	if !modTime.After(r.modTime) {
+		return nil
+	}
+	if r.caFile != "" {
+		ca, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("[etcd] no certificate found in CA file %s", r.caFile)
+		}
+		r.pool = pool
+	}
+	if r.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		r.cert = &cert
+	}
+	r.modTime = modTime
+	return nil
+}
+
+// current reloads the files if needed, and returns the latest CA and certificate.
+// The previous ones are kept if the files can not be loaded, e.g. during the rotation.
+func (r *certReloader) current() (*x509.CertPool, *tls.Certificate) {
+	if err := r.reload(); err != nil {
+		klog.Warnf("[etcd] reload tls certificates failed: %v, keep using the previous ones", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pool, r.cert
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, cert := r.current()
+	return cert, nil
+}
+
+func (r *certReloader) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("[etcd] no server certificate presented")
+	}
+	pool, _ := r.current()
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
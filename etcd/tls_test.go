@@ -0,0 +1,126 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.Assert(t, err == nil, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	test.Assert(t, err == nil, err)
+	cert, err := x509.ParseCertificate(der)
+	test.Assert(t, err == nil, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	test.Assert(t, err == nil, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	test.Assert(t, os.WriteFile(path, data, 0o600) == nil)
+	test.Assert(t, os.Chtimes(path, modTime, modTime) == nil)
+}
+
+func TestTLSConfigReload(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+
+	now := time.Now().Add(-time.Minute)
+	ca1 := newTestCert(t, "ca1", nil)
+	client1 := newTestCert(t, "client", ca1)
+	writeFile(t, caFile, ca1.certPEM, now)
+	writeFile(t, certFile, client1.certPEM, now)
+	writeFile(t, keyFile, client1.keyPEM, now)
+
+	cfg, err := newTLSConfig(caFile, certFile, keyFile)
+	test.Assert(t, err == nil, err)
+
+	server1 := newTestCert(t, "etcd", ca1)
+	state := tls.ConnectionState{ServerName: "etcd", PeerCertificates: []*x509.Certificate{server1.cert}}
+	test.Assert(t, cfg.VerifyConnection(state) == nil)
+	cert, err := cfg.GetClientCertificate(nil)
+	test.Assert(t, err == nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	test.Assert(t, err == nil && leaf.Equal(client1.cert))
+
+	// rotate the CA and the client certificate
+	ca2 := newTestCert(t, "ca2", nil)
+	client2 := newTestCert(t, "client", ca2)
+	writeFile(t, caFile, ca2.certPEM, now.Add(time.Second))
+	writeFile(t, certFile, client2.certPEM, now.Add(time.Second))
+	writeFile(t, keyFile, client2.keyPEM, now.Add(time.Second))
+
+	test.Assert(t, cfg.VerifyConnection(state) != nil)
+	server2 := newTestCert(t, "etcd", ca2)
+	state.PeerCertificates = []*x509.Certificate{server2.cert}
+	test.Assert(t, cfg.VerifyConnection(state) == nil)
+	cert, err = cfg.GetClientCertificate(nil)
+	test.Assert(t, err == nil)
+	leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	test.Assert(t, err == nil && leaf.Equal(client2.cert))
+
+	state.ServerName = "other"
+	test.Assert(t, cfg.VerifyConnection(state) != nil)
+}
+
+func TestTLSConfigMissingKey(t *testing.T) {
+	_, err := newTLSConfig("", "client.pem", "")
+	test.Assert(t, err != nil)
+}
@@ -0,0 +1,749 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+const (
+	watchRetryMinInterval = 500 * time.Millisecond
+	watchRetryMaxInterval = 30 * time.Second
+)
+
+var errWatchClosed = errors.New("watch channel closed")
+
+// watcher watches a range of keys with a single etcd watch and dispatches the events
+// to the callbacks registered on each key. It remembers the last seen revision so that
+// a broken watch can be resumed without losing any event, and reloads all the keys when
+// the revision has been compacted.
+type watcher struct {
+	c *client
+	// prefix is the key watched, or the prefix of the keys watched if isPrefix is true.
+	prefix   string
+	isPrefix bool
+	cancel   context.CancelFunc
+	// pending is notified when some keys need to be loaded from etcd.
+	pending chan struct{}
+
+	mu   sync.Mutex
+	keys map[string]*keyWatch
+
+	// revision is the last revision observed, the watch resumes from revision+1.
+	// It is only accessed by the run goroutine.
+	revision int64
+}
+
+// keyWatch holds the latest value of a key and the callbacks registered on it.
+type keyWatch struct {
+	c   *client
+	key string
+	// deliverMu serializes the deliveries of the values to all the callbacks, so that the snapshot
+	// saved is the latest value applied. The callbacks and the listeners are called without holding
+	// mu, so that they can call the client, e.g. to register or deregister the keys.
+	deliverMu sync.Mutex
+
+	mu        sync.Mutex
+	callbacks map[int64]*subscriber
+	value     string
+	// modRevision is the ModRevision of value, zero if the key does not exist.
+	modRevision int64
+	// revision is the revision at which the value is known, zero if it has never been loaded.
+	revision int64
+	// fromSnapshot is true if value is loaded from the local snapshot.
+	fromSnapshot bool
+	// timer delivers the value when the debounce interval elapses, nil if no delivery is pending.
+	timer *time.Timer
+	// chunked is the manifest waiting for its chunks, nil if there is none.
+	chunked *pendingManifest
+	// boundary delivers the value again at boundaryAt, the next boundary of the windows of its
+	// scheduled variants, nil if there is none.
+	boundary   *time.Timer
+	boundaryAt time.Time
+}
+
+// subscriber is a callback registered on a key, mu serializes the deliveries to it.
+type subscriber struct {
+	*source.Subscriber
+	mu sync.Mutex
+	// revision is the revision of the value delivered, the older values are not delivered.
+	revision int64
+}
+
+// keyState is the value of a key known at revision.
+type keyState struct {
+	revision     int64
+	modRevision  int64
+	value        string
+	fromSnapshot bool
+}
+
+// pendingManifest is a manifest of the key whose chunks are not all present yet, it is
+// delivered once they are.
+type pendingManifest struct {
+	revision    int64
+	modRevision int64
+	manifest    *chunkManifest
+}
+
+func newWatcher(c *client, prefix string, isPrefix bool) *watcher {
+	return &watcher{
+		c:        c,
+		prefix:   prefix,
+		isPrefix: isPrefix,
+		pending:  make(chan struct{}, 1),
+		keys:     make(map[string]*keyWatch),
+	}
+}
+
+// start runs the watcher in background until it is stopped or the client is closed.
+func (w *watcher) start() {
+	ctx, cancel := context.WithCancel(w.c.ctx)
+	w.cancel = cancel
+	w.c.wg.Add(1)
+	go func() {
+		defer w.c.wg.Done()
+		w.run(ctx)
+	}()
+}
+
+func (w *watcher) stop() {
+	w.cancel()
+}
+
+// add registers the callback on key and returns the keyWatch of the key.
+func (w *watcher) add(key string, uniqueID int64, callback source.ConfigCallback, ro *source.RegisterOptions) *keyWatch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	kw, ok := w.keys[key]
+	if !ok {
+		kw = &keyWatch{c: w.c, key: key, callbacks: make(map[int64]*subscriber)}
+		w.keys[key] = kw
+	}
+	kw.mu.Lock()
+	kw.callbacks[uniqueID] = &subscriber{Subscriber: source.NewSubscriber(callback, ro)}
+	kw.mu.Unlock()
+	return kw
+}
+
+// remove deregisters the callback on key, it returns whether the watcher is not used anymore.
+func (w *watcher) remove(key string, uniqueID int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	kw, ok := w.keys[key]
+	if !ok {
+		return len(w.keys) == 0
+	}
+	kw.mu.Lock()
+	delete(kw.callbacks, uniqueID)
+	empty := len(kw.callbacks) == 0
+	kw.mu.Unlock()
+	if empty {
+		delete(w.keys, key)
+	}
+	return len(w.keys) == 0
+}
+
+func (w *watcher) lookup(key string) *keyWatch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.keys[key]
+}
+
+func (w *watcher) snapshot() []*keyWatch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	kws := make([]*keyWatch, 0, len(w.keys))
+	for _, kw := range w.keys {
+		kws = append(kws, kw)
+	}
+	return kws
+}
+
+// notifyPending asks the run goroutine to load the keys which have never been loaded.
+func (w *watcher) notifyPending() {
+	select {
+	case w.pending <- struct{}{}:
+	default:
+	}
+}
+
+// loadUntil loads the key until it succeeds or the deadline of ctx expires.
+// It tries only once if ctx has no deadline.
+func (w *watcher) loadUntil(ctx context.Context, kw *keyWatch) error {
+	_, blocking := ctx.Deadline()
+	interval := watchRetryMinInterval
+	for {
+		err := w.load(ctx, kw)
+		if err == nil || !blocking || isAuthError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > watchRetryMaxInterval {
+			interval = watchRetryMaxInterval
+		}
+	}
+}
+
+// load reads the current value of the key and delivers it to the callbacks if it has changed.
+func (w *watcher) load(ctx context.Context, kw *keyWatch) error {
+	ctx, cancel := context.WithTimeout(ctx, w.c.etcdTimeout)
+	defer cancel()
+	data, err := w.c.ecli.Get(ctx, kw.key)
+	// the etcd client has handled the not exist error.
+	if err != nil {
+		return err
+	}
+	if data.Count == 0 {
+		kw.update(data.Header.Revision, 0, "")
+		return nil
+	}
+	value, err := w.c.readChunks(ctx, kw.key, string(data.Kvs[0].Value))
+	if err != nil {
+		kw.wait(data.Header.Revision, data.Kvs[0].ModRevision, string(data.Kvs[0].Value))
+		return err
+	}
+	kw.update(data.Header.Revision, data.Kvs[0].ModRevision, value)
+	return nil
+}
+
+// loadChunks delivers the manifest of the key waiting for its chunks if they are all present.
+func (w *watcher) loadChunks(ctx context.Context, kw *keyWatch) error {
+	kw.mu.Lock()
+	p := kw.chunked
+	kw.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	value, err := w.c.readChunks(ctx, kw.key, p.manifest.String())
+	if err != nil {
+		return err
+	}
+	kw.update(p.revision, p.modRevision, value)
+	return nil
+}
+
+// sync reads the revision of etcd, and the values of all the keys if full is true.
+func (w *watcher) sync(ctx context.Context, full bool) error {
+	ctx, cancel := context.WithTimeout(ctx, w.c.etcdTimeout)
+	defer cancel()
+	var opts []clientv3.OpOption
+	if w.isPrefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	if !full {
+		opts = append(opts, clientv3.WithCountOnly())
+	}
+	data, err := w.c.ecli.Get(ctx, w.prefix, opts...)
+	if err != nil {
+		return err
+	}
+	if full {
+		kvs := make(map[string]*mvccpb.KeyValue, len(data.Kvs))
+		for _, kv := range data.Kvs {
+			kvs[string(kv.Key)] = kv
+		}
+		for _, kw := range w.snapshot() {
+			if kv, ok := kvs[kw.key]; ok {
+				if m, ok := parseManifest(string(kv.Value)); ok {
+					if value, err := m.assemble(kw.key, data.Kvs); err == nil {
+						kw.update(data.Header.Revision, kv.ModRevision, value)
+					} else {
+						// the chunks are read by loadPending when the watch starts.
+						kw.wait(data.Header.Revision, kv.ModRevision, string(kv.Value))
+					}
+					continue
+				}
+				kw.update(data.Header.Revision, kv.ModRevision, string(kv.Value))
+			} else {
+				kw.update(data.Header.Revision, 0, "")
+			}
+		}
+	}
+	w.revision = data.Header.Revision
+	return nil
+}
+
+// loadPending loads the keys which have never been loaded and the manifests waiting for
+// their chunks, and retries later if it fails.
+func (w *watcher) loadPending(ctx context.Context) {
+	for _, kw := range w.snapshot() {
+		if err := w.loadChunks(ctx, kw); err != nil && !errors.Is(err, errChunksIncomplete) {
+			if ctx.Err() == nil {
+				klog.Debugf("[etcd] key: %s config get chunks failed: %v", kw.key, err)
+				time.AfterFunc(watchRetryMinInterval, w.notifyPending)
+			}
+			return
+		}
+		if kw.loaded() {
+			continue
+		}
+		if err := w.load(ctx, kw); err != nil {
+			if ctx.Err() == nil {
+				klog.Debugf("[etcd] key: %s config get value failed: %v", kw.key, err)
+				time.AfterFunc(watchRetryMinInterval, w.notifyPending)
+			}
+			return
+		}
+	}
+}
+
+// run keeps the keys watched until ctx is done, the watch is restarted with backoff
+// whenever the watch channel is closed or returns an error.
+func (w *watcher) run(ctx context.Context) {
+	interval := watchRetryMinInterval
+	recovering := false
+	full := false
+	for {
+		var err error
+		if w.revision == 0 {
+			// the watcher has just started, or the revision has been compacted.
+			if err = w.sync(ctx, full); err == nil {
+				full = false
+			}
+		}
+		if err == nil {
+			var resumed bool
+			resumed, err = w.watch(ctx, recovering)
+			if resumed {
+				interval = watchRetryMinInterval
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		recovering = true
+		if errors.Is(err, rpctypes.ErrCompacted) {
+			klog.Warnf("[etcd] watch %s revision %d has been compacted, reload the configs", w.prefix, w.revision)
+			w.revision = 0
+			full = true
+		} else {
+			klog.Warnf("[etcd] watch %s failed: %v, retry in %s", w.prefix, err, interval)
+		}
+		w.c.metrics.WatchRestarted(w.prefix)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > watchRetryMaxInterval {
+			interval = watchRetryMaxInterval
+		}
+	}
+}
+
+// watch watches the keys from the last seen revision, it returns when the watch is broken.
+// resumed reports whether the watch has been established successfully.
+func (w *watcher) watch(ctx context.Context, recovering bool) (resumed bool, err error) {
+	from := w.revision + 1
+	opts := []clientv3.OpOption{clientv3.WithRev(from), clientv3.WithProgressNotify()}
+	if w.isPrefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	watchCtx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	watchChan := w.c.ecli.Watch(watchCtx, w.prefix, opts...)
+	// the keys registered while the watch is broken may have not been loaded.
+	w.loadPending(ctx)
+	for {
+		select {
+		case <-w.pending:
+			w.loadPending(ctx)
+		case watchResp, ok := <-watchChan:
+			if !ok {
+				if ctx.Err() != nil {
+					return resumed, ctx.Err()
+				}
+				return resumed, errWatchClosed
+			}
+			if err := watchResp.Err(); err != nil {
+				return resumed, err
+			}
+			if watchResp.Created {
+				resumed = true
+				if recovering {
+					klog.Infof("[etcd] watch %s recovered from revision %d", w.prefix, from)
+				}
+			}
+			if watchResp.IsProgressNotify() {
+				if watchResp.Header.Revision > w.revision {
+					w.revision = watchResp.Header.Revision
+				}
+				// all the keys are up to date at the revision.
+				for _, kw := range w.snapshot() {
+					if kw.loaded() {
+						w.c.metrics.Synced(kw.key)
+					}
+				}
+			}
+			for _, event := range watchResp.Events {
+				w.handle(ctx, event)
+			}
+		}
+	}
+}
+
+func (w *watcher) handle(ctx context.Context, event *clientv3.Event) {
+	if event.Kv.ModRevision > w.revision {
+		w.revision = event.Kv.ModRevision
+	}
+	kw := w.lookup(string(event.Kv.Key))
+	if kw == nil {
+		w.handleChunk(ctx, event)
+		return
+	}
+	// check the event type
+	switch event.Type {
+	case mvccpb.PUT:
+		// config is updated
+		klog.Debugf("[etcd] config key: %s updated,value is %s", kw.key, event.Kv.Value)
+		value, err := w.c.readChunks(ctx, kw.key, string(event.Kv.Value))
+		if err != nil {
+			klog.Debugf("[etcd] config key: %s wait for the chunks of revision %d: %v", kw.key, event.Kv.ModRevision, err)
+			kw.wait(event.Kv.ModRevision, event.Kv.ModRevision, string(event.Kv.Value))
+			if !errors.Is(err, errChunksIncomplete) {
+				time.AfterFunc(watchRetryMinInterval, w.notifyPending)
+			}
+			return
+		}
+		kw.debounce(event.Kv.ModRevision, event.Kv.ModRevision, value)
+	case mvccpb.DELETE:
+		// config is deleted
+		klog.Debugf("[etcd] config key: %s deleted", kw.key)
+		kw.debounce(event.Kv.ModRevision, 0, "")
+	}
+}
+
+// handleChunk delivers the manifest waiting for the chunk of event once all its chunks are present.
+func (w *watcher) handleChunk(ctx context.Context, event *clientv3.Event) {
+	if event.Type != mvccpb.PUT {
+		return
+	}
+	key, generation, ok := isChunkKey(string(event.Kv.Key))
+	if !ok {
+		return
+	}
+	kw := w.lookup(key)
+	if kw == nil || !kw.waiting(generation) {
+		return
+	}
+	if err := w.loadChunks(ctx, kw); err != nil && !errors.Is(err, errChunksIncomplete) {
+		klog.Debugf("[etcd] key: %s config get chunks failed: %v", kw.key, err)
+		time.AfterFunc(watchRetryMinInterval, w.notifyPending)
+	}
+}
+
+// deliver delivers the current value to the callback of uniqueID, and returns the error
+// of the callback. loaded is false if the value of the key has never been loaded.
+func (kw *keyWatch) deliver(uniqueID int64) (loaded bool, err error) {
+	kw.mu.Lock()
+	if kw.revision == 0 && !kw.fromSnapshot {
+		kw.mu.Unlock()
+		return false, nil
+	}
+	cb, ok := kw.callbacks[uniqueID]
+	st := kw.state()
+	kw.mu.Unlock()
+	if !ok {
+		return true, nil
+	}
+	event, err := kw.notify(cb, st, false)
+	if event != nil {
+		if event.Err != nil {
+			klog.Warnf("[etcd] config key: %s apply value failed: %v", kw.key, event.Err)
+		}
+		kw.c.publish(event, cb.Listeners)
+	}
+	return true, err
+}
+
+func (kw *keyWatch) loaded() bool {
+	kw.mu.Lock()
+	defer kw.mu.Unlock()
+	return kw.revision != 0
+}
+
+// wait keeps the manifest of the key known at revision until all its chunks are present,
+// unless a newer value is known already.
+func (kw *keyWatch) wait(revision, modRevision int64, manifest string) {
+	m, ok := parseManifest(manifest)
+	if !ok {
+		return
+	}
+	kw.mu.Lock()
+	defer kw.mu.Unlock()
+	if revision <= kw.revision || (kw.chunked != nil && revision <= kw.chunked.revision) {
+		return
+	}
+	kw.chunked = &pendingManifest{revision: revision, modRevision: modRevision, manifest: m}
+}
+
+// waiting reports whether the manifest of generation is waiting for its chunks.
+func (kw *keyWatch) waiting(generation string) bool {
+	kw.mu.Lock()
+	defer kw.mu.Unlock()
+	return kw.chunked != nil && kw.chunked.manifest.generation == generation
+}
+
+// update sets the value of the key known at revision, and delivers it to the callbacks
+// if it is newer than the current one.
+func (kw *keyWatch) update(revision, modRevision int64, value string) {
+	kw.c.metrics.Synced(kw.key)
+	kw.mu.Lock()
+	if revision <= kw.revision {
+		kw.mu.Unlock()
+		return
+	}
+	if kw.chunked != nil && kw.chunked.revision <= revision {
+		kw.chunked = nil
+	}
+	kw.revision = revision
+	kw.modRevision = modRevision
+	kw.value = value
+	kw.fromSnapshot = false
+	if kw.timer != nil {
+		kw.timer.Stop()
+		kw.timer = nil
+	}
+	kw.mu.Unlock()
+	kw.apply(false)
+}
+
+// debounce sets the value like update, but delays delivering it until Options.DebounceInterval
+// elapses, so that the changes of the key in the interval are coalesced into the latest one.
+func (kw *keyWatch) debounce(revision, modRevision int64, value string) {
+	interval := kw.c.debounceInterval
+	if interval <= 0 {
+		kw.update(revision, modRevision, value)
+		return
+	}
+	kw.c.metrics.Synced(kw.key)
+	kw.mu.Lock()
+	defer kw.mu.Unlock()
+	if revision <= kw.revision {
+		return
+	}
+	if kw.chunked != nil && kw.chunked.revision <= revision {
+		kw.chunked = nil
+	}
+	kw.revision = revision
+	kw.modRevision = modRevision
+	kw.value = value
+	kw.fromSnapshot = false
+	if kw.timer == nil {
+		kw.timer = time.AfterFunc(interval, kw.flush)
+	}
+}
+
+// flush delivers the value coalesced by debounce, unless the client is closed.
+func (kw *keyWatch) flush() {
+	c := kw.c
+	c.m.Lock()
+	if c.closed {
+		c.m.Unlock()
+		return
+	}
+	c.wg.Add(1)
+	c.m.Unlock()
+	defer c.wg.Done()
+	kw.mu.Lock()
+	if kw.timer == nil {
+		// delivered by update already
+		kw.mu.Unlock()
+		return
+	}
+	kw.timer = nil
+	kw.mu.Unlock()
+	kw.apply(false)
+}
+
+// apply delivers the current value to the callbacks, and saves it in the snapshot if
+// it is applied by all of them. force delivers it even if it has been delivered.
+// The events are published to the listeners once all the callbacks are called.
+func (kw *keyWatch) apply(force bool) {
+	kw.deliverMu.Lock()
+	kw.mu.Lock()
+	st := kw.state()
+	cbs := make([]*subscriber, 0, len(kw.callbacks))
+	for _, cb := range kw.callbacks {
+		cbs = append(cbs, cb)
+	}
+	kw.mu.Unlock()
+	applied := true
+	type published struct {
+		event     *source.ConfigEvent
+		listeners []source.ConfigListener
+	}
+	var events []published
+	for _, cb := range cbs {
+		event, _ := kw.notify(cb, st, force)
+		if event == nil {
+			continue
+		}
+		if event.Err != nil {
+			klog.Warnf("[etcd] config key: %s apply value failed: %v", kw.key, event.Err)
+			applied = false
+		}
+		events = append(events, published{event, cb.Listeners})
+	}
+	if applied && kw.c.snapshots != nil && !st.fromSnapshot {
+		var err error
+		if st.modRevision == 0 {
+			err = kw.c.snapshots.remove(kw.key)
+		} else {
+			err = kw.c.snapshots.save(kw.key, st.value, st.modRevision)
+		}
+		if err != nil {
+			klog.Warnf("[etcd] config key: %s save snapshot failed: %v", kw.key, err)
+		}
+	}
+	kw.deliverMu.Unlock()
+	kw.scheduleNext(st)
+	for _, p := range events {
+		kw.c.publish(p.event, p.listeners)
+	}
+}
+
+// restore delivers the last-known-good value in the local snapshot to the callbacks,
+// it is used only when the key can not be loaded from etcd. It returns whether the
+// snapshot is found.
+func (kw *keyWatch) restore() bool {
+	if kw.c.snapshots == nil {
+		return false
+	}
+	snap, err := kw.c.snapshots.load(kw.key)
+	if err != nil {
+		klog.Warnf("[etcd] config key: %s load snapshot failed: %v", kw.key, err)
+		return false
+	}
+	if snap == nil {
+		return false
+	}
+	kw.mu.Lock()
+	if kw.revision != 0 {
+		// loaded from etcd already
+		kw.mu.Unlock()
+		return true
+	}
+	klog.Warnf("[etcd] config key: %s can not be loaded from etcd, use the snapshot of revision %d saved at %s",
+		kw.key, snap.Revision, snap.SavedAt.Format(time.RFC3339))
+	kw.modRevision = snap.Revision
+	kw.value = snap.Value
+	kw.fromSnapshot = true
+	kw.mu.Unlock()
+	kw.apply(false)
+	return true
+}
+
+// scheduleNext delivers the value of st again at the next boundary of the windows of its scheduled
+// variants, so that the callbacks switch to the variant applying then without any write. It is
+// skipped if the value has been changed since st, whose delivery schedules the next one.
+func (kw *keyWatch) scheduleNext(st keyState) {
+	kw.mu.Lock()
+	defer kw.mu.Unlock()
+	if kw.state() != st {
+		return
+	}
+	if kw.boundary != nil {
+		kw.boundary.Stop()
+		kw.boundary = nil
+	}
+	if st.modRevision == 0 {
+		return
+	}
+	next, ok := kw.c.codec.NextBoundary(st.value, time.Now())
+	if !ok {
+		return
+	}
+	kw.boundaryAt = next
+	kw.boundary = time.AfterFunc(time.Until(next), func() {
+		kw.onBoundary(next)
+	})
+}
+
+// onBoundary delivers the value again to all the callbacks at the boundary at, unless the
+// client is closed or the boundary is rescheduled.
+func (kw *keyWatch) onBoundary(at time.Time) {
+	c := kw.c
+	c.m.Lock()
+	if c.closed {
+		c.m.Unlock()
+		return
+	}
+	c.wg.Add(1)
+	c.m.Unlock()
+	defer c.wg.Done()
+	kw.mu.Lock()
+	if kw.boundary == nil || !kw.boundaryAt.Equal(at) {
+		kw.mu.Unlock()
+		return
+	}
+	kw.boundary = nil
+	kw.mu.Unlock()
+	// the value is unchanged, but the variant applying to it is.
+	kw.apply(true)
+}
+
+// state returns the current value of the key, kw.mu must be held.
+func (kw *keyWatch) state() keyState {
+	return keyState{revision: kw.revision, modRevision: kw.modRevision, value: kw.value, fromSnapshot: kw.fromSnapshot}
+}
+
+// notify delivers the value of st to cb if it has not been delivered yet, or force is true, unless
+// a newer value has been delivered to it. It returns the event of the delivery, nil if it is skipped,
+// and the error of cb for the last value delivered. The caller publishes the event to the listeners.
+func (kw *keyWatch) notify(cb *subscriber, st keyState, force bool) (*source.ConfigEvent, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if st.revision < cb.revision {
+		return nil, cb.Err()
+	}
+	cb.revision = st.revision
+	event := cb.Deliver(source.Update{
+		Key:          kw.key,
+		Value:        st.value,
+		ModRevision:  st.modRevision,
+		FromSnapshot: st.fromSnapshot,
+		Force:        force,
+	}, kw.c.codec.ParserOf(kw.key, cb.Param.Category))
+	if event == nil {
+		return nil, cb.Err()
+	}
+	kw.c.metrics.UpdateReceived(event.Category, kw.key)
+	switch {
+	case source.IsParseError(event.Err):
+		kw.c.metrics.ParseFailed(event.Category, kw.key)
+	case event.Err != nil:
+		kw.c.metrics.Rejected(event.Category, kw.key)
+	default:
+		kw.c.metrics.Applied(event.Category, kw.key, st.modRevision)
+	}
+	return event, cb.Err()
+}
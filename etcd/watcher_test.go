@@ -0,0 +1,366 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+// testKV is an in-memory clientv3.KV keeping all the revisions, it supports Get, Put, Delete and
+// the Txn of puts and deletes comparing the ModRevision.
+type testKV struct {
+	clientv3.KV
+	mu  sync.Mutex
+	rev int64
+	// compacted is the compacted revision.
+	compacted int64
+	// log is all the changes, the deletions have zero Version.
+	log []*mvccpb.KeyValue
+}
+
+// current returns the latest changes of the keys in [key, end) at rev.
+func (kv *testKV) current(key, end string, rev int64) map[string]*mvccpb.KeyValue {
+	kvs := make(map[string]*mvccpb.KeyValue)
+	for _, e := range kv.log {
+		k := string(e.Key)
+		if (rev == 0 || e.ModRevision <= rev) && (k == key || (end != "" && k >= key && k < end)) {
+			kvs[k] = e
+		}
+	}
+	return kvs
+}
+
+func (kv *testKV) put(key, value string) int64 {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.rev++
+	e := &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: kv.rev, CreateRevision: kv.rev, Version: 1}
+	if prev, ok := kv.current(key, "", 0)[key]; ok && prev.Version != 0 {
+		e.CreateRevision, e.Version = prev.CreateRevision, prev.Version+1
+	}
+	kv.log = append(kv.log, e)
+	return kv.rev
+}
+
+func (kv *testKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	op := clientv3.OpGet(key, opts...)
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if op.Rev() != 0 && op.Rev() < kv.compacted {
+		return nil, rpctypes.ErrCompacted
+	}
+	resp := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: kv.rev}}
+	for _, e := range kv.current(key, string(op.RangeBytes()), op.Rev()) {
+		if e.Version != 0 {
+			resp.Kvs = append(resp.Kvs, e)
+		}
+	}
+	sort.Slice(resp.Kvs, func(i, j int) bool { return string(resp.Kvs[i].Key) < string(resp.Kvs[j].Key) })
+	resp.Count = int64(len(resp.Kvs))
+	return resp, nil
+}
+
+// testWatcher is a clientv3.Watcher whose watches are sent to watches, the tests send the
+// responses to them and close them to break the watches.
+type testWatcher struct {
+	clientv3.Watcher
+	watches chan *testWatch
+}
+
+// testWatch is a watch started at at from revision rev.
+type testWatch struct {
+	rev int64
+	at  time.Time
+	ch  chan clientv3.WatchResponse
+}
+
+func newTestWatcher() *testWatcher {
+	return &testWatcher{watches: make(chan *testWatch, 16)}
+}
+
+func (tw *testWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	wt := &testWatch{rev: clientv3.OpGet(key, opts...).Rev(), at: time.Now(), ch: make(chan clientv3.WatchResponse)}
+	out := make(chan clientv3.WatchResponse)
+	// the watch channel is closed when ctx is done like the etcd client.
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case resp, ok := <-wt.ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- resp:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	tw.watches <- wt
+	return out
+}
+
+// next returns the next watch started.
+func (tw *testWatcher) next(t *testing.T) *testWatch {
+	select {
+	case wt := <-tw.watches:
+		return wt
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch not started")
+		return nil
+	}
+}
+
+func (wt *testWatch) send(t *testing.T, resp clientv3.WatchResponse) {
+	select {
+	case wt.ch <- resp:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch response not received")
+	}
+}
+
+// put sends the event of the put of key at revision rev.
+func (wt *testWatch) put(t *testing.T, key, value string, rev int64) {
+	wt.send(t, clientv3.WatchResponse{
+		Header: etcdserverpb.ResponseHeader{Revision: rev},
+		Events: []*clientv3.Event{{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: rev}}},
+	})
+}
+
+func newWatchClient(kv *testKV, tw *testWatcher) (*client, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &client{
+		ecli:        &clientv3.Client{KV: kv, Watcher: tw},
+		ctx:         ctx,
+		cancel:      cancel,
+		etcdTimeout: time.Second,
+		codec:       &source.Codec{Parser: source.NewJSONParser()},
+		metrics:     nopMetrics{},
+		watchPrefix: "/KitexConfig/",
+		watchers:    make(map[string]*watcher),
+		layers:      make(map[layerID][]string),
+	}
+	return c, func() {
+		cancel()
+		c.wg.Wait()
+	}
+}
+
+// recorder records the values delivered to a callback.
+type recorder struct {
+	mu     sync.Mutex
+	values []string
+}
+
+func (r *recorder) callback(restoreDefault bool, data string, parser ConfigParser, meta source.ConfigMeta) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values = append(r.values, data)
+	return nil
+}
+
+// wait waits until n values are delivered, and returns them.
+func (r *recorder) wait(n int) []string {
+	for i := 0; i < 100; i++ {
+		r.mu.Lock()
+		values := append([]string{}, r.values...)
+		r.mu.Unlock()
+		if len(values) >= n {
+			return values
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.values...)
+}
+
+func TestWatchResume(t *testing.T) {
+	kv := &testKV{}
+	tw := newTestWatcher()
+	c, stop := newWatchClient(kv, tw)
+	defer stop()
+	key := "/KitexConfig/s/limit"
+	kv.put(key, "v1")
+	var r recorder
+	test.Assert(t, c.RegisterConfigCallback(context.Background(), key, 1, r.callback) == nil)
+	test.Assert(t, len(r.wait(1)) == 1)
+
+	// the watch starts from the revision after the one synced.
+	wt := tw.next(t)
+	test.Assert(t, wt.rev == 2, wt.rev)
+	wt.send(t, clientv3.WatchResponse{Created: true})
+	wt.put(t, key, "v2", kv.put(key, "v2"))
+	test.Assert(t, len(r.wait(2)) == 2 && r.wait(2)[1] == "v2", r.wait(2))
+
+	// the broken watch resumes from the revision after the last event, without reloading the keys.
+	close(wt.ch)
+	wt = tw.next(t)
+	test.Assert(t, wt.rev == 3, wt.rev)
+	wt.send(t, clientv3.WatchResponse{Created: true})
+
+	// the keys are reloaded if the revision to resume from has been compacted.
+	kv.put(key, "v3")
+	kv.put("/KitexConfig/s/other", "x")
+	wt.send(t, clientv3.WatchResponse{CompactRevision: 4})
+	values := r.wait(3)
+	test.Assert(t, len(values) == 3 && values[2] == "v3", values)
+	wt = tw.next(t)
+	test.Assert(t, wt.rev == 5, wt.rev)
+}
+
+func TestWatchBackoff(t *testing.T) {
+	kv := &testKV{}
+	tw := newTestWatcher()
+	c, stop := newWatchClient(kv, tw)
+	defer stop()
+	var r recorder
+	test.Assert(t, c.RegisterConfigCallback(context.Background(), "/KitexConfig/s/limit", 1, r.callback) == nil)
+
+	// the watch is retried with the doubled interval until it is created.
+	wt := tw.next(t)
+	close(wt.ch)
+	next := tw.next(t)
+	test.Assert(t, next.at.Sub(wt.at) >= watchRetryMinInterval, next.at.Sub(wt.at))
+	wt = next
+	close(wt.ch)
+	next = tw.next(t)
+	test.Assert(t, next.at.Sub(wt.at) >= 2*watchRetryMinInterval, next.at.Sub(wt.at))
+
+	// the interval is reset once the watch is created.
+	wt = next
+	wt.send(t, clientv3.WatchResponse{Created: true})
+	close(wt.ch)
+	next = tw.next(t)
+	interval := next.at.Sub(wt.at)
+	test.Assert(t, interval >= watchRetryMinInterval && interval < 2*watchRetryMinInterval, interval)
+}
+
+func TestWatchReentrant(t *testing.T) {
+	kv := &testKV{}
+	tw := newTestWatcher()
+	c, stop := newWatchClient(kv, tw)
+	defer stop()
+	key, other := "/KitexConfig/s/limit", "/KitexConfig/s/retry"
+	kv.put(key, "v1")
+	kv.put(other, "r1")
+	test.Assert(t, c.RegisterConfigCallback(context.Background(), other, 3, func(bool, string, ConfigParser, source.ConfigMeta) error {
+		return nil
+	}) == nil)
+
+	// the callbacks and the listeners can register and deregister the keys, including their own.
+	var r recorder
+	err := c.RegisterConfigCallback(context.Background(), key, 1, func(restoreDefault bool, data string, parser ConfigParser, meta source.ConfigMeta) error {
+		if data == "v2" {
+			c.DeregisterConfig(other, 3)
+		}
+		return nil
+	})
+	test.Assert(t, err == nil, err)
+	var registered int32
+	c.AddListener(source.ConfigListenerFunc(func(event *source.ConfigEvent) {
+		// the listener is called again by the registration.
+		if event.Key == key && event.Revision == 3 && atomic.CompareAndSwapInt32(&registered, 0, 1) {
+			test.Assert(t, c.RegisterConfigCallback(context.Background(), key, 2, r.callback) == nil)
+			c.DeregisterConfig(key, 1)
+		}
+	}))
+	wt := tw.next(t)
+	wt.send(t, clientv3.WatchResponse{Created: true})
+	done := make(chan struct{})
+	go func() {
+		wt.put(t, key, "v2", kv.put(key, "v2"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock")
+	}
+	values := r.wait(1)
+	test.Assert(t, len(values) == 1 && values[0] == "v2", values)
+
+	c.m.Lock()
+	w := c.watchers["/KitexConfig/"]
+	c.m.Unlock()
+	kw := w.lookup(key)
+	test.Assert(t, kw != nil && w.lookup(other) == nil)
+	kw.mu.Lock()
+	_, ok := kw.callbacks[1]
+	test.Assert(t, !ok && len(kw.callbacks) == 1)
+	kw.mu.Unlock()
+}
+
+func TestDebounce(t *testing.T) {
+	c := &client{codec: &source.Codec{Parser: source.NewJSONParser()}, metrics: nopMetrics{}, debounceInterval: 50 * time.Millisecond}
+	w := newWatcher(c, "/KitexConfig/", true)
+	var mu sync.Mutex
+	var got []string
+	kw := w.add("/KitexConfig/client/server/circuit_break", 1, func(restoreDefault bool, data string, parser ConfigParser, meta source.ConfigMeta) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, data)
+		return nil
+	}, &source.RegisterOptions{})
+	delivered := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, got...)
+	}
+
+	// the value loaded is delivered at once.
+	kw.update(10, 10, "v1")
+	test.Assert(t, len(delivered()) == 1, delivered())
+
+	kw.debounce(11, 11, "v2")
+	kw.debounce(12, 12, "v3")
+	kw.debounce(11, 11, "v2")
+	kw.debounce(13, 13, "v4")
+	test.Assert(t, len(delivered()) == 1, delivered())
+	time.Sleep(200 * time.Millisecond)
+	test.Assert(t, len(delivered()) == 2 && delivered()[1] == "v4", delivered())
+
+	// the pending value is delivered at once if the key is loaded again.
+	kw.debounce(14, 14, "v5")
+	kw.update(15, 15, "v6")
+	test.Assert(t, len(delivered()) == 3 && delivered()[2] == "v6", delivered())
+	time.Sleep(200 * time.Millisecond)
+	test.Assert(t, len(delivered()) == 3, delivered())
+
+	// the pending value is dropped if the client is closed.
+	kw.debounce(16, 16, "v7")
+	c.m.Lock()
+	c.closed = true
+	c.m.Unlock()
+	time.Sleep(200 * time.Millisecond)
+	test.Assert(t, len(delivered()) == 3, delivered())
+}
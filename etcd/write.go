@@ -0,0 +1,422 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+// ErrRevisionConflict is returned by the writes if the ModRevision of the key is not the expected one.
+var ErrRevisionConflict = errors.New("[etcd] config revision conflict")
+
+// ErrNoSchemaValidator is returned by the writes with WithValidation if Options.SchemaValidator is not set.
+var ErrNoSchemaValidator = errors.New("[etcd] validation is required but no schema validator is set")
+
+// SchemaValidator checks the typed config of the category before it is written, e.g. validation.Validate.
+type SchemaValidator func(category string, config interface{}) error
+
+// ValidateSchema checks config of category with v before it is written with wo. It returns
+// ErrNoSchemaValidator if v is nil and wo requires the validation, and nil if v is nil otherwise.
+func ValidateSchema(v SchemaValidator, category string, config interface{}, wo *WriteOptions) error {
+	if v == nil {
+		if wo.Validate {
+			return ErrNoSchemaValidator
+		}
+		return nil
+	}
+	return v(category, config)
+}
+
+// WriteOption is the option of the config read and write methods of Client.
+type WriteOption func(*WriteOptions)
+
+// WriteOptions are the options of a read or write, they are exported for the Client
+// implementations outside of this package.
+type WriteOptions struct {
+	CustomFunctions []CustomFunction
+	// ExpectedRevision is the ModRevision the key must have if Compare is set, zero if it must not exist.
+	ExpectedRevision int64
+	Compare          bool
+	// Encrypt is true if the value is written in the encrypted envelope.
+	Encrypt bool
+	// SigningKey signs the value in the signature envelope if it is not nil.
+	SigningKey *source.SigningKey
+	// Compression is the name of the Compressor to compress the value, empty if not compressed.
+	Compression string
+	// ChunkSize is the max size of the value written without chunking, DefaultChunkSize if zero.
+	ChunkSize int
+	// Rollout writes the value as the candidate of the canary rollout if it is not nil.
+	Rollout *source.Rollout
+	// Variants write the value as the default one of the schedule envelope with them if they are set.
+	Variants []ConfigVariant
+	// Validate requires the config to be checked by Options.SchemaValidator.
+	Validate bool
+}
+
+// NewWriteOptions applies opts to an empty WriteOptions.
+func NewWriteOptions(opts ...WriteOption) *WriteOptions {
+	wo := &WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+	return wo
+}
+
+// WithCustomFunctions sets the CustomFunctions used to render the key.
+func WithCustomFunctions(cfs ...CustomFunction) WriteOption {
+	return func(o *WriteOptions) {
+		o.CustomFunctions = append(o.CustomFunctions, cfs...)
+	}
+}
+
+// WithModRevision makes the write succeed only if the ModRevision of the key is revision,
+// which is returned by GetConfig. Zero means the key must not exist.
+// ErrRevisionConflict is returned if the key has been modified.
+func WithModRevision(revision int64) WriteOption {
+	return func(o *WriteOptions) {
+		o.ExpectedRevision = revision
+		o.Compare = true
+	}
+}
+
+// WithValidation requires the config to be checked by Options.SchemaValidator before it is
+// written, ErrNoSchemaValidator is returned if it is not set.
+func WithValidation() WriteOption {
+	return func(o *WriteOptions) {
+		o.Validate = true
+	}
+}
+
+// WithEncryption writes the value encrypted with Options.KeyProvider in the encrypted envelope,
+// source.ErrNoKeyProvider is returned if it is not set.
+func WithEncryption() WriteOption {
+	return func(o *WriteOptions) {
+		o.Encrypt = true
+	}
+}
+
+// WithSigningKey writes the value signed by key in the signature envelope, after it is
+// encrypted if WithEncryption is set.
+func WithSigningKey(key *source.SigningKey) WriteOption {
+	return func(o *WriteOptions) {
+		o.SigningKey = key
+	}
+}
+
+// WithCompression writes the value compressed by the Compressor of name in the compressed
+// envelope, e.g. source.CompressorGzip, before it is encrypted.
+func WithCompression(name string) WriteOption {
+	return func(o *WriteOptions) {
+		o.Compression = name
+	}
+}
+
+// WithChunkSize sets the max size of the value written without chunking, the larger value
+// is written in the chunks of size, and the manifest of them is written at the key.
+func WithChunkSize(size int) WriteOption {
+	return func(o *WriteOptions) {
+		o.ChunkSize = size
+	}
+}
+
+// WithRollout writes the value as the candidate of the canary rollout in the rollout envelope,
+// the current value is kept as the stable one. The instances decide whether the candidate applies
+// to them by Options.InstanceID and Options.InstanceTags. Write it again with a larger Percent to
+// raise the rollout, and without WithRollout to promote the candidate.
+func WithRollout(rollout source.Rollout) WriteOption {
+	return func(o *WriteOptions) {
+		o.Rollout = &rollout
+	}
+}
+
+// WithVariant writes config as a variant applying in window, the config written applies out of
+// the windows of the variants, and the first variant whose window contains the time applies in
+// them. The clients switch to the variant applying at each boundary of the windows by themselves.
+func WithVariant(window source.Window, config interface{}) WriteOption {
+	return func(o *WriteOptions) {
+		o.Variants = append(o.Variants, ConfigVariant{Window: window, Config: config})
+	}
+}
+
+// GetConfig decodes the config of cpc to config with the parser of the category, and
+// returns its ModRevision. It returns source.ErrConfigNotFound if the key does not exist.
+func (c *client) GetConfig(ctx context.Context, cpc *ConfigParamConfig, config interface{}, opts ...WriteOption) (int64, error) {
+	wo := NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	resp, err := c.ecli.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Count == 0 {
+		return 0, source.ErrConfigNotFound
+	}
+	value, err := c.readChunks(ctx, key, string(resp.Kvs[0].Value))
+	if err != nil {
+		return 0, err
+	}
+	if err = c.codec.Decode(key, cpc.Category, value, config); err != nil {
+		return 0, err
+	}
+	return resp.Kvs[0].ModRevision, nil
+}
+
+// PutConfig validates the typed config of the category of cpc by Options.SchemaValidator, and
+// writes it encoded by the parser of the category. It returns the ModRevision of the written value.
+// The value larger than the chunk size is written in chunks before the manifest of them, the
+// chunks are kept with the history record of the value, and deleted once the record is pruned.
+func (c *client) PutConfig(ctx context.Context, cpc *ConfigParamConfig, config interface{}, opts ...WriteOption) (int64, error) {
+	wo := NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return 0, err
+	}
+	value, err := c.encoder.EncodeConfig(key, cpc.Category, config, wo, func() (source.ConfigValue, error) {
+		return c.GetValue(ctx, key)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return c.putValue(ctx, key, value, wo, 0)
+}
+
+// putValue writes the raw value at key, the value larger than the chunk size is written in
+// chunks before the manifest of them. The version is recorded in the history, rollback is the
+// revision rolled back to, zero if it is not a rollback.
+func (c *client) putValue(ctx context.Context, key, value string, wo *WriteOptions, rollback int64) (int64, error) {
+	size := wo.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	var err error
+	if len(value) > size {
+		if value, err = c.putChunks(ctx, key, value, size); err != nil {
+			return 0, err
+		}
+	}
+	op, chunked, err := c.historyOp(ctx, key, value, false, rollback, size)
+	if err != nil {
+		c.deleteChunks(key, value)
+		return 0, err
+	}
+	resp, err := c.txn(ctx, key, wo, clientv3.OpPut(key, value), op)
+	if err != nil {
+		c.deleteChunks(key, value)
+		c.deleteChunks(c.historyChunks(key), chunked)
+		return 0, err
+	}
+	// the chunks are kept with the history records.
+	c.pruneHistory(key)
+	return resp.Header.Revision, nil
+}
+
+// DeleteConfig deletes the config of cpc, so that the callbacks restore the default config.
+func (c *client) DeleteConfig(ctx context.Context, cpc *ConfigParamConfig, opts ...WriteOption) error {
+	wo := NewWriteOptions(opts...)
+	key, err := c.ConfigKey(cpc, wo.CustomFunctions...)
+	if err != nil {
+		return err
+	}
+	_, err = c.deleteValue(ctx, key, wo, 0)
+	return err
+}
+
+// deleteValue deletes key like putValue, and returns the revision of the deletion.
+func (c *client) deleteValue(ctx context.Context, key string, wo *WriteOptions, rollback int64) (int64, error) {
+	op, _, err := c.historyOp(ctx, key, "", true, rollback, 0)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.txn(ctx, key, wo, clientv3.OpDelete(key), op)
+	if err != nil {
+		return 0, err
+	}
+	c.pruneHistory(key)
+	return resp.Header.Revision, nil
+}
+
+// txn runs ops, and compares the ModRevision of key first if it is required.
+func (c *client) txn(ctx context.Context, key string, wo *WriteOptions, ops ...clientv3.Op) (*clientv3.TxnResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	txn := c.ecli.Txn(ctx)
+	if wo.Compare {
+		txn = txn.If(clientv3.Compare(clientv3.ModRevision(key), "=", wo.ExpectedRevision))
+	}
+	resp, err := txn.Then(ops...).Commit()
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		return nil, fmt.Errorf("%w: %s is not at revision %d", ErrRevisionConflict, key, wo.ExpectedRevision)
+	}
+	return resp, nil
+}
+
+// ValueEncoder encodes the typed configs into the raw values written by the write API, it is
+// shared by the Client implementations so that they write the same values.
+type ValueEncoder struct {
+	// Codec encodes the configs by the parsers of the categories and encrypts them by its KeyProvider.
+	Codec *source.Codec
+	// SchemaValidator checks the configs before they are encoded, they are not checked if it is nil.
+	SchemaValidator SchemaValidator
+}
+
+// EncodeConfig validates config of category and encodes it into the value written at key with wo,
+// in the schedule and the rollout envelopes if wo requires them. current returns the current value
+// of key, or source.ErrConfigNotFound if it does not exist, which is the stable value of the rollout.
+// The write of the rollout is made conditional on the revision of the stable value if it is not yet.
+func (e *ValueEncoder) EncodeConfig(key, category string, config interface{}, wo *WriteOptions,
+	current func() (source.ConfigValue, error),
+) (string, error) {
+	if err := ValidateSchema(e.SchemaValidator, category, config, wo); err != nil {
+		return "", err
+	}
+	value, err := e.seal(key, category, config, wo)
+	if err != nil {
+		return "", err
+	}
+	if len(wo.Variants) > 0 {
+		if value, err = e.scheduleValue(key, category, value, wo); err != nil {
+			return "", err
+		}
+		// sign the envelope for the windows.
+		if wo.SigningKey != nil {
+			if value, err = source.Sign(wo.SigningKey, key, value); err != nil {
+				return "", err
+			}
+		}
+	}
+	if wo.Rollout != nil {
+		if value, err = e.rolloutValue(key, value, wo, current); err != nil {
+			return "", err
+		}
+		// sign the envelope for the rollout spec.
+		if wo.SigningKey != nil {
+			if value, err = source.Sign(wo.SigningKey, key, value); err != nil {
+				return "", err
+			}
+		}
+	}
+	return value, nil
+}
+
+// EncodeOverride validates config of category and encodes it into the override written at key,
+// which can not be rolled out or scheduled.
+func (e *ValueEncoder) EncodeOverride(key, category string, config interface{}, wo *WriteOptions) (string, error) {
+	if wo.Rollout != nil || len(wo.Variants) > 0 {
+		return "", errors.New("[etcd] the override can not be rolled out or scheduled")
+	}
+	if err := ValidateSchema(e.SchemaValidator, category, config, wo); err != nil {
+		return "", err
+	}
+	return e.seal(key, category, config, wo)
+}
+
+// EncodeRollback returns the value of a version written again at key by the rollback, which is
+// signed again by wo.SigningKey if it is set, so that it is not rejected as a stale signature by
+// the readers verifying the signatures.
+func (e *ValueEncoder) EncodeRollback(key, value string, wo *WriteOptions) (string, error) {
+	if wo.SigningKey == nil {
+		return value, nil
+	}
+	return source.Sign(wo.SigningKey, key, source.Unsign(value))
+}
+
+// seal encodes config with the parser of category, then compresses, encrypts and signs it for
+// key as required by wo.
+func (e *ValueEncoder) seal(key, category string, config interface{}, wo *WriteOptions) (string, error) {
+	value, err := e.Codec.Encode(category, config)
+	if err != nil {
+		return "", err
+	}
+	if wo.Compression != "" {
+		if value, err = source.Compress(wo.Compression, value); err != nil {
+			return "", err
+		}
+	}
+	if wo.Encrypt {
+		if value, err = source.Encrypt(e.Codec.KeyProvider, key, value); err != nil {
+			return "", err
+		}
+	}
+	if wo.SigningKey != nil {
+		if value, err = source.Sign(wo.SigningKey, key, value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// GetValue returns the raw value of key, or source.ErrConfigNotFound if it does not exist.
+// The chunked value is reassembled.
+func (c *client) GetValue(ctx context.Context, key string) (source.ConfigValue, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	resp, err := c.ecli.Get(ctx, key)
+	if err != nil {
+		return source.ConfigValue{}, err
+	}
+	if resp.Count == 0 {
+		return source.ConfigValue{}, source.ErrConfigNotFound
+	}
+	value, err := c.readChunks(ctx, key, string(resp.Kvs[0].Value))
+	if err != nil {
+		return source.ConfigValue{}, err
+	}
+	return source.ConfigValue{Key: key, Value: value, ModRevision: resp.Kvs[0].ModRevision}, nil
+}
+
+// ListConfigs returns the configs whose keys start with prefix, the static part of
+// Options.Prefix is used if prefix is empty. The chunked values are reassembled, and the
+// manifest is returned as is if its chunks are incomplete.
+func (c *client) ListConfigs(ctx context.Context, prefix string) ([]source.ConfigValue, error) {
+	if prefix == "" {
+		prefix = c.watchPrefix
+	}
+	if prefix == "" {
+		return nil, errors.New("[etcd] the prefix to list is empty")
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.etcdTimeout)
+	defer cancel()
+	resp, err := c.ecli.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+	values := make([]source.ConfigValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key, value := string(kv.Key), string(kv.Value)
+		if _, _, ok := isChunkKey(key); ok {
+			continue
+		}
+		if m, ok := parseManifest(value); ok {
+			if assembled, err := m.assemble(key, resp.Kvs); err == nil {
+				value = assembled
+			}
+		}
+		values = append(values, source.ConfigValue{Key: key, Value: value, ModRevision: kv.ModRevision})
+	}
+	return values, nil
+}
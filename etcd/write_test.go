@@ -0,0 +1,61 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+type testTimeout struct {
+	RPCTimeoutMS  int `json:"rpc_timeout_ms"`
+	ConnTimeoutMS int `json:"conn_timeout_ms"`
+}
+
+func TestConfigKey(t *testing.T) {
+	c, err := source.NewKeyRenderer(source.KeyOptions{})
+	test.Assert(t, err == nil, err)
+	key, err := c.ConfigKey(&ConfigParamConfig{Category: "retry", ClientServiceName: "c", ServerServiceName: "s"})
+	test.Assert(t, err == nil && key == "/KitexConfig/c/s/retry", key, err)
+	key, err = c.ConfigKey(&ConfigParamConfig{Category: "limit", ServerServiceName: "s"}, func(k *Key) {
+		k.Path += "-v2"
+	})
+	test.Assert(t, err == nil && key == "/KitexConfig/s/limit-v2", key, err)
+}
+
+func TestPutConfigSchema(t *testing.T) {
+	errInvalid := errors.New("invalid")
+	renderer, err := source.NewKeyRenderer(source.KeyOptions{})
+	test.Assert(t, err == nil, err)
+	c := &client{KeyRenderer: renderer, encoder: &ValueEncoder{}}
+	cpc := &ConfigParamConfig{Category: "rpc_timeout", ClientServiceName: "c", ServerServiceName: "s"}
+	// the validation is requested without a validator.
+	_, err = c.PutConfig(context.Background(), cpc, map[string]testTimeout{"*": {RPCTimeoutMS: -1}}, WithValidation())
+	test.Assert(t, errors.Is(err, ErrNoSchemaValidator), err)
+
+	c.encoder.SchemaValidator = func(category string, config interface{}) error {
+		if config.(map[string]testTimeout)["*"].RPCTimeoutMS < 0 {
+			return errInvalid
+		}
+		return nil
+	}
+	_, err = c.PutConfig(context.Background(), cpc, map[string]testTimeout{"*": {RPCTimeoutMS: -1}})
+	test.Assert(t, errors.Is(err, errInvalid), err)
+}
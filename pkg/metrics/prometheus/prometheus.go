@@ -0,0 +1,120 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prometheus implements etcd.Metrics with Prometheus.
+package prometheus
+
+import (
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kitex-contrib/config-etcd/etcd"
+)
+
+const namespace = "config_etcd"
+
+var _ etcd.Metrics = (*Metrics)(nil)
+
+// Metrics reports the health of the config sync to Prometheus.
+type Metrics struct {
+	updates         *prom.CounterVec
+	parseFailures   *prom.CounterVec
+	rejections      *prom.CounterVec
+	appliedRevision *prom.GaugeVec
+	lastSync        *prom.GaugeVec
+	watchRestarts   *prom.CounterVec
+	activeWatches   prom.Gauge
+}
+
+// NewMetrics creates the metrics and registers them to registerer, it panics if
+// the metrics have been registered.
+func NewMetrics(registerer prom.Registerer) *Metrics {
+	labels := []string{"category", "key"}
+	m := &Metrics{
+		updates: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "updates_received_total",
+			Help:      "Total number of the config updates received.",
+		}, labels),
+		parseFailures: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "parse_failures_total",
+			Help:      "Total number of the config updates failed to parse.",
+		}, labels),
+		rejections: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "rejections_total",
+			Help:      "Total number of the config updates rejected.",
+		}, labels),
+		appliedRevision: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "applied_revision",
+			Help:      "The etcd revision of the config applied, 0 if the default config is used.",
+		}, labels),
+		lastSync: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_sync_timestamp_seconds",
+			Help:      "The unix time when the config is last synced with etcd.",
+		}, []string{"key"}),
+		watchRestarts: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "watch_restarts_total",
+			Help:      "Total number of the etcd watch restarts.",
+		}, []string{"prefix"}),
+		activeWatches: prom.NewGauge(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_watches",
+			Help:      "The number of the active etcd watches.",
+		}),
+	}
+	registerer.MustRegister(m.updates, m.parseFailures, m.rejections, m.appliedRevision,
+		m.lastSync, m.watchRestarts, m.activeWatches)
+	return m
+}
+
+// UpdateReceived implements etcd.Metrics.
+func (m *Metrics) UpdateReceived(category, key string) {
+	m.updates.WithLabelValues(category, key).Inc()
+}
+
+// ParseFailed implements etcd.Metrics.
+func (m *Metrics) ParseFailed(category, key string) {
+	m.parseFailures.WithLabelValues(category, key).Inc()
+}
+
+// Rejected implements etcd.Metrics.
+func (m *Metrics) Rejected(category, key string) {
+	m.rejections.WithLabelValues(category, key).Inc()
+}
+
+// Applied implements etcd.Metrics.
+func (m *Metrics) Applied(category, key string, revision int64) {
+	m.appliedRevision.WithLabelValues(category, key).Set(float64(revision))
+}
+
+// Synced implements etcd.Metrics.
+func (m *Metrics) Synced(key string) {
+	m.lastSync.WithLabelValues(key).Set(float64(time.Now().UnixNano()) / float64(time.Second))
+}
+
+// WatchRestarted implements etcd.Metrics.
+func (m *Metrics) WatchRestarted(prefix string) {
+	m.watchRestarts.WithLabelValues(prefix).Inc()
+}
+
+// ActiveWatches implements etcd.Metrics.
+func (m *Metrics) ActiveWatches(n int) {
+	m.activeWatches.Set(float64(n))
+}
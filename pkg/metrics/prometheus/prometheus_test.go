@@ -0,0 +1,47 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	const key = "/KitexConfig/client/server/retry"
+	m := NewMetrics(prom.NewRegistry())
+
+	m.UpdateReceived("retry", key)
+	m.UpdateReceived("retry", key)
+	m.ParseFailed("retry", key)
+	m.Rejected("retry", key)
+	m.Applied("retry", key, 42)
+	m.WatchRestarted("/KitexConfig/")
+	m.ActiveWatches(2)
+	m.Synced(key)
+
+	test.Assert(t, testutil.ToFloat64(m.updates.WithLabelValues("retry", key)) == 2)
+	test.Assert(t, testutil.ToFloat64(m.parseFailures.WithLabelValues("retry", key)) == 1)
+	test.Assert(t, testutil.ToFloat64(m.rejections.WithLabelValues("retry", key)) == 1)
+	test.Assert(t, testutil.ToFloat64(m.appliedRevision.WithLabelValues("retry", key)) == 42)
+	test.Assert(t, testutil.ToFloat64(m.watchRestarts.WithLabelValues("/KitexConfig/")) == 1)
+	test.Assert(t, testutil.ToFloat64(m.activeWatches) == 2)
+	lastSync := testutil.ToFloat64(m.lastSync.WithLabelValues(key))
+	test.Assert(t, time.Since(time.Unix(int64(lastSync), 0)) < time.Minute, lastSync)
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudwego/kitex/pkg/circuitbreak"
+	"github.com/cloudwego/kitex/pkg/limiter"
+	"github.com/cloudwego/kitex/pkg/retry"
+	"github.com/cloudwego/kitex/pkg/rpctimeout"
+
+	"github.com/kitex-contrib/config-etcd/pkg/degradation"
+)
+
+// the limits follow the ones checked by kitex when the policies are updated.
+const (
+	maxFailureRetryTimes = 5
+	maxBackupRetryTimes  = 2
+	maxRetryCBErrorRate  = 0.3
+)
+
+var builtinValidators = map[string]Validator{
+	RetryCategory:          validateRetry,
+	RPCTimeoutCategory:     validateRPCTimeout,
+	CircuitBreakerCategory: validateCircuitBreaker,
+	DegradationCategory:    validateDegradation,
+	LimiterCategory:        validateLimiter,
+}
+
+func unexpectedType(config interface{}) error {
+	return fmt.Errorf("unexpected config type %T", config)
+}
+
+func validateRetry(config interface{}) error {
+	policies, ok := config.(map[string]*retry.Policy)
+	if !ok {
+		return unexpectedType(config)
+	}
+	for method, policy := range policies {
+		if err := validateRetryPolicy(policy); err != nil {
+			return fmt.Errorf("method %s: %w", method, err)
+		}
+	}
+	return nil
+}
+
+func validateRetryPolicy(policy *retry.Policy) error {
+	if policy == nil {
+		return errors.New("policy is empty")
+	}
+	if !policy.Enable {
+		return nil
+	}
+	switch policy.Type {
+	case retry.FailureType:
+		if policy.FailurePolicy == nil {
+			return errors.New("failure_policy must not be empty for failure retry")
+		}
+		if err := validateStopPolicy(&policy.FailurePolicy.StopPolicy, maxFailureRetryTimes); err != nil {
+			return err
+		}
+		return validateBackOffPolicy(policy.FailurePolicy.BackOffPolicy)
+	case retry.BackupType:
+		if policy.BackupPolicy == nil {
+			return errors.New("backup_policy must not be empty for backup request")
+		}
+		return validateStopPolicy(&policy.BackupPolicy.StopPolicy, maxBackupRetryTimes)
+	default:
+		return fmt.Errorf("unknown retry type %d", policy.Type)
+	}
+}
+
+func validateStopPolicy(p *retry.StopPolicy, maxRetryTimes int) error {
+	if p.MaxRetryTimes < 0 || p.MaxRetryTimes > maxRetryTimes {
+		return fmt.Errorf("max_retry_times %d is out of range [0, %d]", p.MaxRetryTimes, maxRetryTimes)
+	}
+	if p.CBPolicy.ErrorRate < 0 || p.CBPolicy.ErrorRate > maxRetryCBErrorRate {
+		return fmt.Errorf("cb_policy error_rate %v is out of range [0, %v]", p.CBPolicy.ErrorRate, maxRetryCBErrorRate)
+	}
+	return nil
+}
+
+func validateBackOffPolicy(p *retry.BackOffPolicy) error {
+	if p == nil {
+		return nil
+	}
+	switch p.BackOffType {
+	case "", retry.NoneBackOffType:
+	case retry.FixedBackOffType:
+		if p.CfgItems[retry.FixMSBackOffCfgKey] <= 0 {
+			return errors.New("fix_ms must be positive for fixed backoff")
+		}
+	case retry.RandomBackOffType:
+		minMS, maxMS := p.CfgItems[retry.MinMSBackOffCfgKey], p.CfgItems[retry.MaxMSBackOffCfgKey]
+		if minMS < 0 || maxMS <= minMS {
+			return fmt.Errorf("min_ms %v and max_ms %v are invalid for random backoff", minMS, maxMS)
+		}
+	default:
+		return fmt.Errorf("unknown backoff_type %s", p.BackOffType)
+	}
+	return nil
+}
+
+func validateRPCTimeout(config interface{}) error {
+	timeouts, ok := config.(map[string]*rpctimeout.RPCTimeout)
+	if !ok {
+		return unexpectedType(config)
+	}
+	for method, timeout := range timeouts {
+		if timeout == nil {
+			return fmt.Errorf("method %s: timeout is empty", method)
+		}
+		if timeout.RPCTimeoutMS < 0 || timeout.ConnTimeoutMS < 0 {
+			return fmt.Errorf("method %s: rpc_timeout_ms %d and conn_timeout_ms %d must not be negative",
+				method, timeout.RPCTimeoutMS, timeout.ConnTimeoutMS)
+		}
+	}
+	return nil
+}
+
+func validateCircuitBreaker(config interface{}) error {
+	configs, ok := config.(map[string]circuitbreak.CBConfig)
+	if !ok {
+		return unexpectedType(config)
+	}
+	for method, cfg := range configs {
+		if cfg.ErrRate < 0 || cfg.ErrRate > 1 {
+			return fmt.Errorf("method %s: err_rate %v is out of range [0, 1]", method, cfg.ErrRate)
+		}
+		if cfg.MinSample < 0 {
+			return fmt.Errorf("method %s: min_sample %d must not be negative", method, cfg.MinSample)
+		}
+	}
+	return nil
+}
+
+func validateDegradation(config interface{}) error {
+	cfg, ok := config.(*degradation.Config)
+	if !ok {
+		return unexpectedType(config)
+	}
+	if cfg.Percentage < 0 || cfg.Percentage > 100 {
+		return fmt.Errorf("percentage %d is out of range [0, 100]", cfg.Percentage)
+	}
+	return nil
+}
+
+func validateLimiter(config interface{}) error {
+	cfg, ok := config.(*limiter.LimiterConfig)
+	if !ok {
+		return unexpectedType(config)
+	}
+	if cfg.ConnectionLimit < 0 || cfg.QPSLimit < 0 {
+		return fmt.Errorf("connection_limit %d and qps_limit %d must not be negative", cfg.ConnectionLimit, cfg.QPSLimit)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validation checks the governance configs before they are applied.
+package validation
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The categories of the governance configs.
+const (
+	RetryCategory          = "retry"
+	RPCTimeoutCategory     = "rpc_timeout"
+	CircuitBreakerCategory = "circuit_break"
+	DegradationCategory    = "degradation"
+	LimiterCategory        = "limit"
+)
+
+// Validator checks the decoded config of a category, the config is rejected if it returns an error.
+// The config types are the same as the ones decoded by the suites:
+//   - retry: map[string]*retry.Policy
+//   - rpc_timeout: map[string]*rpctimeout.RPCTimeout
+//   - circuit_break: map[string]circuitbreak.CBConfig
+//   - degradation: *degradation.Config
+//   - limit: *limiter.LimiterConfig
+type Validator func(config interface{}) error
+
+// Error is the error of a config rejected by the validators.
+type Error struct {
+	Category string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s config: %v", e.Category, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var (
+	mu         sync.RWMutex
+	validators = map[string][]Validator{}
+)
+
+// Register registers a validator for the category, it runs after the built-in rules.
+func Register(category string, v Validator) {
+	mu.Lock()
+	defer mu.Unlock()
+	validators[category] = append(validators[category], v)
+}
+
+// Validate runs the built-in rules and the registered validators of the category on config,
+// it returns an *Error if the config is rejected. It is the etcd.SchemaValidator to check the
+// configs written by etcd.Options.SchemaValidator.
+func Validate(category string, config interface{}) error {
+	if v, ok := builtinValidators[category]; ok {
+		if err := v(config); err != nil {
+			return &Error{Category: category, Err: err}
+		}
+	}
+	mu.RLock()
+	vs := validators[category]
+	mu.RUnlock()
+	for _, v := range vs {
+		if err := v(config); err != nil {
+			return &Error{Category: category, Err: err}
+		}
+	}
+	return nil
+}
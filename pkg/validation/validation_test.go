@@ -0,0 +1,73 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/circuitbreak"
+	"github.com/cloudwego/kitex/pkg/limiter"
+	"github.com/cloudwego/kitex/pkg/retry"
+	"github.com/cloudwego/kitex/pkg/rpctimeout"
+	"github.com/cloudwego/thriftgo/pkg/test"
+
+	"github.com/kitex-contrib/config-etcd/pkg/degradation"
+)
+
+func TestBuiltinValidators(t *testing.T) {
+	for name, tc := range map[string]struct {
+		category string
+		config   interface{}
+		valid    bool
+	}{
+		"limiter":                {LimiterCategory, &limiter.LimiterConfig{ConnectionLimit: 100, QPSLimit: 1000}, true},
+		"negative qps":           {LimiterCategory, &limiter.LimiterConfig{QPSLimit: -1}, false},
+		"degradation":            {DegradationCategory, &degradation.Config{Enable: true, Percentage: 50}, true},
+		"degradation over 100":   {DegradationCategory, &degradation.Config{Enable: true, Percentage: 101}, false},
+		"circuit breaker":        {CircuitBreakerCategory, map[string]circuitbreak.CBConfig{"*": {Enable: true, ErrRate: 0.5, MinSample: 200}}, true},
+		"err rate over 1":        {CircuitBreakerCategory, map[string]circuitbreak.CBConfig{"*": {Enable: true, ErrRate: 5}}, false},
+		"rpc timeout":            {RPCTimeoutCategory, map[string]*rpctimeout.RPCTimeout{"*": {RPCTimeoutMS: 1000}}, true},
+		"negative rpc timeout":   {RPCTimeoutCategory, map[string]*rpctimeout.RPCTimeout{"*": {RPCTimeoutMS: -1}}, false},
+		"disabled retry":         {RetryCategory, map[string]*retry.Policy{"*": {Enable: false}}, true},
+		"retry without policies": {RetryCategory, map[string]*retry.Policy{"*": {Enable: true}}, false},
+		"too many retries": {RetryCategory, map[string]*retry.Policy{"*": {
+			Enable:        true,
+			Type:          retry.FailureType,
+			FailurePolicy: &retry.FailurePolicy{StopPolicy: retry.StopPolicy{MaxRetryTimes: 10}},
+		}}, false},
+		"unexpected type": {LimiterCategory, limiter.LimiterConfig{}, false},
+	} {
+		err := Validate(tc.category, tc.config)
+		test.Assert(t, (err == nil) == tc.valid, name, err)
+		var verr *Error
+		test.Assert(t, err == nil || errors.As(err, &verr) && verr.Category == tc.category, name, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	const category = "test"
+	test.Assert(t, Validate(category, 1) == nil)
+
+	errTooLarge := errors.New("too large")
+	Register(category, func(config interface{}) error {
+		if config.(int) > 10 {
+			return errTooLarge
+		}
+		return nil
+	})
+	test.Assert(t, Validate(category, 1) == nil)
+	test.Assert(t, errors.Is(Validate(category, 11), errTooLarge))
+}
@@ -21,6 +21,8 @@ import (
 	"github.com/kitex-contrib/config-etcd/utils"
 
 	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/pkg/validation"
+	"github.com/kitex-contrib/config-etcd/source"
 
 	"github.com/cloudwego/kitex/pkg/klog"
 	"github.com/cloudwego/kitex/pkg/limit"
@@ -29,25 +31,33 @@ import (
 )
 
 // WithLimiter sets the limiter config from etcd configuration center.
-func WithLimiter(dest string, etcdClient etcd.Client, uniqueID int64, opts utils.Options) server.Option {
-	param, err := etcdClient.ServerConfigParam(&etcd.ConfigParamConfig{
+func WithLimiter(dest string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) server.Option {
+	option, _ := withLimiter(context.Background(), dest, configSource, uniqueID, opts)
+	return option
+}
+
+func withLimiter(ctx context.Context, dest string, configSource source.ConfigSource, uniqueID int64, opts utils.Options) (server.Option, error) {
+	cpc := &etcd.ConfigParamConfig{
 		Category:          limiterConfigName,
 		ServerServiceName: dest,
-	})
+		Dimensions:        opts.ConfigDimensions(),
+	}
+	key, err := configSource.ServerConfigKey(cpc, opts.EtcdCustomFunctions...)
 	if err != nil {
 		panic(err)
 	}
-	for _, f := range opts.EtcdCustomFunctions {
-		f(&param)
+	layers, err := configSource.ServerConfigLayers(cpc, opts.EtcdCustomFunctions...)
+	if err != nil {
+		panic(err)
 	}
-	key := param.Prefix + "/" + param.Path
 	server.RegisterShutdownHook(func() {
-		etcdClient.DeregisterConfig(key, uniqueID)
+		configSource.DeregisterConfig(key, uniqueID)
 	})
-	return server.WithLimit(initLimitOptions(key, uniqueID, etcdClient))
+	opt, err := initLimitOptions(ctx, cpc, key, layers, uniqueID, configSource, opts)
+	return server.WithLimit(opt), err
 }
 
-func initLimitOptions(key string, uniqueID int64, etcdClient etcd.Client) *limit.Option {
+func initLimitOptions(ctx context.Context, cpc *etcd.ConfigParamConfig, key string, layers []string, uniqueID int64, configSource source.ConfigSource, opts utils.Options) (*limit.Option, error) {
 	var updater atomic.Value
 	opt := &limit.Option{}
 	opt.UpdateControl = func(u limit.Updater) {
@@ -55,14 +65,18 @@ func initLimitOptions(key string, uniqueID int64, etcdClient etcd.Client) *limit
 		u.UpdateLimit(opt)
 		updater.Store(u)
 	}
-	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser) {
+	onChangeCallback := func(restoreDefault bool, data string, parser etcd.ConfigParser, _ source.ConfigMeta) error {
 		lc := &limiter.LimiterConfig{}
 
 		if !restoreDefault {
 			err := parser.Decode(data, lc)
 			if err != nil {
 				klog.Warnf("[etcd] %s server etcd limiter config: unmarshal data %s failed: %s, skip...", key, data, err)
-				return
+				return err
+			}
+			if err = opts.Validate(key, validation.LimiterCategory, lc); err != nil {
+				klog.Warnf("[etcd] %s server etcd limiter config: %s, keep the last valid config", key, err)
+				return err
 			}
 		}
 
@@ -71,12 +85,14 @@ func initLimitOptions(key string, uniqueID int64, etcdClient etcd.Client) *limit
 		u := updater.Load()
 		if u == nil {
 			klog.Warnf("[etcd] %s server etcd limiter config failed as the updater is empty", key)
-			return
+			return nil
 		}
 		if !u.(limit.Updater).UpdateLimit(opt) {
 			klog.Warnf("[etcd] %s server etcd limiter config: data %s may do not take affect", key, data)
 		}
+		return nil
 	}
-	etcdClient.RegisterConfigCallback(context.Background(), key, uniqueID, onChangeCallback)
-	return opt
+	err := configSource.RegisterConfigCallback(ctx, key, uniqueID, onChangeCallback,
+		source.WithConfigParam(cpc), source.WithLayers(layers...), source.WithListeners(opts.ConfigListeners...))
+	return opt, err
 }
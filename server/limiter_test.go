@@ -0,0 +1,57 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/etcd/etcdtest"
+	"github.com/kitex-contrib/config-etcd/pkg/validation"
+	"github.com/kitex-contrib/config-etcd/utils"
+)
+
+func TestLimiterCallback(t *testing.T) {
+	etcdClient, err := etcdtest.NewClient(etcd.Options{})
+	test.Assert(t, err == nil, err)
+	cpc := &etcd.ConfigParamConfig{Category: limiterConfigName, ServerServiceName: "echo"}
+	key, err := etcdClient.ConfigKey(cpc)
+	test.Assert(t, err == nil, err)
+	test.Assert(t, key == "/KitexConfig/echo/limit", key)
+	etcdClient.Put(key, `{"connection_limit":100,"qps_limit":1000}`)
+
+	var rejected []string
+	opts := utils.Options{OnConfigRejected: func(key string, err *validation.Error) {
+		rejected = append(rejected, key)
+	}}
+	opt, err := initLimitOptions(context.Background(), cpc, key, nil, 1, etcdClient, opts)
+	test.Assert(t, err == nil, err)
+	test.Assert(t, etcdClient.Registered(key, 1), etcdClient.RegisteredKeys())
+	test.Assert(t, opt.MaxConnections == 100 && opt.MaxQPS == 1000, opt)
+
+	etcdClient.Put(key, `{"qps_limit":2000}`)
+	etcdClient.Put(key, `{"qps_limit":-1}`)
+	ok, err := etcdClient.Step()
+	test.Assert(t, ok && err == nil && opt.MaxConnections == 0 && opt.MaxQPS == 2000, opt, err)
+	ok, err = etcdClient.Step()
+	test.Assert(t, ok && err != nil && opt.MaxQPS == 2000, opt)
+	test.Assert(t, len(rejected) == 1 && rejected[0] == key, rejected)
+
+	etcdClient.Delete(key)
+	test.Assert(t, etcdClient.Flush() == nil)
+	test.Assert(t, opt.MaxConnections == 0 && opt.MaxQPS == 0, opt)
+}
@@ -15,8 +15,12 @@
 package server
 
 import (
+	"context"
+	"time"
+
 	"github.com/cloudwego/kitex/server"
 	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/source"
 	"github.com/kitex-contrib/config-etcd/utils"
 )
 
@@ -26,21 +30,23 @@ const (
 
 // EtcdServerSuite etcd server config suite, configure limiter config dynamically from etcd.
 type EtcdServerSuite struct {
-	uid        int64
-	etcdClient etcd.Client
-	service    string
-	opts       utils.Options
+	uid          int64
+	configSource source.ConfigSource
+	service      string
+	opts         utils.Options
+	// options is built when the suite is created by NewSuiteWithInitialLoad.
+	options []server.Option
 }
 
 // NewSuite service is the destination service.
-func NewSuite(service string, cli etcd.Client,
+func NewSuite(service string, cli source.ConfigSource,
 	opts ...utils.Option,
 ) *EtcdServerSuite {
 	uid := etcd.AllocateUniqueID()
 	su := &EtcdServerSuite{
-		uid:        uid,
-		service:    service,
-		etcdClient: cli,
+		uid:          uid,
+		service:      service,
+		configSource: cli,
 	}
 	for _, opt := range opts {
 		opt.Apply(&su.opts)
@@ -48,9 +54,35 @@ func NewSuite(service string, cli etcd.Client,
 	return su
 }
 
+// NewSuiteWithInitialLoad is like NewSuite, but it registers the configs immediately and waits,
+// at most timeout, for the first read of every config key. It returns an *source.InitialLoadError
+// listing the keys failed to load, so that the caller can fail fast. The returned suite is
+// usable even if the error is not nil, and keeps watching all the keys.
+func NewSuiteWithInitialLoad(service string, cli source.ConfigSource, timeout time.Duration,
+	opts ...utils.Option,
+) (*EtcdServerSuite, error) {
+	su := NewSuite(service, cli, opts...)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var err error
+	su.options, err = su.buildOptions(ctx)
+	return su, err
+}
+
 // Options return a list server.Option
 func (s *EtcdServerSuite) Options() []server.Option {
-	opts := make([]server.Option, 0, 2)
-	opts = append(opts, WithLimiter(s.service, s.etcdClient, s.uid, s.opts))
+	if s.options != nil {
+		return s.options
+	}
+	opts, _ := s.buildOptions(context.Background())
 	return opts
 }
+
+func (s *EtcdServerSuite) buildOptions(ctx context.Context) ([]server.Option, error) {
+	opts := make([]server.Option, 0, 2)
+	loadErr := &source.InitialLoadError{}
+	opt, err := withLimiter(ctx, s.service, s.configSource, s.uid, s.opts)
+	opts = append(opts, opt)
+	loadErr.Add(err)
+	return opts, loadErr.ErrorOrNil()
+}
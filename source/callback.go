@@ -0,0 +1,58 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+// ConfigMeta is the metadata of the config value delivered to the callback.
+type ConfigMeta struct {
+	// Revision is the revision of the value, e.g. the etcd ModRevision, zero if the key is deleted.
+	Revision int64
+	// FromSnapshot is true if the value is loaded from the local snapshot as the source is unreachable.
+	FromSnapshot bool
+}
+
+// ConfigCallback is called with the latest value of the config key, restoreDefault is true
+// if the key is deleted. It returns an error if the value is not applied.
+type ConfigCallback func(restoreDefault bool, data string, parser ConfigParser, meta ConfigMeta) error
+
+// RegisterOption is the option of ConfigSource.RegisterConfigCallback.
+type RegisterOption func(*RegisterOptions)
+
+// RegisterOptions are the options of a registration, they are exported for the ConfigSource
+// implementations.
+type RegisterOptions struct {
+	Param     *ConfigParamConfig
+	Listeners []ConfigListener
+	Layers    []string
+	// Override is the key of the temporary override on top of the registered key, empty if
+	// there is none. It is set by etcd.Options.EnableOverrides and file.Options.EnableOverrides.
+	Override string
+}
+
+// NewRegisterOptions applies opts to an empty RegisterOptions.
+func NewRegisterOptions(opts ...RegisterOption) *RegisterOptions {
+	ro := &RegisterOptions{}
+	for _, opt := range opts {
+		opt(ro)
+	}
+	return ro
+}
+
+// WithConfigParam sets the config parameters used to render the key, the parser of the
+// category is used to decode the value if it is set in the CategoryParsers of the source.
+func WithConfigParam(cpc *ConfigParamConfig) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.Param = cpc
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"crypto/ed25519"
+	"time"
+)
+
+// Codec decodes the config values of a ConfigSource, it is shared by the implementations
+// so that they resolve the envelopes of the values in the same way.
+type Codec struct {
+	// Parser decodes the values of the categories not in CategoryParsers.
+	Parser          ConfigParser
+	CategoryParsers map[string]ConfigParser
+	// KeyProvider decrypts the encrypted values, they are not decrypted if it is nil.
+	KeyProvider KeyProvider
+	// TrustedKeys verify the signature of the values, the signature envelope is removed without
+	// verification if it is nil.
+	TrustedKeys map[string]ed25519.PublicKey
+	// Instance selects the value of the rollout envelope applying to the process.
+	Instance Instance
+	// Now returns the time to select the variant of the schedule envelope, time.Now if nil.
+	Now func() time.Time
+	// MaxDecompressedSize limits the size of the values decompressed, DefaultMaxDecompressedSize if zero.
+	MaxDecompressedSize int64
+}
+
+// ParserOf returns the parser of the values of key in the category, which selects the value of
+// the rollout envelope applying to the instance and the variant of the schedule envelope applying
+// now, decompresses the compressed values, decrypts the encrypted values if KeyProvider is set,
+// and verifies the signature first if TrustedKeys is set. The signature and the encryption are
+// bound to key.
+// The signature envelope is removed without verification otherwise, so that the writers can
+// sign the values before the readers trust the keys.
+func (c *Codec) ParserOf(key, category string) ConfigParser {
+	parser := NewDecompressParser(c.parserOf(category), c.MaxDecompressedSize)
+	if c.KeyProvider != nil {
+		parser = NewDecryptParser(parser, c.KeyProvider, key)
+	}
+	now := c.Now
+	if now == nil {
+		now = time.Now
+	}
+	parser = NewScheduleParser(parser, now)
+	return NewVerifyParser(NewRolloutParser(parser, c.Instance), c.TrustedKeys, key)
+}
+
+// parserOf returns the parser of the category in CategoryParsers, or Parser.
+func (c *Codec) parserOf(category string) ConfigParser {
+	if p, ok := c.CategoryParsers[category]; ok {
+		return p
+	}
+	return c.Parser
+}
+
+// Decode decodes value of key in the category into config, the errors are wrapped in ParseError.
+func (c *Codec) Decode(key, category, value string, config interface{}) error {
+	return parseErrorParser{c.ParserOf(key, category)}.Decode(value, config)
+}
+
+// Encode encodes config by the parser of the category, or in json if it is not a ConfigEncoder.
+func (c *Codec) Encode(category string, config interface{}) (string, error) {
+	if encoder, ok := c.parserOf(category).(ConfigEncoder); ok {
+		return encoder.Encode(config)
+	}
+	return encodeJSON(config)
+}
+
+// NextBoundary returns the next boundary after now of the windows of the scheduled variants
+// of value, when the variant applying to the instance may change.
+func (c *Codec) NextBoundary(value string, now time.Time) (time.Time, bool) {
+	return NextBoundary(value, c.Instance, now)
+}
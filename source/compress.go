@@ -0,0 +1,210 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressedPrefix is the prefix of the compressed envelope of a config value, which is
+// "cmp:v1:{compressor name}:{base64 of the compressed value}".
+const CompressedPrefix = "cmp:v1:"
+
+const (
+	// CompressorGzip and CompressorZstd are the names of the gzip and the zstd Compressors,
+	// which are registered by default.
+	CompressorGzip = "gzip"
+	CompressorZstd = "zstd"
+
+	// DefaultMaxDecompressedSize is the default limit of the size of a value decompressed, so that
+	// a small compressed value can not exhaust the memory of the readers.
+	DefaultMaxDecompressedSize = 16 << 20
+)
+
+// ErrDecompressedTooLarge is returned by Decompress if the value decompressed exceeds the limit.
+var ErrDecompressedTooLarge = errors.New("[config] decompressed config is too large")
+
+// Compressor compresses the config values, e.g. in gzip or zstd.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	// NewReader returns the reader of the data decompressed from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	compressorMu sync.RWMutex
+	compressors  = map[string]Compressor{CompressorGzip: gzipCompressor{}, CompressorZstd: zstdCompressor{}}
+)
+
+// RegisterCompressor registers c by name, e.g. "lz4", so that the values compressed by it can
+// be decompressed, and written with WithCompression(name). It must be registered by all the
+// readers before the values are written.
+func RegisterCompressor(name string, c Compressor) {
+	compressorMu.Lock()
+	defer compressorMu.Unlock()
+	compressors[name] = c
+}
+
+func compressorOf(name string) (Compressor, error) {
+	compressorMu.RLock()
+	defer compressorMu.RUnlock()
+	c, ok := compressors[name]
+	if !ok {
+		return nil, fmt.Errorf("[config] unknown compressor %q", name)
+	}
+	return c, nil
+}
+
+// IsCompressed reports whether value is in the compressed envelope.
+func IsCompressed(value string) bool {
+	return strings.HasPrefix(value, CompressedPrefix)
+}
+
+// Compress compresses value by the compressor of name in the compressed envelope.
+func Compress(name, value string) (string, error) {
+	if strings.Contains(name, ":") {
+		return "", fmt.Errorf("[config] compressor name %q contains ':'", name)
+	}
+	c, err := compressorOf(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := c.Compress([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	return CompressedPrefix + name + ":" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decompress decompresses the value in the compressed envelope, the value not in the
+// envelope is returned as is. It returns ErrDecompressedTooLarge if the value decompressed
+// exceeds limit bytes, DefaultMaxDecompressedSize if limit is not positive.
+func Decompress(value string, limit int64) (string, error) {
+	if !IsCompressed(value) {
+		return value, nil
+	}
+	envelope := strings.TrimPrefix(value, CompressedPrefix)
+	i := strings.Index(envelope, ":")
+	if i < 0 {
+		return "", errors.New("[config] malformed compressed config")
+	}
+	c, err := compressorOf(envelope[:i])
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(envelope[i+1:])
+	if err != nil {
+		return "", fmt.Errorf("[config] malformed compressed config: %w", err)
+	}
+	if data, err = decompress(c, data, limit); err != nil {
+		return "", fmt.Errorf("[config] decompress config by %s failed: %w", envelope[:i], err)
+	}
+	return string(data), nil
+}
+
+// decompress reads at most limit bytes decompressed from data by c.
+func decompress(c Compressor, data []byte, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		limit = DefaultMaxDecompressedSize
+	}
+	r, err := c.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// read one more byte to tell the value of exactly limit bytes from the larger ones.
+	if data, err = io.ReadAll(io.LimitReader(r, limit+1)); err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrDecompressedTooLarge, limit)
+	}
+	return data, nil
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) Compress(data []byte) ([]byte, error) {
+	w, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+	return w.EncodeAll(data, nil), nil
+}
+
+func (zstdCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// decompressParser decompresses the values in the compressed envelope before decoding them.
+type decompressParser struct {
+	ConfigParser
+	limit int64
+}
+
+// NewDecompressParser returns a ConfigParser which decompresses the values in the compressed
+// envelope before decoding them by parser, the other values are decoded as is. The values
+// decompressed are limited to limit bytes, DefaultMaxDecompressedSize if limit is not positive.
+func NewDecompressParser(parser ConfigParser, limit int64) ConfigParser {
+	return &decompressParser{ConfigParser: parser, limit: limit}
+}
+
+func (p *decompressParser) Decode(data string, config interface{}) error {
+	plain, err := Decompress(data, p.limit)
+	if err != nil {
+		return err
+	}
+	return p.ConfigParser.Decode(plain, config)
+}
+
+// Encode encodes config by the parser, or in json if it is not a ConfigEncoder.
+func (p *decompressParser) Encode(config interface{}) (string, error) {
+	if encoder, ok := p.ConfigParser.(ConfigEncoder); ok {
+		return encoder.Encode(config)
+	}
+	return encodeJSON(config)
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+func TestCompress(t *testing.T) {
+	value := strings.Repeat(`{"rpc_timeout_ms":1000}`, 100)
+	compressed, err := Compress(CompressorGzip, value)
+	test.Assert(t, err == nil && IsCompressed(compressed) && len(compressed) < len(value), compressed, err)
+	got, err := Decompress(compressed, 0)
+	test.Assert(t, err == nil && got == value, got, err)
+	got, err = Decompress(value, 0)
+	test.Assert(t, err == nil && got == value)
+	_, err = Compress("lz4", value)
+	test.Assert(t, err != nil)
+
+	compressed, err = Compress(CompressorZstd, value)
+	test.Assert(t, err == nil && IsCompressed(compressed) && len(compressed) < len(value), compressed, err)
+	got, err = Decompress(compressed, 0)
+	test.Assert(t, err == nil && got == value, got, err)
+
+	var config map[string]int
+	parser := NewDecompressParser(defaultConfigParse(), 0)
+	compressed, _ = Compress(CompressorGzip, `{"qps_limit":100}`)
+	test.Assert(t, parser.Decode(compressed, &config) == nil && config["qps_limit"] == 100, config)
+}
+
+func TestDecompressLimit(t *testing.T) {
+	value := strings.Repeat("0", 1<<20)
+	for _, name := range []string{CompressorGzip, CompressorZstd} {
+		compressed, err := Compress(name, value)
+		test.Assert(t, err == nil, err)
+		got, err := Decompress(compressed, int64(len(value)))
+		test.Assert(t, err == nil && got == value, name, err)
+		// the value decompressed larger than the limit is rejected without reading it all.
+		_, err = Decompress(compressed, int64(len(value))-1)
+		test.Assert(t, errors.Is(err, ErrDecompressedTooLarge), name, err)
+	}
+
+	var config map[string]string
+	compressed, _ := Compress(CompressorZstd, `{"a":"`+value+`"}`)
+	err := NewDecompressParser(defaultConfigParse(), 1024).Decode(compressed, &config)
+	test.Assert(t, errors.Is(err, ErrDecompressedTooLarge), err)
+}
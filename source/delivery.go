@@ -0,0 +1,121 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Update is a value of a key to deliver to the subscribers.
+type Update struct {
+	Key   string
+	Value string
+	// ModRevision is the revision of Value, zero if the key is deleted.
+	ModRevision  int64
+	FromSnapshot bool
+	// Force delivers the value even if its revision has been delivered, e.g. when the variant
+	// of its schedule envelope applying changes.
+	Force bool
+}
+
+// Subscriber is a callback registered on a key of a ConfigSource. It is shared by the
+// implementations so that the values are delivered and reported in the same way.
+type Subscriber struct {
+	Callback ConfigCallback
+	// Param is the config parameters of the key, empty if it is unknown.
+	Param     ConfigParamConfig
+	Listeners []ConfigListener
+
+	// modRevision is the revision of the value delivered, value is the last value applied, and
+	// signedAt is when it is signed if the signature is verified.
+	modRevision int64
+	value       string
+	signedAt    time.Time
+	// err is the error returned by the callback for the value.
+	err error
+}
+
+// NewSubscriber returns the Subscriber of callback registered with ro.
+func NewSubscriber(callback ConfigCallback, ro *RegisterOptions) *Subscriber {
+	s := &Subscriber{Callback: callback, Listeners: ro.Listeners}
+	if ro.Param != nil {
+		s.Param = *ro.Param
+	}
+	return s
+}
+
+// Deliver delivers u to the callback with parser unless its revision has been delivered, the
+// errors of parser are wrapped in ParseError. It returns the event of the delivery, or nil if it
+// is skipped. The listeners are not called, the caller publishes the event after releasing its
+// locks so that the listeners can call the ConfigSource.
+//
+// If parser verifies the signature by the trusted keys, the deletion of a key whose value has
+// been applied is rejected with ErrUnverifiedDeletion, since it can not be signed, except the
+// deletion of an override which restores the verified config under it. The value signed earlier
+// than the value applied is rejected with ErrStaleSignature, so an old signed value can not be
+// replayed.
+func (s *Subscriber) Deliver(u Update, parser ConfigParser) *ConfigEvent {
+	if s.modRevision == u.ModRevision && !u.Force {
+		return nil
+	}
+	s.modRevision = u.ModRevision
+	parser = parseErrorParser{parser}
+	meta := ConfigMeta{Revision: u.ModRevision, FromSnapshot: u.FromSnapshot}
+	event := &ConfigEvent{
+		Key:               u.Key,
+		Category:          s.Param.Category,
+		ServerServiceName: s.Param.ServerServiceName,
+		ClientServiceName: s.Param.ClientServiceName,
+		OldValue:          s.value,
+		Revision:          u.ModRevision,
+		FromSnapshot:      u.FromSnapshot,
+	}
+	verified := verifies(parser)
+	var signedAt time.Time
+	switch {
+	case u.ModRevision == 0 && verified && s.value != "" && !strings.HasSuffix(u.Key, OverrideSuffix):
+		s.err = fmt.Errorf("%w: %s, the last verified config is kept", ErrUnverifiedDeletion, u.Key)
+	case u.ModRevision == 0:
+		s.err = s.Callback(true, "", parser, meta)
+		event.Type = EventRestored
+	default:
+		event.NewValue = u.Value
+		event.Type = EventApplied
+		if at, ok := SignedAt(u.Value); ok && verified {
+			signedAt = at
+			if signedAt.Before(s.signedAt) {
+				s.err = fmt.Errorf("%w: %s is signed at %s before the config applied at %s", ErrStaleSignature,
+					u.Key, signedAt.Format(time.RFC3339), s.signedAt.Format(time.RFC3339))
+				break
+			}
+		}
+		s.err = s.Callback(false, u.Value, parser, meta)
+	}
+	if s.err != nil {
+		event.Type = EventRejected
+		event.Err = s.err
+	} else {
+		s.value = event.NewValue
+		s.signedAt = signedAt
+	}
+	return event
+}
+
+// Err returns the error of the callback for the last value delivered.
+func (s *Subscriber) Err() error {
+	return s.err
+}
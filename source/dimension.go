@@ -0,0 +1,150 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// The environment variables of the dimensions, the tags are in the form of "k1=v1,k2=v2".
+const (
+	EnvConfigEnv        = "KITEX_CONFIG_ENV"
+	EnvConfigCluster    = "KITEX_CONFIG_CLUSTER"
+	EnvConfigRegion     = "KITEX_CONFIG_REGION"
+	EnvConfigIDC        = "KITEX_CONFIG_IDC"
+	EnvConfigInstanceID = "KITEX_CONFIG_INSTANCE_ID"
+	EnvConfigTags       = "KITEX_CONFIG_TAGS"
+)
+
+// Dimensions are the deployment dimensions of the instance, which can be used in the
+// prefix and path templates, e.g. {{.Env}} and {{index .Tags "zone"}}.
+type Dimensions struct {
+	Env        string
+	Cluster    string
+	Region     string
+	IDC        string
+	InstanceID string
+	Tags       map[string]string
+}
+
+// DimensionsFromEnv reads the dimensions from the environment variables.
+func DimensionsFromEnv() Dimensions {
+	d := Dimensions{
+		Env:        os.Getenv(EnvConfigEnv),
+		Cluster:    os.Getenv(EnvConfigCluster),
+		Region:     os.Getenv(EnvConfigRegion),
+		IDC:        os.Getenv(EnvConfigIDC),
+		InstanceID: os.Getenv(EnvConfigInstanceID),
+	}
+	for _, tag := range strings.Split(os.Getenv(EnvConfigTags), ",") {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		if d.Tags == nil {
+			d.Tags = make(map[string]string)
+		}
+		d.Tags[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return d
+}
+
+// Merge returns the dimensions overridden by the non-empty fields of o.
+func (d Dimensions) Merge(o Dimensions) Dimensions {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&d.Env, o.Env},
+		{&d.Cluster, o.Cluster},
+		{&d.Region, o.Region},
+		{&d.IDC, o.IDC},
+		{&d.InstanceID, o.InstanceID},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	if len(o.Tags) > 0 {
+		tags := make(map[string]string, len(d.Tags)+len(o.Tags))
+		for k, v := range d.Tags {
+			tags[k] = v
+		}
+		for k, v := range o.Tags {
+			tags[k] = v
+		}
+		d.Tags = tags
+	}
+	return d
+}
+
+// InstanceFromEnv returns the identity of the process in the canary rollouts and the status
+// reports. The id is the same as the one of DimensionsFromEnv, KITEX_CONFIG_INSTANCE_ID, or the
+// hostname if it is not set, and the tags are the ones of KITEX_CONFIG_TAGS in the form of "k=v".
+func InstanceFromEnv() Instance {
+	d := DimensionsFromEnv()
+	instance := Instance{ID: d.InstanceID}
+	if instance.ID == "" {
+		instance.ID, _ = os.Hostname()
+	}
+	for k, v := range d.Tags {
+		instance.Tags = append(instance.Tags, k+"="+v)
+	}
+	sort.Strings(instance.Tags)
+	return instance
+}
+
+// DefaultInstance returns the instance of id and tags, the empty id and the nil tags are the ones
+// of InstanceFromEnv.
+func DefaultInstance(id string, tags []string) Instance {
+	if id == "" || tags == nil {
+		instance := InstanceFromEnv()
+		if id == "" {
+			id = instance.ID
+		}
+		if tags == nil {
+			tags = instance.Tags
+		}
+	}
+	return Instance{ID: id, Tags: tags}
+}
+
+// pathPrefixes returns the path prefixes from the least specific to the most specific,
+// each one adds a dimension set in the order of Env, Region, IDC, Cluster and InstanceID.
+// The segments are named, e.g. "env=prod/idc=idc1/", so that the prefixes of the different
+// dimensions with the same values do not collide.
+func (d *Dimensions) pathPrefixes() []string {
+	prefixes := []string{""}
+	prefix := ""
+	for _, f := range []struct {
+		name  string
+		value string
+	}{
+		{"env", d.Env},
+		{"region", d.Region},
+		{"idc", d.IDC},
+		{"cluster", d.Cluster},
+		{"instance", d.InstanceID},
+	} {
+		if f.value == "" {
+			continue
+		}
+		prefix += f.name + "=" + f.value + "/"
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
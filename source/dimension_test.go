@@ -0,0 +1,86 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+func TestDimensionsFromEnv(t *testing.T) {
+	t.Setenv(EnvConfigEnv, "prod")
+	t.Setenv(EnvConfigIDC, "idc1")
+	t.Setenv(EnvConfigTags, "zone=a, lane = blue,invalid")
+	d := DimensionsFromEnv()
+	test.Assert(t, d.Env == "prod" && d.IDC == "idc1" && d.Region == "", d)
+	test.Assert(t, len(d.Tags) == 2 && d.Tags["zone"] == "a" && d.Tags["lane"] == "blue", d.Tags)
+
+	d = d.Merge(Dimensions{Env: "staging", Region: "us", Tags: map[string]string{"zone": "b"}})
+	test.Assert(t, d.Env == "staging" && d.Region == "us" && d.IDC == "idc1", d)
+	test.Assert(t, d.Tags["zone"] == "b" && d.Tags["lane"] == "blue", d.Tags)
+}
+
+func TestInstanceFromEnv(t *testing.T) {
+	t.Setenv(EnvConfigInstanceID, "")
+	t.Setenv(EnvConfigTags, "zone=a,lane=blue")
+	hostname, _ := os.Hostname()
+	instance := InstanceFromEnv()
+	test.Assert(t, instance.ID == hostname, instance)
+	test.Assert(t, strings.Join(instance.Tags, ",") == "lane=blue,zone=a", instance.Tags)
+
+	// the instance id is the same as the one of the dimensions.
+	t.Setenv(EnvConfigInstanceID, "i-1")
+	test.Assert(t, InstanceFromEnv().ID == DimensionsFromEnv().InstanceID)
+	instance = DefaultInstance("", []string{})
+	test.Assert(t, instance.ID == "i-1" && len(instance.Tags) == 0, instance)
+	instance = DefaultInstance("i-2", nil)
+	test.Assert(t, instance.ID == "i-2" && len(instance.Tags) == 2, instance)
+}
+
+func TestDimensionFallback(t *testing.T) {
+	c, err := NewKeyRenderer(KeyOptions{})
+	test.Assert(t, err == nil, err)
+	cpc := &ConfigParamConfig{Category: "retry", ClientServiceName: "c", ServerServiceName: "s"}
+	param, err := c.ClientConfigParam(cpc)
+	test.Assert(t, err == nil && param.Path == "c/s/retry", param, err)
+	layers, err := c.ClientConfigLayers(cpc)
+	test.Assert(t, err == nil && len(layers) == 0, layers, err)
+
+	cpc.Dimensions = Dimensions{Env: "prod", IDC: "idc1"}
+	param, err = c.ClientConfigParam(cpc)
+	test.Assert(t, err == nil && param.Path == "env=prod/idc=idc1/c/s/retry", param, err)
+	layers, err = c.ClientConfigLayers(cpc)
+	test.Assert(t, err == nil, err)
+	test.Assert(t, strings.Join(layers, ",") == "/KitexConfig/c/s/retry,/KitexConfig/env=prod/c/s/retry", layers)
+
+	// the different dimensions with the same value do not collide.
+	cpc.Dimensions = Dimensions{Env: "prod", IDC: "us"}
+	idc, _ := c.ClientConfigParam(cpc)
+	cpc.Dimensions = Dimensions{Env: "prod", Region: "us"}
+	region, _ := c.ClientConfigParam(cpc)
+	test.Assert(t, idc.Path == "env=prod/idc=us/c/s/retry" && region.Path == "env=prod/region=us/c/s/retry", idc, region)
+	cpc.Dimensions = Dimensions{Env: "prod", IDC: "idc1"}
+
+	c, err = NewKeyRenderer(KeyOptions{ClientPathFormat: `{{.Env}}/{{index .Tags "lane"}}/{{.Category}}`})
+	test.Assert(t, err == nil, err)
+	cpc.Tags = map[string]string{"lane": "blue"}
+	param, err = c.ClientConfigParam(cpc)
+	test.Assert(t, err == nil && param.Path == "prod/blue/retry", param, err)
+	layers, err = c.ClientConfigLayers(cpc)
+	test.Assert(t, err == nil && len(layers) == 0, layers, err)
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EncryptedPrefix is the prefix of the encrypted envelope of a config value, which is
+// "enc:v1:{key id}:{base64 of the AES-GCM nonce and ciphertext}".
+const EncryptedPrefix = "enc:v1:"
+
+// ErrNoKeyProvider is returned when a value is encrypted or decrypted without a KeyProvider.
+var ErrNoKeyProvider = errors.New("[config] no key provider to encrypt or decrypt the config")
+
+// KeyProvider provides the AES keys to encrypt and decrypt the config values.
+// Implement it to fetch the keys from a KMS, see NewKMSKeyProvider.
+type KeyProvider interface {
+	// KeyID returns the id of the key to encrypt the values.
+	KeyID() string
+	// Key returns the key of id, which must be 16, 24 or 32 bytes for AES-128, AES-192 or AES-256.
+	Key(id string) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	id  string
+	key []byte
+}
+
+func (p *staticKeyProvider) KeyID() string {
+	return p.id
+}
+
+func (p *staticKeyProvider) Key(id string) ([]byte, error) {
+	if id != p.id {
+		return nil, fmt.Errorf("[config] unknown encryption key %q", id)
+	}
+	return p.key, nil
+}
+
+// NewStaticKeyProvider returns a KeyProvider of a single key.
+func NewStaticKeyProvider(id string, key []byte) (KeyProvider, error) {
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	return &staticKeyProvider{id: id, key: key}, nil
+}
+
+// NewFileKeyProvider returns a KeyProvider of the key in the file at path, the key is
+// in base64 or in raw bytes.
+func NewFileKeyProvider(id, path string) (KeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeyProvider(id, decodeKey(data))
+}
+
+// NewEnvKeyProvider returns a KeyProvider of the key in base64 in the environment variable env.
+func NewEnvKeyProvider(id, env string) (KeyProvider, error) {
+	value, ok := os.LookupEnv(env)
+	if !ok {
+		return nil, fmt.Errorf("[config] environment variable %s of the encryption key is not set", env)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("[config] environment variable %s is not in base64: %w", env, err)
+	}
+	return NewStaticKeyProvider(id, key)
+}
+
+// decodeKey decodes the key in base64, or returns it as is if it is not base64.
+func decodeKey(data []byte) []byte {
+	if key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		return key
+	}
+	return data
+}
+
+// KMS decrypts the data keys encrypted by the key management service.
+type KMS interface {
+	Decrypt(keyID string, ciphertext []byte) ([]byte, error)
+}
+
+type kmsKeyProvider struct {
+	kms  KMS
+	id   string
+	keys map[string][]byte
+
+	mu    sync.Mutex
+	plain map[string][]byte
+}
+
+// NewKMSKeyProvider returns a KeyProvider of the data keys encrypted by kms, keys maps the
+// key ids to the encrypted data keys, and id is the one to encrypt the values. The data keys
+// are decrypted by kms when they are used for the first time.
+func NewKMSKeyProvider(kms KMS, id string, keys map[string][]byte) KeyProvider {
+	return &kmsKeyProvider{kms: kms, id: id, keys: keys, plain: make(map[string][]byte)}
+}
+
+func (p *kmsKeyProvider) KeyID() string {
+	return p.id
+}
+
+func (p *kmsKeyProvider) Key(id string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.plain[id]; ok {
+		return key, nil
+	}
+	encrypted, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("[config] unknown encryption key %q", id)
+	}
+	key, err := p.kms.Decrypt(id, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("[config] decrypt the data key %q failed: %w", id, err)
+	}
+	p.plain[id] = key
+	return key, nil
+}
+
+// IsEncrypted reports whether value is in the encrypted envelope.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix)
+}
+
+// Encrypt encrypts value stored at the config key configKey with the key of provider.KeyID in
+// the envelope. configKey is authenticated as the associated data, so the encrypted value can
+// only be decrypted at the same key.
+func Encrypt(provider KeyProvider, configKey, value string) (string, error) {
+	if provider == nil {
+		return "", ErrNoKeyProvider
+	}
+	id := provider.KeyID()
+	if strings.Contains(id, ":") {
+		return "", fmt.Errorf("[config] encryption key id %q contains ':'", id)
+	}
+	aead, err := newAEAD(provider, id)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(configKey))
+	return EncryptedPrefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts the value in the envelope stored at the config key configKey, the value not in
+// the envelope is returned as is.
+func Decrypt(provider KeyProvider, configKey, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if provider == nil {
+		return "", ErrNoKeyProvider
+	}
+	envelope := strings.TrimPrefix(value, EncryptedPrefix)
+	i := strings.Index(envelope, ":")
+	if i < 0 {
+		return "", errors.New("[config] malformed encrypted config")
+	}
+	id := envelope[:i]
+	sealed, err := base64.StdEncoding.DecodeString(envelope[i+1:])
+	if err != nil {
+		return "", fmt.Errorf("[config] malformed encrypted config: %w", err)
+	}
+	aead, err := newAEAD(provider, id)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("[config] malformed encrypted config")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(configKey))
+	if err != nil {
+		return "", fmt.Errorf("[config] decrypt config with key %q failed: %w", id, err)
+	}
+	return string(plain), nil
+}
+
+func newAEAD(provider KeyProvider, id string) (cipher.AEAD, error) {
+	key, err := provider.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptParser decrypts the values in the encrypted envelope before decoding them, so
+// that the callbacks, the events and the snapshots keep the values encrypted.
+type decryptParser struct {
+	ConfigParser
+	keys KeyProvider
+	key  string
+}
+
+// NewDecryptParser returns a ConfigParser which decrypts the values of the config key in the
+// encrypted envelope with keys before decoding them by parser.
+func NewDecryptParser(parser ConfigParser, keys KeyProvider, key string) ConfigParser {
+	return &decryptParser{ConfigParser: parser, keys: keys, key: key}
+}
+
+func (p *decryptParser) Decode(data string, config interface{}) error {
+	plain, err := Decrypt(p.keys, p.key, data)
+	if err != nil {
+		return err
+	}
+	return p.ConfigParser.Decode(plain, config)
+}
+
+// Encode encodes config by the parser, or in json if it is not a ConfigEncoder.
+func (p *decryptParser) Encode(config interface{}) (string, error) {
+	if encoder, ok := p.ConfigParser.(ConfigEncoder); ok {
+		return encoder.Encode(config)
+	}
+	return encodeJSON(config)
+}
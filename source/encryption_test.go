@@ -0,0 +1,99 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+type testKMS map[string][]byte
+
+func (k testKMS) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	if !bytes.Equal(k[keyID], ciphertext) {
+		return nil, errors.New("invalid data key")
+	}
+	return bytes.ToUpper(ciphertext), nil
+}
+
+func TestEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	provider, err := NewStaticKeyProvider("k1", key)
+	test.Assert(t, err == nil, err)
+	_, err = NewStaticKeyProvider("k1", []byte("short"))
+	test.Assert(t, err != nil)
+
+	value := `{"qps_limit":100}`
+	encrypted, err := Encrypt(provider, "/config/a", value)
+	test.Assert(t, err == nil, err)
+	test.Assert(t, IsEncrypted(encrypted) && strings.HasPrefix(encrypted, "enc:v1:k1:"), encrypted)
+	test.Assert(t, !strings.Contains(encrypted, "qps_limit"), encrypted)
+	plain, err := Decrypt(provider, "/config/a", encrypted)
+	test.Assert(t, err == nil && plain == value, plain, err)
+	plain, err = Decrypt(nil, "/config/a", value)
+	test.Assert(t, err == nil && plain == value, "the plain values are not decrypted")
+	_, err = Decrypt(nil, "/config/a", encrypted)
+	test.Assert(t, errors.Is(err, ErrNoKeyProvider), err)
+
+	other, _ := NewStaticKeyProvider("k2", key)
+	_, err = Decrypt(other, "/config/a", encrypted)
+	test.Assert(t, err != nil, "unknown key")
+	tampered := encrypted[:len(encrypted)-4] + "AAA="
+	_, err = Decrypt(provider, "/config/a", tampered)
+	test.Assert(t, err != nil, "tampered")
+	// the encrypted value can not be moved to another key.
+	_, err = Decrypt(provider, "/config/b", encrypted)
+	test.Assert(t, err != nil, "moved")
+
+	var config map[string]int
+	parser := NewDecryptParser(defaultConfigParse(), provider, "/config/a")
+	test.Assert(t, parser.Decode(encrypted, &config) == nil && config["qps_limit"] == 100, config)
+	data, err := parser.(ConfigEncoder).Encode(config)
+	test.Assert(t, err == nil && data == value, data, err)
+	test.Assert(t, isStrict(parseErrorParser{NewDecryptParser(NewStrictJSONParser(), provider, "/config/a")}))
+	test.Assert(t, !isStrict(parseErrorParser{parser}))
+}
+
+func TestKeyProviders(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 16)
+	path := filepath.Join(t.TempDir(), "key")
+	test.Assert(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600) == nil)
+	provider, err := NewFileKeyProvider("file", path)
+	test.Assert(t, err == nil, err)
+	got, err := provider.Key("file")
+	test.Assert(t, err == nil && bytes.Equal(got, key), got, err)
+
+	t.Setenv("TEST_CONFIG_KEY", base64.StdEncoding.EncodeToString(key))
+	provider, err = NewEnvKeyProvider("env", "TEST_CONFIG_KEY")
+	test.Assert(t, err == nil && provider.KeyID() == "env", err)
+	_, err = NewEnvKeyProvider("env", "TEST_CONFIG_KEY_NOT_SET")
+	test.Assert(t, err != nil)
+
+	kms := testKMS{"v1": bytes.Repeat([]byte("a"), 32), "v2": bytes.Repeat([]byte("b"), 32)}
+	provider = NewKMSKeyProvider(kms, "v2", kms)
+	encrypted, err := Encrypt(provider, "/config/a", "value")
+	test.Assert(t, err == nil && strings.HasPrefix(encrypted, "enc:v1:v2:"), encrypted, err)
+	got, err = provider.Key("v1")
+	test.Assert(t, err == nil && bytes.Equal(got, bytes.Repeat([]byte("A"), 32)), got, err)
+	_, err = provider.Key("v3")
+	test.Assert(t, err != nil)
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrClosed is returned when the ConfigSource is used after it is closed.
+	ErrClosed = errors.New("[config] config source is closed")
+	// ErrConfigNotFound is returned if the config key does not exist.
+	ErrConfigNotFound = errors.New("[config] config not found")
+)
+
+// LoadFailureReason is the reason why the value of a config key failed to load.
+type LoadFailureReason string
+
+const (
+	LoadTimeout          LoadFailureReason = "timeout"
+	LoadPermissionDenied LoadFailureReason = "permission denied"
+	LoadParseFailure     LoadFailureReason = "parse failure"
+	LoadRejected         LoadFailureReason = "rejected"
+	LoadUnavailable      LoadFailureReason = "unavailable"
+)
+
+// ParseError is the error returned by ConfigParser when the data delivered to the callbacks can not be decoded.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return "parse config failed: " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// KeyLoadError is the error of loading the value of a config key.
+type KeyLoadError struct {
+	Key    string
+	Reason LoadFailureReason
+	Err    error
+}
+
+func (e *KeyLoadError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Key, e.Reason, e.Err)
+}
+
+func (e *KeyLoadError) Unwrap() error {
+	return e.Err
+}
+
+// InitialLoadError lists the config keys whose initial value failed to load.
+type InitialLoadError struct {
+	Failures []*KeyLoadError
+}
+
+func (e *InitialLoadError) Error() string {
+	failures := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		failures = append(failures, f.Error())
+	}
+	return "[config] initial load failed: " + strings.Join(failures, "; ")
+}
+
+// Add records err if it is a *KeyLoadError, other errors are ignored.
+func (e *InitialLoadError) Add(err error) {
+	var kerr *KeyLoadError
+	if errors.As(err, &kerr) {
+		e.Failures = append(e.Failures, kerr)
+	}
+}
+
+// ErrorOrNil returns nil if no failure is recorded.
+func (e *InitialLoadError) ErrorOrNil() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
+
+// NewDeliveryError classifies the error returned by delivering the value of key to a callback,
+// it returns nil if err is nil. The value is rejected if it is decoded but the callback fails,
+// e.g. by the validation of the config.
+func NewDeliveryError(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	reason := LoadRejected
+	if IsParseError(err) {
+		reason = LoadParseFailure
+	}
+	return &KeyLoadError{Key: key, Reason: reason, Err: err}
+}
+
+// IsParseError reports whether err is caused by a ParseError.
+func IsParseError(err error) bool {
+	var perr *ParseError
+	return errors.As(err, &perr)
+}
+
+// parseErrorParser wraps the errors of ConfigParser in ParseError.
+type parseErrorParser struct {
+	ConfigParser
+}
+
+func (p parseErrorParser) Decode(data string, config interface{}) error {
+	if err := p.ConfigParser.Decode(data, config); err != nil {
+		return &ParseError{Err: err}
+	}
+	return nil
+}
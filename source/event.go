@@ -0,0 +1,69 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+// EventType is the result of delivering a config value to a callback.
+type EventType string
+
+const (
+	// EventApplied means the value is applied by the callback.
+	EventApplied EventType = "applied"
+	// EventRejected means the value is rejected by the callback, the last applied value is kept.
+	EventRejected EventType = "rejected"
+	// EventRestored means the key is deleted and the callback restores the default config.
+	EventRestored EventType = "restored"
+)
+
+// ConfigEvent is the event of delivering a config value to a callback.
+type ConfigEvent struct {
+	Key               string
+	Category          string
+	ServerServiceName string
+	ClientServiceName string
+	// OldValue is the last value applied by the callback, empty if it uses the default config.
+	OldValue string
+	// NewValue is the value delivered, empty if the key is deleted.
+	NewValue string
+	// Revision is the revision of NewValue, e.g. the etcd ModRevision, zero if the key is deleted.
+	Revision int64
+	// FromSnapshot is true if NewValue is loaded from the local snapshot.
+	FromSnapshot bool
+	Type         EventType
+	// Err is the error returned by the callback if the value is rejected.
+	Err error
+}
+
+// ConfigListener observes the config events. OnConfigEvent is called synchronously
+// after the value is delivered, so it should not block. It is called without holding the
+// locks of the ConfigSource, so it can register and deregister the keys.
+type ConfigListener interface {
+	OnConfigEvent(event *ConfigEvent)
+}
+
+// ConfigListenerFunc is an adapter to use a function as ConfigListener.
+type ConfigListenerFunc func(event *ConfigEvent)
+
+// OnConfigEvent implements ConfigListener.
+func (f ConfigListenerFunc) OnConfigEvent(event *ConfigEvent) {
+	f(event)
+}
+
+// WithListeners sets the listeners of the events of the registered callback only,
+// the listeners of the ConfigSource receive them as well.
+func WithListeners(listeners ...ConfigListener) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.Listeners = append(o.Listeners, listeners...)
+	}
+}
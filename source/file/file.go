@@ -0,0 +1,421 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package file implements source.ConfigSource on the local files, for the development
+// laptops and the air-gapped environments without etcd.
+//
+// The keys are rendered by source.KeyRenderer like etcd.Client, and the value of a key is the
+// content of the file at the path of the key under the directory, e.g. the value of
+// "/KitexConfig/c/s/retry" is read from "{Dir}/KitexConfig/c/s/retry". The "*" segments of the keys,
+// e.g. of source.GlobalClientPathLayer, are read from the AnySegment directories, since "*" is not
+// valid in the paths on Windows. The files are polled for the changes, and the variant of a
+// scheduled value is switched at the boundaries of its windows like etcd.Client.
+package file
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+// DefaultPollInterval is the default interval to check the changes of the files.
+const DefaultPollInterval = time.Second
+
+// AnySegment is the directory of the "*" segments of the keys, e.g. the value of
+// "/KitexConfig/*/*/retry" is read from "{Dir}/KitexConfig/_any/_any/retry".
+const AnySegment = "_any"
+
+var _ source.ConfigSource = &Source{}
+
+// Options are the options of the file Source.
+type Options struct {
+	// Dir is the directory of the config files.
+	Dir string
+	// PollInterval is the interval to check the changes of the files, DefaultPollInterval if zero.
+	PollInterval time.Duration
+	// Prefix, ServerPathFormat, ClientPathFormat, ServerPathLayers and ClientPathLayers render
+	// the keys, the defaults are the same as etcd.Options.
+	Prefix           string
+	ServerPathFormat string
+	ClientPathFormat string
+	ServerPathLayers []string
+	ClientPathLayers []string
+	// ConfigParser and CategoryParsers decode the values like etcd.Options, json by default.
+	ConfigParser    source.ConfigParser
+	CategoryParsers map[string]source.ConfigParser
+	// KeyProvider decrypts the values in the encrypted envelope like etcd.Options.
+	KeyProvider source.KeyProvider
+	// MaxDecompressedSize limits the size of the values decompressed like etcd.Options.
+	MaxDecompressedSize int64
+	// TrustedKeys verify the signature envelope of the values like etcd.Options.
+	TrustedKeys map[string]ed25519.PublicKey
+	// InstanceID and InstanceTags select the value of the rollout envelope like etcd.Options, they
+	// are source.InstanceFromEnv by default.
+	InstanceID   string
+	InstanceTags []string
+	// Listeners observe the config events of all the keys.
+	Listeners []source.ConfigListener
+	// EnableOverrides registers the file of the temporary override of each config, source.OverrideKey,
+	// as the top layer of it like etcd.Options. The override has no ttl, it applies until its file
+	// is removed, then the config is restored.
+	EnableOverrides bool
+}
+
+// Source is a source.ConfigSource reading the configs from the files in a directory.
+type Source struct {
+	*source.KeyRenderer
+	dir       string
+	codec     *source.Codec
+	listeners []source.ConfigListener
+	overrides bool
+
+	mu       sync.Mutex
+	keys     map[string]*fileKey
+	layers   map[layerID][]string
+	revision int64
+	closed   bool
+
+	// deliverMu serializes the reads of the files and the deliveries, the callbacks are called
+	// without holding mu so that they can call the Source, and the listeners without holding either.
+	deliverMu sync.Mutex
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+type layerID struct {
+	key      string
+	uniqueID int64
+}
+
+// fileKey holds the latest content of the file of a key and the callbacks registered on it.
+type fileKey struct {
+	key       string
+	callbacks map[int64]*source.Subscriber
+	// loaded is true once the file has been read.
+	loaded bool
+	value  string
+	// modRevision is the revision when value is read, zero if the file does not exist.
+	modRevision int64
+	// boundary is the next boundary of the windows of the scheduled variants of value, zero if
+	// there is none.
+	boundary time.Time
+}
+
+// NewSource creates a Source reading the files under opts.Dir.
+func NewSource(opts Options) (*Source, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("[file] the config directory is empty")
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.ConfigParser == nil {
+		opts.ConfigParser = source.NewJSONParser()
+	}
+	renderer, err := source.NewKeyRenderer(source.KeyOptions{
+		Prefix:           opts.Prefix,
+		ServerPathFormat: opts.ServerPathFormat,
+		ClientPathFormat: opts.ClientPathFormat,
+		ServerPathLayers: opts.ServerPathLayers,
+		ClientPathLayers: opts.ClientPathLayers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Source{
+		KeyRenderer: renderer,
+		dir:         opts.Dir,
+		codec: &source.Codec{
+			Parser:              opts.ConfigParser,
+			CategoryParsers:     opts.CategoryParsers,
+			KeyProvider:         opts.KeyProvider,
+			TrustedKeys:         opts.TrustedKeys,
+			Instance:            source.DefaultInstance(opts.InstanceID, opts.InstanceTags),
+			MaxDecompressedSize: opts.MaxDecompressedSize,
+		},
+		listeners: opts.Listeners,
+		overrides: opts.EnableOverrides,
+		keys:      make(map[string]*fileKey),
+		layers:    make(map[layerID][]string),
+		cancel:    cancel,
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx, opts.PollInterval)
+	}()
+	return s, nil
+}
+
+// GetValue implements source.ConfigSource.
+func (s *Source) GetValue(ctx context.Context, key string) (source.ConfigValue, error) {
+	value, exists, err := s.read(key)
+	if err != nil {
+		return source.ConfigValue{}, err
+	}
+	if !exists {
+		return source.ConfigValue{}, source.ErrConfigNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := source.ConfigValue{Key: key, Value: value}
+	if fk, ok := s.keys[key]; ok && fk.value == value {
+		v.ModRevision = fk.modRevision
+	}
+	return v, nil
+}
+
+// RegisterConfigCallback implements source.ConfigSource. The layers registered by source.WithLayers
+// and the override are deep-merged like etcd.Client.
+func (s *Source) RegisterConfigCallback(ctx context.Context, key string, uniqueID int64,
+	configCallback source.ConfigCallback, opts ...source.RegisterOption,
+) error {
+	ro := source.NewRegisterOptions(opts...)
+	if s.overrides {
+		ro.Override = source.OverrideKey(key)
+	}
+	if len(ro.Layers) == 0 && ro.Override == "" {
+		return s.register(key, uniqueID, configCallback, ro)
+	}
+	layers := append([]string{}, ro.Layers...)
+	if ro.Override != "" {
+		layers = append(layers, ro.Override)
+	}
+	s.mu.Lock()
+	s.layers[layerID{key, uniqueID}] = layers
+	s.mu.Unlock()
+	return source.RegisterLayers(key, configCallback, ro, func(k string, cb source.ConfigCallback) error {
+		return s.register(k, uniqueID, cb, ro)
+	})
+}
+
+// register registers the callback on key and delivers the current value to it.
+func (s *Source) register(key string, uniqueID int64, configCallback source.ConfigCallback, ro *source.RegisterOptions) error {
+	cb := source.NewSubscriber(configCallback, ro)
+	s.deliverMu.Lock()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		s.deliverMu.Unlock()
+		return source.ErrClosed
+	}
+	fk, ok := s.keys[key]
+	if !ok {
+		fk = &fileKey{key: key, callbacks: make(map[int64]*source.Subscriber)}
+		s.keys[key] = fk
+	}
+	fk.callbacks[uniqueID] = cb
+	s.mu.Unlock()
+
+	events, err := s.refresh(fk)
+	if err != nil {
+		s.deliverMu.Unlock()
+		return &source.KeyLoadError{Key: key, Reason: source.LoadUnavailable, Err: err}
+	}
+	events = append(events, s.notify(fk, cb, false))
+	err = cb.Err()
+	s.deliverMu.Unlock()
+	publish(events...)
+	return source.NewDeliveryError(key, err)
+}
+
+// DeregisterConfig implements source.ConfigSource.
+func (s *Source) DeregisterConfig(key string, uniqueID int64) {
+	s.mu.Lock()
+	id := layerID{key, uniqueID}
+	layers := s.layers[id]
+	delete(s.layers, id)
+	for _, k := range append(layers, key) {
+		if fk, ok := s.keys[k]; ok {
+			delete(fk.callbacks, uniqueID)
+			if len(fk.callbacks) == 0 {
+				delete(s.keys, k)
+			}
+		}
+	}
+	s.mu.Unlock()
+}
+
+// Close implements source.ConfigSource, it stops polling the files.
+func (s *Source) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return source.ErrClosed
+	}
+	s.closed = true
+	s.keys = make(map[string]*fileKey)
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Source) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.poll(time.Now())
+		}
+	}
+}
+
+// poll reads the files of all the registered keys, and delivers the changed values and the
+// scheduled values whose boundaries have passed by now.
+func (s *Source) poll(now time.Time) {
+	s.deliverMu.Lock()
+	s.mu.Lock()
+	keys := make([]*fileKey, 0, len(s.keys))
+	for _, fk := range s.keys {
+		keys = append(keys, fk)
+	}
+	s.mu.Unlock()
+	var events []published
+	for _, fk := range keys {
+		refreshed, err := s.refresh(fk)
+		if err != nil {
+			klog.Warnf("[file] config key: %s read failed: %v", fk.key, err)
+		}
+		if len(refreshed) == 0 {
+			refreshed = s.switchVariant(fk, now)
+		}
+		events = append(events, refreshed...)
+	}
+	s.deliverMu.Unlock()
+	publish(events...)
+}
+
+// refresh reads the file of fk, and delivers the value to the callbacks if it is changed.
+// It returns the events to publish to the listeners.
+func (s *Source) refresh(fk *fileKey) ([]published, error) {
+	value, exists, err := s.read(fk.key)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if fk.loaded && value == fk.value && exists == (fk.modRevision != 0) {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	s.revision++
+	fk.loaded = true
+	fk.value = value
+	fk.modRevision = 0
+	fk.boundary = time.Time{}
+	if exists {
+		fk.modRevision = s.revision
+		fk.boundary, _ = s.codec.NextBoundary(value, time.Now())
+	}
+	s.mu.Unlock()
+	return s.deliver(fk, false), nil
+}
+
+// switchVariant redelivers the value of fk if the boundary of its scheduled variants has passed
+// by now, so that the callbacks switch to the variant applying, and schedules the next boundary.
+func (s *Source) switchVariant(fk *fileKey, now time.Time) []published {
+	s.mu.Lock()
+	if fk.boundary.IsZero() || now.Before(fk.boundary) {
+		s.mu.Unlock()
+		return nil
+	}
+	fk.boundary, _ = s.codec.NextBoundary(fk.value, now)
+	s.mu.Unlock()
+	return s.deliver(fk, true)
+}
+
+// deliver delivers the current value of fk to all its callbacks, and returns the events to
+// publish to the listeners.
+func (s *Source) deliver(fk *fileKey, force bool) []published {
+	s.mu.Lock()
+	cbs := make([]*source.Subscriber, 0, len(fk.callbacks))
+	for _, cb := range fk.callbacks {
+		cbs = append(cbs, cb)
+	}
+	s.mu.Unlock()
+	events := make([]published, 0, len(cbs))
+	for _, cb := range cbs {
+		p := s.notify(fk, cb, force)
+		if p.event != nil && p.event.Err != nil {
+			klog.Warnf("[file] config key: %s apply value failed: %v", fk.key, p.event.Err)
+		}
+		events = append(events, p)
+	}
+	return events
+}
+
+// read returns the content of the file of key, exists is false if the file does not exist.
+func (s *Source) read(key string) (value string, exists bool, err error) {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		if segment == "*" {
+			segments[i] = AnySegment
+		}
+	}
+	path := filepath.Join(s.dir, filepath.FromSlash(strings.Join(segments, "/")))
+	if rel, err := filepath.Rel(s.dir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", false, fmt.Errorf("[file] key %s is out of the config directory", key)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
+
+// notify delivers the current value of fk to cb if it has not been delivered yet or force is
+// set, and returns the event to publish to the listeners.
+func (s *Source) notify(fk *fileKey, cb *source.Subscriber, force bool) published {
+	s.mu.Lock()
+	u := source.Update{Key: fk.key, Value: fk.value, ModRevision: fk.modRevision, Force: force}
+	listeners := append(append([]source.ConfigListener{}, s.listeners...), cb.Listeners...)
+	s.mu.Unlock()
+	event := cb.Deliver(u, s.codec.ParserOf(fk.key, cb.Param.Category))
+	if event == nil {
+		return published{}
+	}
+	return published{event: event, listeners: listeners}
+}
+
+// published is the event of a delivery to publish to the listeners, which is published after
+// deliverMu is released so that the listeners can call the Source.
+type published struct {
+	event     *source.ConfigEvent
+	listeners []source.ConfigListener
+}
+
+func publish(events ...published) {
+	for _, p := range events {
+		for _, l := range p.listeners {
+			l.OnConfigEvent(p.event)
+		}
+	}
+}
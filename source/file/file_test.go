@@ -0,0 +1,204 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
+
+type timeout struct {
+	RPCTimeoutMS  int `json:"rpc_timeout_ms"`
+	ConnTimeoutMS int `json:"conn_timeout_ms"`
+}
+
+func writeFile(t *testing.T, dir, key, value string) {
+	path := filepath.Join(dir, filepath.FromSlash(key))
+	test.Assert(t, os.MkdirAll(filepath.Dir(path), 0o755) == nil)
+	test.Assert(t, os.WriteFile(path, []byte(value), 0o644) == nil)
+}
+
+// waitFor polls cond until it is true or the deadline expires.
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSource(Options{Dir: dir, PollInterval: 10 * time.Millisecond})
+	test.Assert(t, err == nil, err)
+	defer s.Close()
+	cpc := &source.ConfigParamConfig{Category: "rpc_timeout", ClientServiceName: "c", ServerServiceName: "s"}
+	key, err := s.ClientConfigKey(cpc)
+	test.Assert(t, err == nil && key == "/KitexConfig/c/s/rpc_timeout", key, err)
+	writeFile(t, dir, key, `{"*":{"rpc_timeout_ms":1000}}`)
+
+	var mu sync.Mutex
+	var got map[string]timeout
+	var restored bool
+	callback := func(restoreDefault bool, data string, parser source.ConfigParser, meta source.ConfigMeta) error {
+		mu.Lock()
+		defer mu.Unlock()
+		restored = restoreDefault
+		configs := map[string]timeout{}
+		if !restoreDefault {
+			if err := parser.Decode(data, &configs); err != nil {
+				return err
+			}
+		}
+		got = configs
+		return nil
+	}
+	current := func() (map[string]timeout, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		return got, restored
+	}
+	err = s.RegisterConfigCallback(context.Background(), key, 1, callback, source.WithConfigParam(cpc))
+	test.Assert(t, err == nil, err)
+	test.Assert(t, got["*"].RPCTimeoutMS == 1000, got)
+	v, err := s.GetValue(context.Background(), key)
+	test.Assert(t, err == nil && v.Value == `{"*":{"rpc_timeout_ms":1000}}` && v.ModRevision != 0, v, err)
+
+	writeFile(t, dir, key, `{"*":{"rpc_timeout_ms":2000}}`)
+	test.Assert(t, waitFor(func() bool {
+		configs, _ := current()
+		return configs["*"].RPCTimeoutMS == 2000
+	}))
+
+	test.Assert(t, os.Remove(filepath.Join(dir, filepath.FromSlash(key))) == nil)
+	test.Assert(t, waitFor(func() bool {
+		_, restored := current()
+		return restored
+	}))
+	_, err = s.GetValue(context.Background(), key)
+	test.Assert(t, errors.Is(err, source.ErrConfigNotFound), err)
+
+	s.DeregisterConfig(key, 1)
+	test.Assert(t, s.Close() == nil)
+	test.Assert(t, errors.Is(s.RegisterConfigCallback(context.Background(), key, 1, callback), source.ErrClosed))
+}
+
+func TestSourceLayers(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSource(Options{Dir: dir, ClientPathLayers: []string{source.GlobalClientPathLayer}})
+	test.Assert(t, err == nil, err)
+	defer s.Close()
+	cpc := &source.ConfigParamConfig{Category: "rpc_timeout", ClientServiceName: "c", ServerServiceName: "s"}
+	key, err := s.ClientConfigKey(cpc)
+	test.Assert(t, err == nil, err)
+	layers, err := s.ClientConfigLayers(cpc)
+	test.Assert(t, err == nil && len(layers) == 1 && layers[0] == "/KitexConfig/*/*/rpc_timeout", layers, err)
+	// the "*" segments are read from the AnySegment directories.
+	writeFile(t, dir, "/KitexConfig/_any/_any/rpc_timeout", `{"*":{"rpc_timeout_ms":1000,"conn_timeout_ms":50}}`)
+	writeFile(t, dir, key, `{"*":{"rpc_timeout_ms":2000}}`)
+
+	var got map[string]timeout
+	err = s.RegisterConfigCallback(context.Background(), key, 1, func(restoreDefault bool, data string, parser source.ConfigParser, meta source.ConfigMeta) error {
+		got = map[string]timeout{}
+		return parser.Decode(data, &got)
+	}, source.WithConfigParam(cpc), source.WithLayers(layers...))
+	test.Assert(t, err == nil, err)
+	test.Assert(t, got["*"] == timeout{RPCTimeoutMS: 2000, ConnTimeoutMS: 50}, got)
+
+	_, err = s.GetValue(context.Background(), "/../outside")
+	test.Assert(t, err != nil && !errors.Is(err, source.ErrConfigNotFound), err)
+}
+
+func TestSourceOverride(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSource(Options{Dir: dir, PollInterval: time.Hour, EnableOverrides: true})
+	test.Assert(t, err == nil, err)
+	defer s.Close()
+	key := "/KitexConfig/c/s/rpc_timeout"
+	writeFile(t, dir, key, `{"*":{"rpc_timeout_ms":1000,"conn_timeout_ms":50}}`)
+	writeFile(t, dir, source.OverrideKey(key), `{"*":{"rpc_timeout_ms":3000}}`)
+
+	var got map[string]timeout
+	err = s.RegisterConfigCallback(context.Background(), key, 1, func(restoreDefault bool, data string, parser source.ConfigParser, meta source.ConfigMeta) error {
+		got = map[string]timeout{}
+		if restoreDefault {
+			return nil
+		}
+		return parser.Decode(data, &got)
+	})
+	test.Assert(t, err == nil, err)
+	test.Assert(t, got["*"] == timeout{RPCTimeoutMS: 3000, ConnTimeoutMS: 50}, got)
+
+	// the config is restored once the override file is removed.
+	test.Assert(t, os.Remove(filepath.Join(dir, filepath.FromSlash(source.OverrideKey(key)))) == nil)
+	s.poll(time.Now())
+	test.Assert(t, got["*"] == timeout{RPCTimeoutMS: 1000, ConnTimeoutMS: 50}, got)
+
+	s.DeregisterConfig(key, 1)
+	s.mu.Lock()
+	test.Assert(t, len(s.keys) == 0 && len(s.layers) == 0, s.keys, s.layers)
+	s.mu.Unlock()
+}
+
+func TestSourceSchedule(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSource(Options{Dir: dir, PollInterval: time.Hour})
+	test.Assert(t, err == nil, err)
+	defer s.Close()
+	from := time.Now().Add(time.Hour).Truncate(time.Second)
+	now := time.Now()
+	s.codec.Now = func() time.Time { return now }
+	key := "/KitexConfig/c/s/rpc_timeout"
+	writeFile(t, dir, key, (&source.ScheduledValue{
+		Default: `{"*":{"rpc_timeout_ms":1000}}`,
+		Variants: []source.ScheduledVariant{
+			{Window: source.Window{From: from, To: from.Add(time.Hour)}, Value: `{"*":{"rpc_timeout_ms":2000}}`},
+		},
+	}).String())
+
+	var got map[string]timeout
+	var delivered int
+	err = s.RegisterConfigCallback(context.Background(), key, 1, func(restoreDefault bool, data string, parser source.ConfigParser, meta source.ConfigMeta) error {
+		delivered++
+		got = map[string]timeout{}
+		return parser.Decode(data, &got)
+	})
+	test.Assert(t, err == nil, err)
+	test.Assert(t, got["*"].RPCTimeoutMS == 1000, got)
+
+	// the value is not redelivered before the boundary.
+	s.poll(from.Add(-time.Second))
+	test.Assert(t, delivered == 1, delivered)
+
+	// the variant is switched at the boundaries of its window without any change of the file.
+	now = from
+	s.poll(from)
+	test.Assert(t, delivered == 2 && got["*"].RPCTimeoutMS == 2000, delivered, got)
+	now = from.Add(time.Hour)
+	s.poll(now)
+	test.Assert(t, delivered == 3 && got["*"].RPCTimeoutMS == 1000, delivered, got)
+	s.poll(now.Add(time.Hour))
+	test.Assert(t, delivered == 3, delivered)
+}
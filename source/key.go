@@ -0,0 +1,287 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// The default prefix and path formats of the config keys.
+const (
+	DefaultConfigPrefix = "/KitexConfig"
+	DefaultClientPath   = "{{.ClientServiceName}}/{{.ServerServiceName}}/{{.Category}}"
+	DefaultServerPath   = "{{.ServerServiceName}}/{{.Category}}"
+)
+
+// The path formats of the layers commonly used under the client config path.
+const (
+	// GlobalClientPathLayer is the layer of the default config of a category for all the services.
+	GlobalClientPathLayer = "*/*/{{.Category}}"
+	// ServerClientPathLayer is the layer of the config of a category for all the callers of a service.
+	ServerClientPathLayer = "*/{{.ServerServiceName}}/{{.Category}}"
+	// GlobalServerPathLayer is the layer of the default config of a category for all the servers.
+	GlobalServerPathLayer = "*/{{.Category}}"
+)
+
+// Key is the prefix and the path of a config key, which are joined by "/".
+type Key struct {
+	Prefix string
+	Path   string
+}
+
+// CustomFunction use for customize the config parameters.
+type CustomFunction func(*Key)
+
+// ConfigParamConfig use for render the path or prefix info by go template, ref: https://pkg.go.dev/text/template
+// The fixed key shows as below.
+type ConfigParamConfig struct {
+	Category          string
+	ClientServiceName string
+	ServerServiceName string
+	Dimensions
+}
+
+// KeyOptions are the prefix and the path formats of the config keys.
+type KeyOptions struct {
+	// Prefix is DefaultConfigPrefix if it is empty.
+	Prefix string
+	// ServerPathFormat and ClientPathFormat are DefaultServerPath and DefaultClientPath if they are
+	// empty, which fall back from the path of the most specific Dimensions to the least specific one.
+	ServerPathFormat string
+	ClientPathFormat string
+	// ServerPathLayers and ClientPathLayers are the path formats of the layers overridden by the
+	// server and client paths, from the lowest priority, e.g. GlobalClientPathLayer.
+	ServerPathLayers []string
+	ClientPathLayers []string
+}
+
+// KeyRenderer renders the config keys from KeyOptions, it is shared by the ConfigSource
+// implementations so that they agree on the key layout.
+type KeyRenderer struct {
+	prefixTemplate     *template.Template
+	serverPathTemplate *template.Template
+	clientPathTemplate *template.Template
+	serverPathLayers   []*template.Template
+	clientPathLayers   []*template.Template
+	// serverFallback and clientFallback are true if the default paths are used, which fall
+	// back from the path of the most specific Dimensions to the least specific one.
+	serverFallback bool
+	clientFallback bool
+}
+
+// NewKeyRenderer creates a KeyRenderer from opts, the defaults are used if they are not set.
+func NewKeyRenderer(opts KeyOptions) (*KeyRenderer, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultConfigPrefix
+	}
+	serverFallback := opts.ServerPathFormat == ""
+	if serverFallback {
+		opts.ServerPathFormat = DefaultServerPath
+	}
+	clientFallback := opts.ClientPathFormat == ""
+	if clientFallback {
+		opts.ClientPathFormat = DefaultClientPath
+	}
+	prefixTemplate, err := template.New("prefix").Parse(opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	serverNameTemplate, err := template.New("serverName").Parse(opts.ServerPathFormat)
+	if err != nil {
+		return nil, err
+	}
+	clientNameTemplate, err := template.New("clientName").Parse(opts.ClientPathFormat)
+	if err != nil {
+		return nil, err
+	}
+	serverPathLayers, err := parseLayers("serverLayer", opts.ServerPathLayers)
+	if err != nil {
+		return nil, err
+	}
+	clientPathLayers, err := parseLayers("clientLayer", opts.ClientPathLayers)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyRenderer{
+		prefixTemplate:     prefixTemplate,
+		serverPathTemplate: serverNameTemplate,
+		clientPathTemplate: clientNameTemplate,
+		serverPathLayers:   serverPathLayers,
+		clientPathLayers:   clientPathLayers,
+		serverFallback:     serverFallback,
+		clientFallback:     clientFallback,
+	}, nil
+}
+
+func (r *KeyRenderer) ClientConfigParam(cpc *ConfigParamConfig, cfs ...CustomFunction) (Key, error) {
+	params, err := r.fallbackParams(cpc, r.clientPathTemplate, r.clientFallback, cfs...)
+	if err != nil {
+		return Key{}, err
+	}
+	return params[len(params)-1], nil
+}
+
+func (r *KeyRenderer) ServerConfigParam(cpc *ConfigParamConfig, cfs ...CustomFunction) (Key, error) {
+	params, err := r.fallbackParams(cpc, r.serverPathTemplate, r.serverFallback, cfs...)
+	if err != nil {
+		return Key{}, err
+	}
+	return params[len(params)-1], nil
+}
+
+// configParam render config parameters. All the parameters can be customized with CustomFunction.
+// ConfigParam explain:
+//  1. Prefix: KitexConfig by default.
+//  2. ServerPath: {{.ServerServiceName}}/{{.Category}} by default.
+//     ClientPath: {{.ClientServiceName}}/{{.ServerServiceName}}/{{.Category}} by default.
+func (r *KeyRenderer) configParam(cpc *ConfigParamConfig, t *template.Template, cfs ...CustomFunction) (Key, error) {
+	params, err := r.fallbackParams(cpc, t, false, cfs...)
+	if err != nil {
+		return Key{}, err
+	}
+	return params[0], nil
+}
+
+// fallbackParams renders the config parameters from the least specific to the most specific.
+// If fallback is true, the paths are prefixed with the Dimensions of cpc, e.g. "env=prod/region=us-east/",
+// otherwise only the path of t is rendered.
+func (r *KeyRenderer) fallbackParams(cpc *ConfigParamConfig, t *template.Template, fallback bool, cfs ...CustomFunction) ([]Key, error) {
+	path, err := r.render(cpc, t)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := r.render(cpc, r.prefixTemplate)
+	if err != nil {
+		return nil, err
+	}
+	pathPrefixes := []string{""}
+	if fallback {
+		pathPrefixes = cpc.pathPrefixes()
+	}
+	params := make([]Key, 0, len(pathPrefixes))
+	for _, p := range pathPrefixes {
+		param := Key{Prefix: prefix, Path: p + path}
+		for _, cf := range cfs {
+			cf(&param)
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+func (r *KeyRenderer) render(cpc *ConfigParamConfig, t *template.Template) (string, error) {
+	var tpl bytes.Buffer
+	err := t.Execute(&tpl, cpc)
+	if err != nil {
+		return "", err
+	}
+	return tpl.String(), nil
+}
+
+// ClientConfigLayers renders the keys of the layers of the client config from Options.ClientPathLayers,
+// followed by the less specific paths of the Dimensions if the default client path is used. The
+// duplicate keys are kept once with the highest priority, and the config key itself is excluded.
+func (r *KeyRenderer) ClientConfigLayers(cpc *ConfigParamConfig, cfs ...CustomFunction) ([]string, error) {
+	return r.configLayers(cpc, r.clientPathLayers, r.clientPathTemplate, r.clientFallback, cfs...)
+}
+
+// ServerConfigLayers renders the keys of the layers of the server config from Options.ServerPathLayers,
+// followed by the less specific paths of the Dimensions if the default server path is used, deduped
+// like ClientConfigLayers.
+func (r *KeyRenderer) ServerConfigLayers(cpc *ConfigParamConfig, cfs ...CustomFunction) ([]string, error) {
+	return r.configLayers(cpc, r.serverPathLayers, r.serverPathTemplate, r.serverFallback, cfs...)
+}
+
+func (r *KeyRenderer) configLayers(cpc *ConfigParamConfig, layers []*template.Template, path *template.Template,
+	fallback bool, cfs ...CustomFunction,
+) ([]string, error) {
+	keys := make([]string, 0, len(layers))
+	for _, t := range layers {
+		param, err := r.configParam(cpc, t, cfs...)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, param.Prefix+"/"+param.Path)
+	}
+	params, err := r.fallbackParams(cpc, path, fallback, cfs...)
+	if err != nil {
+		return nil, err
+	}
+	// the last one is the config key itself.
+	for _, param := range params[:len(params)-1] {
+		keys = append(keys, param.Prefix+"/"+param.Path)
+	}
+	last := params[len(params)-1]
+	return dedupeLayers(keys, last.Prefix+"/"+last.Path), nil
+}
+
+// dedupeLayers removes the keys which are the same as key or a layer of higher priority, so that
+// each key is registered once with the highest priority it has.
+func dedupeLayers(keys []string, key string) []string {
+	seen := map[string]bool{key: true}
+	deduped := make([]string, len(keys))
+	n := len(deduped)
+	for i := len(keys) - 1; i >= 0; i-- {
+		if seen[keys[i]] {
+			continue
+		}
+		seen[keys[i]] = true
+		n--
+		deduped[n] = keys[i]
+	}
+	return deduped[n:]
+}
+
+// ConfigKey renders the key of the config, the client path is used if cpc.ClientServiceName
+// is set, otherwise the server path is used. With the default path formats, the key is prefixed
+// with cpc.Dimensions, so it changes with the KITEX_CONFIG_* environment variables when the
+// Dimensions are read by DimensionsFromEnv, as the suites and kitex-etcd-config do.
+func (r *KeyRenderer) ConfigKey(cpc *ConfigParamConfig, cfs ...CustomFunction) (string, error) {
+	if cpc.ClientServiceName != "" {
+		return r.ClientConfigKey(cpc, cfs...)
+	}
+	return r.ServerConfigKey(cpc, cfs...)
+}
+
+// ClientConfigKey renders the key of the client config, i.e. the prefix and the path of ClientConfigParam.
+func (r *KeyRenderer) ClientConfigKey(cpc *ConfigParamConfig, cfs ...CustomFunction) (string, error) {
+	param, err := r.ClientConfigParam(cpc, cfs...)
+	if err != nil {
+		return "", err
+	}
+	return param.Prefix + "/" + param.Path, nil
+}
+
+// ServerConfigKey renders the key of the server config, i.e. the prefix and the path of ServerConfigParam.
+func (r *KeyRenderer) ServerConfigKey(cpc *ConfigParamConfig, cfs ...CustomFunction) (string, error) {
+	param, err := r.ServerConfigParam(cpc, cfs...)
+	if err != nil {
+		return "", err
+	}
+	return param.Prefix + "/" + param.Path, nil
+}
+
+func parseLayers(name string, formats []string) ([]*template.Template, error) {
+	layers := make([]*template.Template, 0, len(formats))
+	for _, format := range formats {
+		t, err := template.New(name).Parse(format)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, t)
+	}
+	return layers, nil
+}
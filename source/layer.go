@@ -0,0 +1,177 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// OverrideSuffix is appended to a config key to get the key of its temporary override.
+const OverrideSuffix = ".override"
+
+// OverrideKey returns the key of the temporary override of key.
+func OverrideKey(key string) string {
+	return key + OverrideSuffix
+}
+
+// WithLayers sets the keys of the layers overridden by the registered key, from the lowest
+// priority. The values of the layers and the key are deep-merged, and the callback receives
+// the merged value in json whenever any of them changes.
+func WithLayers(keys ...string) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.Layers = append(o.Layers, keys...)
+	}
+}
+
+// layeredCallback merges the values of the layers and delivers the result to the callback.
+type layeredCallback struct {
+	callback ConfigCallback
+	// keys are the keys of the layers from the lowest priority, the registered key is followed by
+	// its override if there is one.
+	keys []string
+
+	mu     sync.Mutex
+	values []*layerValue
+	// ready is false until all the layers are registered.
+	ready bool
+}
+
+type layerValue struct {
+	data   string
+	parser ConfigParser
+	meta   ConfigMeta
+}
+
+// RegisterLayers registers the callbacks on key, the layers in ro.Layers and ro.Override by register,
+// and delivers the deep-merged value of them to callback. It is shared by the ConfigSource
+// implementations so that they resolve the layers in the same way.
+func RegisterLayers(key string, callback ConfigCallback, ro *RegisterOptions,
+	register func(key string, callback ConfigCallback) error,
+) error {
+	lc := &layeredCallback{
+		callback: callback,
+		keys:     append(append([]string{}, ro.Layers...), key),
+	}
+	if ro.Override != "" {
+		lc.keys = append(lc.keys, ro.Override)
+	}
+	lc.values = make([]*layerValue, len(lc.keys))
+	var err error
+	for i, k := range lc.keys {
+		if lerr := register(k, lc.layerCallback(i)); lerr != nil && err == nil {
+			err = lerr
+		}
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.ready = true
+	if aerr := lc.apply(); aerr != nil && err == nil {
+		err = NewDeliveryError(key, aerr)
+	}
+	return err
+}
+
+// layerCallback returns the callback which updates the value of the ith layer.
+func (lc *layeredCallback) layerCallback(i int) ConfigCallback {
+	return func(restoreDefault bool, data string, parser ConfigParser, meta ConfigMeta) error {
+		lc.mu.Lock()
+		defer lc.mu.Unlock()
+		old := lc.values[i]
+		if restoreDefault {
+			lc.values[i] = nil
+		} else {
+			lc.values[i] = &layerValue{data: data, parser: parser, meta: meta}
+		}
+		if !lc.ready {
+			return nil
+		}
+		err := lc.apply()
+		if err != nil {
+			// keep the last valid value of the layer, so that it does not break the updates of the other layers.
+			lc.values[i] = old
+		}
+		return err
+	}
+}
+
+// apply delivers the merged value of the layers to the callback.
+func (lc *layeredCallback) apply() error {
+	var merged interface{}
+	var meta ConfigMeta
+	var parser ConfigParser
+	for _, v := range lc.values {
+		if v == nil {
+			continue
+		}
+		var layer interface{}
+		if err := v.parser.Decode(v.data, &layer); err != nil {
+			return err
+		}
+		merged = mergeLayer(merged, layer)
+		if v.meta.Revision > meta.Revision {
+			meta.Revision = v.meta.Revision
+		}
+		meta.FromSnapshot = meta.FromSnapshot || v.meta.FromSnapshot
+		parser = v.parser
+	}
+	jsonParser := ConfigParser(parseErrorParser{defaultConfigParse()})
+	if parser == nil {
+		return lc.callback(true, "", jsonParser, meta)
+	}
+	if isStrict(parser) {
+		// keep rejecting the unknown fields.
+		jsonParser = parseErrorParser{NewStrictJSONParser()}
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return lc.callback(false, string(data), jsonParser, meta)
+}
+
+// isStrict reports whether parser rejects the unknown fields, it may be wrapped.
+func isStrict(parser ConfigParser) bool {
+	switch p := parser.(type) {
+	case *strictJSONParser, *yamlParser, *tomlParser:
+		return true
+	case parseErrorParser:
+		return isStrict(p.ConfigParser)
+	case *decryptParser:
+		return isStrict(p.ConfigParser)
+	case *verifyParser:
+		return isStrict(p.ConfigParser)
+	case *decompressParser:
+		return isStrict(p.ConfigParser)
+	case *rolloutParser:
+		return isStrict(p.ConfigParser)
+	case *scheduleParser:
+		return isStrict(p.ConfigParser)
+	}
+	return false
+}
+
+// mergeLayer deep-merges the maps in override into base, the other values in override replace the ones in base.
+func mergeLayer(base, override interface{}) interface{} {
+	baseMap, ok1 := base.(map[string]interface{})
+	overrideMap, ok2 := normalizeYAML(override).(map[string]interface{})
+	if !ok1 || !ok2 {
+		return normalizeYAML(override)
+	}
+	for k, v := range overrideMap {
+		baseMap[k] = mergeLayer(baseMap[k], v)
+	}
+	return baseMap
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+func TestConfigLayers(t *testing.T) {
+	c, err := NewKeyRenderer(KeyOptions{ClientPathLayers: []string{GlobalClientPathLayer, ServerClientPathLayer}})
+	test.Assert(t, err == nil, err)
+	keys, err := c.ClientConfigLayers(&ConfigParamConfig{Category: "retry", ClientServiceName: "c", ServerServiceName: "s"})
+	test.Assert(t, err == nil, err)
+	test.Assert(t, len(keys) == 2 && keys[0] == "/KitexConfig/*/*/retry" && keys[1] == "/KitexConfig/*/s/retry", keys)
+
+	// the duplicate layers and the config key itself are registered once.
+	c, err = NewKeyRenderer(KeyOptions{ClientPathLayers: []string{
+		ServerClientPathLayer, GlobalClientPathLayer, ServerClientPathLayer, DefaultClientPath,
+	}})
+	test.Assert(t, err == nil, err)
+	keys, err = c.ClientConfigLayers(&ConfigParamConfig{
+		Category: "retry", ClientServiceName: "c", ServerServiceName: "s", Dimensions: Dimensions{Env: "prod"},
+	})
+	test.Assert(t, err == nil, err)
+	test.Assert(t, len(keys) == 3 && keys[0] == "/KitexConfig/*/*/retry" && keys[1] == "/KitexConfig/*/s/retry" &&
+		keys[2] == "/KitexConfig/c/s/retry", keys)
+}
+
+func TestLayeredCallback(t *testing.T) {
+	var got map[string]testTimeout
+	var restored bool
+	lc := &layeredCallback{
+		callback: func(restoreDefault bool, data string, parser ConfigParser, meta ConfigMeta) error {
+			restored = restoreDefault
+			got = map[string]testTimeout{}
+			if restoreDefault {
+				return nil
+			}
+			return parser.Decode(data, &got)
+		},
+		keys:   []string{"global", "server", "pair"},
+		values: make([]*layerValue, 3),
+	}
+	json := parseErrorParser{defaultConfigParse()}
+	yaml := parseErrorParser{NewYAMLParser()}
+
+	test.Assert(t, lc.layerCallback(0)(false, `{"*":{"rpc_timeout_ms":1000,"conn_timeout_ms":50}}`, json, ConfigMeta{Revision: 1}) == nil)
+	test.Assert(t, got == nil, "not delivered before ready")
+	lc.ready = true
+	test.Assert(t, lc.apply() == nil)
+	test.Assert(t, len(got) == 1 && got["*"] == testTimeout{RPCTimeoutMS: 1000, ConnTimeoutMS: 50}, got)
+
+	test.Assert(t, lc.layerCallback(2)(false, "echo:\n  rpc_timeout_ms: 3000\n", yaml, ConfigMeta{Revision: 3}) == nil)
+	test.Assert(t, lc.layerCallback(1)(false, `{"*":{"rpc_timeout_ms":2000},"echo":{"conn_timeout_ms":100}}`, json, ConfigMeta{Revision: 2}) == nil)
+	test.Assert(t, len(got) == 2, got)
+	test.Assert(t, got["*"] == testTimeout{RPCTimeoutMS: 2000, ConnTimeoutMS: 50}, got)
+	test.Assert(t, got["echo"] == testTimeout{RPCTimeoutMS: 3000, ConnTimeoutMS: 100}, got)
+
+	test.Assert(t, lc.layerCallback(1)(false, `{`, json, ConfigMeta{Revision: 4}) != nil)
+
+	for i := range lc.keys {
+		test.Assert(t, lc.layerCallback(i)(true, "", json, ConfigMeta{}) == nil)
+	}
+	test.Assert(t, restored)
+}
@@ -0,0 +1,234 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_ ConfigParser = &parser{}
+	_ ConfigParser = &strictJSONParser{}
+	_ ConfigParser = &yamlParser{}
+	_ ConfigParser = &tomlParser{}
+
+	_ ConfigEncoder = &parser{}
+	_ ConfigEncoder = &strictJSONParser{}
+	_ ConfigEncoder = &yamlParser{}
+	_ ConfigEncoder = &tomlParser{}
+)
+
+// ConfigParser decodes the config values.
+type ConfigParser interface {
+	Decode(data string, config interface{}) error
+}
+
+// ConfigEncoder is implemented by the ConfigParser which can encode the configs.
+// The configs are written in json if the parser of the category does not implement it.
+type ConfigEncoder interface {
+	Encode(config interface{}) (string, error)
+}
+
+type parser struct{}
+
+// Decode decodes the data to struct in specified format.
+func (p *parser) Decode(data string, config interface{}) error {
+	return json.Unmarshal([]byte(data), config)
+}
+
+// Encode encodes the config in json.
+func (p *parser) Encode(config interface{}) (string, error) {
+	return encodeJSON(config)
+}
+
+// DefaultConfigParse default etcd config parser.
+func defaultConfigParse() ConfigParser {
+	return &parser{}
+}
+
+// NewJSONParser returns the json parser used by default.
+func NewJSONParser() ConfigParser {
+	return defaultConfigParse()
+}
+
+// NewStrictJSONParser returns a json parser which rejects the unknown fields, so that
+// the typos in the field names are not ignored silently.
+func NewStrictJSONParser() ConfigParser {
+	return &strictJSONParser{}
+}
+
+// NewYAMLParser returns a yaml parser. The data is converted to json before decoding,
+// so the json tags of the config structs are respected, and the unknown fields are
+// rejected like NewStrictJSONParser.
+func NewYAMLParser() ConfigParser {
+	return &yamlParser{}
+}
+
+// NewTOMLParser returns a toml parser. The data is converted to json before decoding,
+// so the json tags of the config structs are respected, and the unknown fields are
+// rejected like NewStrictJSONParser.
+func NewTOMLParser() ConfigParser {
+	return &tomlParser{}
+}
+
+type strictJSONParser struct{}
+
+// Decode decodes the json data to struct, it fails if there are unknown fields.
+func (p *strictJSONParser) Decode(data string, config interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after the json value at offset %d", decoder.InputOffset())
+	}
+	return nil
+}
+
+// Encode encodes the config in json.
+func (p *strictJSONParser) Encode(config interface{}) (string, error) {
+	return encodeJSON(config)
+}
+
+type yamlParser struct{}
+
+// Decode decodes the yaml data to struct, it fails if there are unknown fields.
+func (p *yamlParser) Decode(data string, config interface{}) error {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(data), &v); err != nil {
+		return err
+	}
+	return decodeAsJSON(normalizeYAML(v), config)
+}
+
+// Encode encodes the config in yaml with the json field names.
+func (p *yamlParser) Encode(config interface{}) (string, error) {
+	v, err := encodeAsMap(config)
+	if err != nil {
+		return "", err
+	}
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// normalizeYAML converts the map[interface{}]interface{} decoded from yaml to
+// map[string]interface{}, which can be encoded as json.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(value)
+		}
+		return m
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = normalizeYAML(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = normalizeYAML(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+type tomlParser struct{}
+
+// Decode decodes the toml data to struct, it fails if there are unknown fields.
+func (p *tomlParser) Decode(data string, config interface{}) error {
+	v := map[string]interface{}{}
+	if _, err := toml.Decode(data, &v); err != nil {
+		return err
+	}
+	return decodeAsJSON(v, config)
+}
+
+// Encode encodes the config in toml with the json field names, the null values are omitted.
+func (p *tomlParser) Encode(config interface{}) (string, error) {
+	v, err := encodeAsMap(config)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = toml.NewEncoder(&buf).Encode(omitNull(v)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// omitNull removes the null values in the maps, which can not be encoded in toml.
+func omitNull(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if value == nil {
+				delete(v, key)
+			} else {
+				v[key] = omitNull(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = omitNull(value)
+		}
+	}
+	return v
+}
+
+func encodeJSON(config interface{}) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// encodeAsMap converts config to the generic values with the json field names.
+func encodeAsMap(config interface{}) (interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeAsJSON decodes the generic value v to config through json, it fails if there are unknown fields.
+func decodeAsJSON(v, config interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(&buf)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(config)
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+type testTimeout struct {
+	RPCTimeoutMS  int `json:"rpc_timeout_ms"`
+	ConnTimeoutMS int `json:"conn_timeout_ms"`
+}
+
+func TestParsers(t *testing.T) {
+	want := map[string]testTimeout{
+		"*":    {RPCTimeoutMS: 3000, ConnTimeoutMS: 100},
+		"echo": {RPCTimeoutMS: 1000, ConnTimeoutMS: 50},
+	}
+	for name, tc := range map[string]struct {
+		parser ConfigParser
+		data   string
+	}{
+		"json":        {defaultConfigParse(), `{"*":{"rpc_timeout_ms":3000,"conn_timeout_ms":100},"echo":{"rpc_timeout_ms":1000,"conn_timeout_ms":50}}`},
+		"strict json": {NewStrictJSONParser(), `{"*":{"rpc_timeout_ms":3000,"conn_timeout_ms":100},"echo":{"rpc_timeout_ms":1000,"conn_timeout_ms":50}}`},
+		"yaml": {NewYAMLParser(), `
+"*":
+  rpc_timeout_ms: 3000
+  conn_timeout_ms: 100
+echo:
+  rpc_timeout_ms: 1000
+  conn_timeout_ms: 50
+`},
+		"toml": {NewTOMLParser(), `
+["*"]
+rpc_timeout_ms = 3000
+conn_timeout_ms = 100
+
+[echo]
+rpc_timeout_ms = 1000
+conn_timeout_ms = 50
+`},
+	} {
+		got := map[string]testTimeout{}
+		err := tc.parser.Decode(tc.data, &got)
+		test.Assert(t, err == nil, name, err)
+		test.Assert(t, len(got) == 2 && got["*"] == want["*"] && got["echo"] == want["echo"], name, got)
+	}
+}
+
+func TestStrictParsers(t *testing.T) {
+	got := map[string]testTimeout{}
+	test.Assert(t, defaultConfigParse().Decode(`{"*":{"rpc_timeout":3000}}`, &got) == nil)
+	test.Assert(t, NewStrictJSONParser().Decode(`{"*":{"rpc_timeout":3000}}`, &got) != nil)
+	test.Assert(t, NewStrictJSONParser().Decode(`{"*":{"rpc_timeout_ms":3000}} {}`, &got) != nil)
+	test.Assert(t, NewYAMLParser().Decode("\"*\":\n  rpc_timeout: 3000\n", &got) != nil)
+	test.Assert(t, NewTOMLParser().Decode("[\"*\"]\nrpc_timeout = 3000\n", &got) != nil)
+}
+
+func TestEncoders(t *testing.T) {
+	type testPolicy struct {
+		Enable  bool         `json:"enable"`
+		Timeout *testTimeout `json:"timeout"`
+	}
+	want := map[string]testPolicy{
+		"*":    {Enable: true, Timeout: &testTimeout{RPCTimeoutMS: 3000, ConnTimeoutMS: 100}},
+		"echo": {Enable: false},
+	}
+	for name, parser := range map[string]ConfigParser{
+		"json":        defaultConfigParse(),
+		"strict json": NewStrictJSONParser(),
+		"yaml":        NewYAMLParser(),
+		"toml":        NewTOMLParser(),
+	} {
+		data, err := parser.(ConfigEncoder).Encode(want)
+		test.Assert(t, err == nil, name, err)
+		got := map[string]testPolicy{}
+		test.Assert(t, parser.Decode(data, &got) == nil, name, data)
+		test.Assert(t, len(got) == 2 && got["*"].Enable && *got["*"].Timeout == *want["*"].Timeout, name, data)
+		test.Assert(t, !got["echo"].Enable && got["echo"].Timeout == nil, name, data)
+	}
+}
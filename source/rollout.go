@@ -0,0 +1,141 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// RolloutPrefix is the prefix of the rollout envelope of a config value, which is
+// "canary:v1:{json of RolloutValue}".
+const RolloutPrefix = "canary:v1:"
+
+// Instance identifies the process, which decides whether the candidate of a rollout applies to it.
+type Instance struct {
+	ID   string
+	Tags []string
+}
+
+// Rollout is the spec of a canary rollout. The candidate applies to an instance if it has any of
+// Tags, its id is in Instances, or it is in the Percent of the instances by the stable hash of
+// its id, so the instances selected are kept when Percent is raised. The instance without an id
+// is selected by its tags only.
+type Rollout struct {
+	Percent   float64  `json:"percent,omitempty"`
+	Instances []string `json:"instances,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	// Seed changes the instances selected by Percent.
+	Seed string `json:"seed,omitempty"`
+}
+
+// Applies reports whether the candidate applies to instance.
+func (r *Rollout) Applies(instance Instance) bool {
+	if r.Percent >= 100 {
+		return true
+	}
+	for _, tag := range r.Tags {
+		for _, t := range instance.Tags {
+			if tag == t {
+				return true
+			}
+		}
+	}
+	if instance.ID == "" {
+		return false
+	}
+	for _, id := range r.Instances {
+		if id == instance.ID {
+			return true
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(r.Seed + "/" + instance.ID))
+	return float64(h.Sum32()%10000) < r.Percent*100
+}
+
+// RolloutValue is the config value in the rollout envelope, Stable and Candidate are the raw values.
+type RolloutValue struct {
+	Rollout   Rollout `json:"rollout"`
+	Stable    string  `json:"stable"`
+	Candidate string  `json:"candidate"`
+}
+
+// Select returns the candidate if it applies to instance, otherwise the stable value.
+func (v *RolloutValue) Select(instance Instance) string {
+	if v.Rollout.Applies(instance) {
+		return v.Candidate
+	}
+	return v.Stable
+}
+
+// String returns the value in the rollout envelope.
+func (v *RolloutValue) String() string {
+	data, _ := json.Marshal(v)
+	return RolloutPrefix + string(data)
+}
+
+// IsRollout reports whether value is in the rollout envelope.
+func IsRollout(value string) bool {
+	return strings.HasPrefix(value, RolloutPrefix)
+}
+
+// ParseRollout parses the value in the rollout envelope.
+func ParseRollout(value string) (*RolloutValue, error) {
+	if !IsRollout(value) {
+		return nil, errors.New("[config] config is not in the rollout envelope")
+	}
+	v := &RolloutValue{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(value, RolloutPrefix)), v); err != nil {
+		return nil, fmt.Errorf("[config] malformed rollout config: %w", err)
+	}
+	return v, nil
+}
+
+// rolloutParser decodes the stable or the candidate value of the rollout envelope which
+// applies to the instance. The signature of the selected value is removed without verification,
+// since the signature of the envelope covers it.
+type rolloutParser struct {
+	ConfigParser
+	instance Instance
+}
+
+// NewRolloutParser returns a ConfigParser which decodes the value in the rollout envelope
+// applying to instance by parser, the other values are decoded as is.
+func NewRolloutParser(parser ConfigParser, instance Instance) ConfigParser {
+	return &rolloutParser{ConfigParser: parser, instance: instance}
+}
+
+func (p *rolloutParser) Decode(data string, config interface{}) error {
+	if IsRollout(data) {
+		v, err := ParseRollout(data)
+		if err != nil {
+			return err
+		}
+		data = Unsign(v.Select(p.instance))
+	}
+	return p.ConfigParser.Decode(data, config)
+}
+
+// Encode encodes config by the parser, or in json if it is not a ConfigEncoder.
+func (p *rolloutParser) Encode(config interface{}) (string, error) {
+	if encoder, ok := p.ConfigParser.(ConfigEncoder); ok {
+		return encoder.Encode(config)
+	}
+	return encodeJSON(config)
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"testing"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+func TestRolloutApplies(t *testing.T) {
+	r := &Rollout{Percent: 10}
+	selected := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("instance-%d", i)
+		if r.Applies(Instance{ID: id}) {
+			selected[id] = true
+		}
+	}
+	test.Assert(t, len(selected) > 50 && len(selected) < 150, len(selected))
+	// the instances selected are kept when the percent is raised.
+	r.Percent = 30
+	n := 0
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("instance-%d", i)
+		if r.Applies(Instance{ID: id}) {
+			n++
+		} else {
+			test.Assert(t, !selected[id], id)
+		}
+	}
+	test.Assert(t, n > len(selected), n)
+
+	r = &Rollout{Instances: []string{"a"}, Tags: []string{"zone=us-east"}}
+	test.Assert(t, r.Applies(Instance{ID: "a"}))
+	test.Assert(t, r.Applies(Instance{ID: "b", Tags: []string{"env=prod", "zone=us-east"}}))
+	test.Assert(t, !r.Applies(Instance{ID: "b"}))
+	// the tags are evaluated without an id.
+	test.Assert(t, r.Applies(Instance{Tags: []string{"zone=us-east"}}))
+	test.Assert(t, !r.Applies(Instance{Tags: []string{"zone=us-west"}}))
+	test.Assert(t, !(&Rollout{Percent: 99.99}).Applies(Instance{}))
+	test.Assert(t, (&Rollout{Percent: 100}).Applies(Instance{}))
+}
+
+func TestRolloutParser(t *testing.T) {
+	v := &RolloutValue{Rollout: Rollout{Instances: []string{"canary"}}, Stable: `{"qps_limit":100}`, Candidate: `{"qps_limit":200}`}
+	parsed, err := ParseRollout(v.String())
+	test.Assert(t, err == nil && parsed.Candidate == v.Candidate && parsed.Rollout.Instances[0] == "canary", parsed, err)
+	_, err = ParseRollout(RolloutPrefix + "{")
+	test.Assert(t, err != nil)
+
+	var config map[string]int
+	parser := NewRolloutParser(defaultConfigParse(), Instance{ID: "canary"})
+	test.Assert(t, parser.Decode(v.String(), &config) == nil && config["qps_limit"] == 200, config)
+	parser = NewRolloutParser(defaultConfigParse(), Instance{ID: "other"})
+	test.Assert(t, parser.Decode(v.String(), &config) == nil && config["qps_limit"] == 100, config)
+	test.Assert(t, parser.Decode(`{"qps_limit":300}`, &config) == nil && config["qps_limit"] == 300, config)
+
+	// the envelope is verified, and the signature of the values in it is removed.
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	key := &SigningKey{ID: "k1", Key: priv}
+	v.Candidate, _ = Sign(key, "/config/a", v.Candidate)
+	signed, _ := Sign(key, "/config/a", v.String())
+	c := &Codec{Parser: NewStrictJSONParser(), TrustedKeys: map[string]ed25519.PublicKey{"k1": pub}, Instance: Instance{ID: "canary"}}
+	test.Assert(t, c.ParserOf("/config/a", "limit").Decode(signed, &config) == nil && config["qps_limit"] == 200, config)
+	test.Assert(t, c.ParserOf("/config/a", "limit").Decode(v.String(), &config) != nil, "unsigned envelope")
+	test.Assert(t, isStrict(parseErrorParser{c.ParserOf("/config/a", "limit")}))
+}
@@ -0,0 +1,161 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SchedulePrefix is the prefix of the schedule envelope of a config value, which is
+// "schedule:v1:{json of ScheduledValue}".
+const SchedulePrefix = "schedule:v1:"
+
+// Window is the time window [From, To) of a scheduled variant, the zero From or To is unbounded.
+type Window struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Contains reports whether t is in the window.
+func (w Window) Contains(t time.Time) bool {
+	return (w.From.IsZero() || !t.Before(w.From)) && (w.To.IsZero() || t.Before(w.To))
+}
+
+// ScheduledVariant is the raw value applying in the window.
+type ScheduledVariant struct {
+	Window
+	Value string `json:"value"`
+}
+
+// ScheduledValue is the config value in the schedule envelope, Default applies out of the
+// windows of Variants, and the first variant whose window contains the time applies in them.
+type ScheduledValue struct {
+	Default  string             `json:"default"`
+	Variants []ScheduledVariant `json:"variants"`
+}
+
+// Select returns the raw value applying at now.
+func (v *ScheduledValue) Select(now time.Time) string {
+	for _, variant := range v.Variants {
+		if variant.Contains(now) {
+			return variant.Value
+		}
+	}
+	return v.Default
+}
+
+// Next returns the first boundary of the windows after now, when the value applying may change.
+// It returns false if there is none.
+func (v *ScheduledValue) Next(now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, variant := range v.Variants {
+		for _, t := range []time.Time{variant.From, variant.To} {
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// String returns the value in the schedule envelope.
+func (v *ScheduledValue) String() string {
+	data, _ := json.Marshal(v)
+	return SchedulePrefix + string(data)
+}
+
+// IsScheduled reports whether value is in the schedule envelope.
+func IsScheduled(value string) bool {
+	return strings.HasPrefix(value, SchedulePrefix)
+}
+
+// ParseSchedule parses the value in the schedule envelope.
+func ParseSchedule(value string) (*ScheduledValue, error) {
+	if !IsScheduled(value) {
+		return nil, errors.New("[config] config is not in the schedule envelope")
+	}
+	v := &ScheduledValue{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(value, SchedulePrefix)), v); err != nil {
+		return nil, fmt.Errorf("[config] malformed scheduled config: %w", err)
+	}
+	return v, nil
+}
+
+// CheckWindow returns an error if the window is empty.
+func CheckWindow(w Window) error {
+	if !w.From.IsZero() && !w.To.IsZero() && !w.From.Before(w.To) {
+		return fmt.Errorf("[config] the window from %s to %s is empty", w.From.Format(time.RFC3339), w.To.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// NextBoundary returns the next boundary after now of the windows of value, the scheduled
+// value which applies to instance if it is in the rollout envelope. The signatures are not
+// verified since the value is verified when it is decoded.
+func NextBoundary(value string, instance Instance, now time.Time) (time.Time, bool) {
+	value = Unsign(value)
+	if IsRollout(value) {
+		v, err := ParseRollout(value)
+		if err != nil {
+			return time.Time{}, false
+		}
+		value = Unsign(v.Select(instance))
+	}
+	if !IsScheduled(value) {
+		return time.Time{}, false
+	}
+	v, err := ParseSchedule(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return v.Next(now)
+}
+
+// scheduleParser decodes the variant of the schedule envelope applying at the time of decoding.
+// The signature of the selected value is removed without verification, since the signature of
+// the envelope covers it.
+type scheduleParser struct {
+	ConfigParser
+	now func() time.Time
+}
+
+// NewScheduleParser returns a ConfigParser which decodes the value in the schedule envelope
+// applying at now() by parser, the other values are decoded as is.
+func NewScheduleParser(parser ConfigParser, now func() time.Time) ConfigParser {
+	return &scheduleParser{ConfigParser: parser, now: now}
+}
+
+func (p *scheduleParser) Decode(data string, config interface{}) error {
+	if IsScheduled(data) {
+		v, err := ParseSchedule(data)
+		if err != nil {
+			return err
+		}
+		data = Unsign(v.Select(p.now()))
+	}
+	return p.ConfigParser.Decode(data, config)
+}
+
+// Encode encodes config by the parser, or in json if it is not a ConfigEncoder.
+func (p *scheduleParser) Encode(config interface{}) (string, error) {
+	if encoder, ok := p.ConfigParser.(ConfigEncoder); ok {
+		return encoder.Encode(config)
+	}
+	return encodeJSON(config)
+}
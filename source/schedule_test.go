@@ -0,0 +1,66 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+func TestScheduledValue(t *testing.T) {
+	at := time.Date(2024, 11, 11, 20, 0, 0, 0, time.UTC)
+	v := &ScheduledValue{
+		Default: `{"qps_limit":100}`,
+		Variants: []ScheduledVariant{
+			{Window: Window{From: at, To: at.Add(3 * time.Hour)}, Value: `{"qps_limit":500}`},
+			{Window: Window{From: at.Add(10 * time.Hour)}, Value: `{"qps_limit":200}`},
+		},
+	}
+	test.Assert(t, v.Select(at.Add(-time.Second)) == v.Default)
+	test.Assert(t, v.Select(at) == `{"qps_limit":500}`)
+	test.Assert(t, v.Select(at.Add(3*time.Hour)) == v.Default)
+	test.Assert(t, v.Select(at.Add(100*time.Hour)) == `{"qps_limit":200}`)
+	next, ok := v.Next(at.Add(-time.Hour))
+	test.Assert(t, ok && next.Equal(at), next)
+	next, ok = v.Next(at)
+	test.Assert(t, ok && next.Equal(at.Add(3*time.Hour)), next)
+	_, ok = v.Next(at.Add(10 * time.Hour))
+	test.Assert(t, !ok)
+
+	parsed, err := ParseSchedule(v.String())
+	test.Assert(t, err == nil && len(parsed.Variants) == 2 && parsed.Variants[0].From.Equal(at), parsed, err)
+	_, err = ParseSchedule(SchedulePrefix + "{")
+	test.Assert(t, err != nil)
+	test.Assert(t, CheckWindow(Window{From: at, To: at}) != nil)
+	test.Assert(t, CheckWindow(Window{To: at}) == nil)
+
+	var config map[string]int
+	parser := NewScheduleParser(defaultConfigParse(), func() time.Time { return at })
+	test.Assert(t, parser.Decode(v.String(), &config) == nil && config["qps_limit"] == 500, config)
+
+	// the envelope is verified, and the signature of the variants in it is removed.
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	key := &SigningKey{ID: "k1", Key: priv}
+	v.Variants[1].Value, _ = Sign(key, "/config/a", v.Variants[1].Value)
+	signed, _ := Sign(key, "/config/a", v.String())
+	c := &Codec{Parser: NewStrictJSONParser(), TrustedKeys: map[string]ed25519.PublicKey{"k1": pub}}
+	test.Assert(t, c.ParserOf("/config/a", "limit").Decode(signed, &config) == nil, config)
+	test.Assert(t, isStrict(parseErrorParser{c.ParserOf("/config/a", "limit")}))
+	next, ok = NextBoundary(signed, Instance{}, at)
+	test.Assert(t, ok && next.Equal(at.Add(3*time.Hour)), next)
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignedPrefix is the prefix of the signature envelope of a config value, which is
+// "sig:v1:{key id}:{unix time of signing}:{base64 of the ed25519 signature}:{value}".
+// The value may be encrypted. The signature covers the config key, the time and the value,
+// so a signed value can not be moved to another key.
+const SignedPrefix = "sig:v1:"
+
+var (
+	// ErrUnsigned is returned when a value without the signature envelope is verified.
+	ErrUnsigned = errors.New("[config] config is not signed")
+	// ErrBadSignature is returned when the signature of a value can not be verified by the trusted keys.
+	ErrBadSignature = errors.New("[config] config signature verification failed")
+	// ErrStaleSignature is returned when a value is signed earlier than the value applied, e.g. an
+	// old signed value is written again.
+	ErrStaleSignature = errors.New("[config] config is signed earlier than the config applied")
+	// ErrUnverifiedDeletion is returned when a config is deleted while the signatures are verified,
+	// since the deletion is not signed.
+	ErrUnverifiedDeletion = errors.New("[config] config deletion can not be verified")
+)
+
+// SigningKey is the ed25519 private key to sign the config values, ID is the id of its
+// public key in the trusted keys of the readers.
+type SigningKey struct {
+	ID  string
+	Key ed25519.PrivateKey
+}
+
+// NewFileSigningKey returns the SigningKey of the ed25519 seed or private key in the file at
+// path, in base64 or in raw bytes.
+func NewFileSigningKey(id, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := decodeKey(data)
+	switch len(key) {
+	case ed25519.SeedSize:
+		return &SigningKey{ID: id, Key: ed25519.NewKeyFromSeed(key)}, nil
+	case ed25519.PrivateKeySize:
+		return &SigningKey{ID: id, Key: ed25519.PrivateKey(key)}, nil
+	}
+	return nil, fmt.Errorf("[config] invalid ed25519 signing key size %d", len(key))
+}
+
+// IsSigned reports whether value is in the signature envelope.
+func IsSigned(value string) bool {
+	return strings.HasPrefix(value, SignedPrefix)
+}
+
+// Sign signs value stored at the config key configKey with key in the signature envelope.
+func Sign(key *SigningKey, configKey, value string) (string, error) {
+	if key == nil || len(key.Key) != ed25519.PrivateKeySize {
+		return "", errors.New("[config] invalid ed25519 signing key")
+	}
+	if key.ID == "" || strings.Contains(key.ID, ":") {
+		return "", fmt.Errorf("[config] invalid signing key id %q", key.ID)
+	}
+	at := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := ed25519.Sign(key.Key, signedPayload(configKey, at, value))
+	return SignedPrefix + key.ID + ":" + at + ":" + base64.StdEncoding.EncodeToString(signature) + ":" + value, nil
+}
+
+// Verify verifies the signature of value stored at the config key configKey with the trusted
+// public keys by id, and returns the signed value. It returns ErrUnsigned if value is not signed,
+// and ErrBadSignature if the key is not trusted or the signature does not match, e.g. the value
+// is signed for another config key.
+func Verify(trusted map[string]ed25519.PublicKey, configKey, value string) (string, error) {
+	if !IsSigned(value) {
+		return "", ErrUnsigned
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, SignedPrefix), ":", 4)
+	if len(parts) != 4 {
+		return "", fmt.Errorf("%w: malformed envelope", ErrBadSignature)
+	}
+	id, at, signed := parts[0], parts[1], parts[3]
+	key, ok := trusted[id]
+	if !ok {
+		return "", fmt.Errorf("%w: untrusted key %q", ErrBadSignature, id)
+	}
+	signature, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, signedPayload(configKey, at, signed), signature) {
+		return "", fmt.Errorf("%w: key %q", ErrBadSignature, id)
+	}
+	return signed, nil
+}
+
+// SignedAt returns the time when value in the signature envelope is signed, without verifying it.
+func SignedAt(value string) (time.Time, bool) {
+	if !IsSigned(value) {
+		return time.Time{}, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, SignedPrefix), ":", 4)
+	if len(parts) != 4 {
+		return time.Time{}, false
+	}
+	at, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(at, 0), true
+}
+
+// signedPayload is the payload signed for value stored at configKey, which is prefixed by the
+// length of configKey so that the key and the value can not be shifted into each other.
+func signedPayload(configKey, at, value string) []byte {
+	return []byte(strconv.Itoa(len(configKey)) + ":" + configKey + ":" + at + ":" + value)
+}
+
+// Unsign returns the signed value in the signature envelope without verifying it, the value
+// not in the envelope is returned as is. It is for displaying the values only.
+func Unsign(value string) string {
+	if !IsSigned(value) {
+		return value
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, SignedPrefix), ":", 4)
+	if len(parts) != 4 {
+		return value
+	}
+	return parts[3]
+}
+
+// verifyParser verifies the signature of the values before decoding them, so the unsigned
+// or badly signed values are rejected like the malformed ones and the last good config is kept.
+type verifyParser struct {
+	ConfigParser
+	trusted map[string]ed25519.PublicKey
+	key     string
+}
+
+// NewVerifyParser returns a ConfigParser which verifies the signature of the values of the config
+// key with the trusted public keys by id before decoding them by parser. If trusted is nil, the
+// signature envelope is removed without verification.
+func NewVerifyParser(parser ConfigParser, trusted map[string]ed25519.PublicKey, key string) ConfigParser {
+	return &verifyParser{ConfigParser: parser, trusted: trusted, key: key}
+}
+
+// verifies reports whether parser verifies the signature of the values by the trusted keys.
+func verifies(parser ConfigParser) bool {
+	switch p := parser.(type) {
+	case *verifyParser:
+		return p.trusted != nil
+	case parseErrorParser:
+		return verifies(p.ConfigParser)
+	}
+	return false
+}
+
+func (p *verifyParser) Decode(data string, config interface{}) error {
+	if p.trusted == nil {
+		return p.ConfigParser.Decode(Unsign(data), config)
+	}
+	signed, err := Verify(p.trusted, p.key, data)
+	if err != nil {
+		return err
+	}
+	return p.ConfigParser.Decode(signed, config)
+}
+
+// Encode encodes config by the parser, or in json if it is not a ConfigEncoder.
+func (p *verifyParser) Encode(config interface{}) (string, error) {
+	if encoder, ok := p.ConfigParser.(ConfigEncoder); ok {
+		return encoder.Encode(config)
+	}
+	return encodeJSON(config)
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/thriftgo/pkg/test"
+)
+
+func TestSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	test.Assert(t, err == nil, err)
+	key := &SigningKey{ID: "k1", Key: priv}
+	trusted := map[string]ed25519.PublicKey{"k1": pub}
+
+	value := `{"qps_limit":100}`
+	signed, err := Sign(key, "/config/a", value)
+	test.Assert(t, err == nil && IsSigned(signed) && strings.HasSuffix(signed, ":"+value), signed, err)
+	got, err := Verify(trusted, "/config/a", signed)
+	test.Assert(t, err == nil && got == value, got, err)
+	test.Assert(t, Unsign(signed) == value && Unsign(value) == value)
+	at, ok := SignedAt(signed)
+	test.Assert(t, ok && time.Since(at) < time.Minute, at)
+
+	_, err = Verify(trusted, "/config/a", value)
+	test.Assert(t, errors.Is(err, ErrUnsigned), err)
+	_, err = Verify(trusted, "/config/a", strings.Replace(signed, "100", "999", 1))
+	test.Assert(t, errors.Is(err, ErrBadSignature), err)
+	_, err = Verify(map[string]ed25519.PublicKey{"k2": pub}, "/config/a", signed)
+	test.Assert(t, errors.Is(err, ErrBadSignature), err)
+	_, err = Sign(&SigningKey{ID: "a:b", Key: priv}, "/config/a", value)
+	test.Assert(t, err != nil)
+
+	// the signed value can not be moved to another key, nor re-timed.
+	_, err = Verify(trusted, "/config/b", signed)
+	test.Assert(t, errors.Is(err, ErrBadSignature), err)
+	parts := strings.SplitN(signed, ":", 5)
+	_, err = Verify(trusted, "/config/a", strings.Join([]string{parts[0], parts[1], parts[2], "1", parts[4]}, ":"))
+	test.Assert(t, errors.Is(err, ErrBadSignature), err)
+
+	// the signature covers the encrypted envelope.
+	keys, _ := NewStaticKeyProvider("e1", bytes.Repeat([]byte("k"), 32))
+	encrypted, err := Encrypt(keys, "/config/a", value)
+	test.Assert(t, err == nil, err)
+	signed, err = Sign(key, "/config/a", encrypted)
+	test.Assert(t, err == nil, err)
+	c := &Codec{Parser: defaultConfigParse(), KeyProvider: keys, TrustedKeys: trusted}
+	var config map[string]int
+	test.Assert(t, c.Decode("/config/a", "limit", signed, &config) == nil && config["qps_limit"] == 100, config)
+	test.Assert(t, IsParseError(c.Decode("/config/a", "limit", encrypted, &config)), "unsigned")
+	test.Assert(t, IsParseError(c.Decode("/config/b", "limit", signed, &config)), "moved")
+	c.TrustedKeys = nil
+	test.Assert(t, c.Decode("/config/a", "limit", signed, &config) == nil, "signature removed")
+	test.Assert(t, IsParseError(c.Decode("/config/b", "limit", signed, &config)), "moved and encrypted")
+	c.Parser = NewStrictJSONParser()
+	test.Assert(t, isStrict(parseErrorParser{c.ParserOf("/config/a", "limit")}))
+}
+
+func TestDeliverVerified(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	test.Assert(t, err == nil, err)
+	trusted := map[string]ed25519.PublicKey{"k1": pub}
+	signAt := func(key, value string, at int64) string {
+		payload := strconv.FormatInt(at, 10)
+		signature := ed25519.Sign(priv, signedPayload(key, payload, value))
+		return SignedPrefix + "k1:" + payload + ":" + base64.StdEncoding.EncodeToString(signature) + ":" + value
+	}
+	var got map[string]int
+	s := NewSubscriber(func(restoreDefault bool, data string, parser ConfigParser, meta ConfigMeta) error {
+		got = nil
+		if restoreDefault {
+			return nil
+		}
+		return parser.Decode(data, &got)
+	}, &RegisterOptions{})
+	c := &Codec{Parser: defaultConfigParse(), TrustedKeys: trusted}
+	parser := c.ParserOf("/config/a", "limit")
+
+	event := s.Deliver(Update{Key: "/config/a", Value: signAt("/config/a", `{"qps":100}`, 200), ModRevision: 1}, parser)
+	test.Assert(t, event.Err == nil && got["qps"] == 100, event.Err, got)
+	// the value signed earlier is replayed.
+	event = s.Deliver(Update{Key: "/config/a", Value: signAt("/config/a", `{"qps":50}`, 100), ModRevision: 2}, parser)
+	test.Assert(t, errors.Is(event.Err, ErrStaleSignature) && got["qps"] == 100, event.Err, got)
+	event = s.Deliver(Update{Key: "/config/a", Value: signAt("/config/a", `{"qps":200}`, 200), ModRevision: 3}, parser)
+	test.Assert(t, event.Err == nil && got["qps"] == 200, event.Err, got)
+
+	// the deletion can not be verified, so the last verified config is kept.
+	event = s.Deliver(Update{Key: "/config/a", ModRevision: 0}, parser)
+	test.Assert(t, errors.Is(event.Err, ErrUnverifiedDeletion) && event.Type == EventRejected && got["qps"] == 200, event.Err, got)
+
+	// the deletion of the override restores the verified config under it.
+	override := OverrideKey("/config/a")
+	parser = c.ParserOf(override, "limit")
+	s.Deliver(Update{Key: override, Value: signAt(override, `{"qps":500}`, 300), ModRevision: 4}, parser)
+	event = s.Deliver(Update{Key: override, ModRevision: 0}, parser)
+	test.Assert(t, event.Err == nil && event.Type == EventRestored && got == nil, event.Err, got)
+
+	// without the trusted keys, the deletion restores the default config.
+	s.Deliver(Update{Key: "/config/b", Value: `{"qps":100}`, ModRevision: 5}, (&Codec{Parser: defaultConfigParse()}).ParserOf("/config/b", "limit"))
+	event = s.Deliver(Update{Key: "/config/b", ModRevision: 0}, (&Codec{Parser: defaultConfigParse()}).ParserOf("/config/b", "limit"))
+	test.Assert(t, event.Err == nil && event.Type == EventRestored, event.Err)
+}
+
+func TestFileSigningKey(t *testing.T) {
+	seed := bytes.Repeat([]byte("s"), ed25519.SeedSize)
+	path := filepath.Join(t.TempDir(), "key")
+	test.Assert(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(seed)), 0o600) == nil)
+	key, err := NewFileSigningKey("k1", path)
+	test.Assert(t, err == nil && key.ID == "k1", err)
+	test.Assert(t, key.Key.Equal(ed25519.NewKeyFromSeed(seed)))
+
+	test.Assert(t, os.WriteFile(path, []byte("short"), 0o600) == nil)
+	_, err = NewFileSigningKey("k1", path)
+	test.Assert(t, err != nil)
+}
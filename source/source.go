@@ -0,0 +1,52 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package source defines ConfigSource, the source of the governance configs the client and
+// server suites depend on, and the types and the helpers shared by its implementations: the
+// keys, the parsers, the envelopes of the values and the delivery to the callbacks.
+// etcd.Client is the default implementation, and source/file reads the configs from the local
+// files with the same key layout.
+package source
+
+import (
+	"context"
+)
+
+// ConfigValue is the raw value of a config key.
+type ConfigValue struct {
+	Key         string
+	Value       string
+	ModRevision int64
+}
+
+// ConfigSource gets and watches the config values by key, the keys are rendered from the
+// config parameters, and the values are delivered to the callbacks by Subscriber.
+type ConfigSource interface {
+	// ClientConfigKey and ServerConfigKey render the keys of the client and server configs.
+	ClientConfigKey(cpc *ConfigParamConfig, cfs ...CustomFunction) (string, error)
+	ServerConfigKey(cpc *ConfigParamConfig, cfs ...CustomFunction) (string, error)
+	// ClientConfigLayers and ServerConfigLayers render the keys of the layers of the configs,
+	// which are registered by WithLayers.
+	ClientConfigLayers(cpc *ConfigParamConfig, cfs ...CustomFunction) ([]string, error)
+	ServerConfigLayers(cpc *ConfigParamConfig, cfs ...CustomFunction) ([]string, error)
+	// GetValue returns the current value of key, or ErrConfigNotFound if it does not exist.
+	GetValue(ctx context.Context, key string) (ConfigValue, error)
+	// RegisterConfigCallback watches key and delivers its current value to the callback before
+	// it returns, and the later changes until it is deregistered by DeregisterConfig.
+	RegisterConfigCallback(ctx context.Context, key string, uniqueID int64, callback ConfigCallback, opts ...RegisterOption) error
+	DeregisterConfig(key string, uniqueID int64)
+	// Close stops all the watches, the ConfigSource can not be used after it is closed.
+	// It returns ErrClosed if it is closed already.
+	Close() error
+}
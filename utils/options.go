@@ -14,7 +14,12 @@
 
 package utils
 
-import "github.com/kitex-contrib/config-etcd/etcd"
+import (
+	"github.com/kitex-contrib/config-etcd/etcd"
+	"github.com/kitex-contrib/config-etcd/pkg/validation"
+
+	"github.com/kitex-contrib/config-etcd/source"
+)
 
 // Option is used to custom Options.
 type Option interface {
@@ -24,4 +29,26 @@ type Option interface {
 // Options is used to initialize the etcd config suit or option.
 type Options struct {
 	EtcdCustomFunctions []etcd.CustomFunction
+	// OnConfigRejected is called with the key and the error when a config is rejected by
+	// the validators, the last valid config is kept.
+	OnConfigRejected func(key string, err *validation.Error)
+	// ConfigListeners observe the config events of the suite.
+	ConfigListeners []source.ConfigListener
+	// Dimensions override the dimensions read from the environment variables, see source.DimensionsFromEnv.
+	Dimensions source.Dimensions
+}
+
+// ConfigDimensions returns the dimensions used to render the config keys.
+func (o *Options) ConfigDimensions() source.Dimensions {
+	return source.DimensionsFromEnv().Merge(o.Dimensions)
+}
+
+// Validate validates the config of category decoded from key, and reports the error
+// to OnConfigRejected if the config is rejected.
+func (o *Options) Validate(key, category string, config interface{}) error {
+	err := validation.Validate(category, config)
+	if err != nil && o.OnConfigRejected != nil {
+		o.OnConfigRejected(key, err.(*validation.Error))
+	}
+	return err
 }